@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/auth"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/logger"
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// passphraseEnv holds the passphrase for encrypted token storage in unattended runs
+const passphraseEnv = "BEST_TIME_TO_MEET_PASSPHRASE"
+
+var loginWrite bool
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Log in to Google, show the current credentials or log out",
+	Long: `With an OAuth client secret (--credentials), the tool stores a token in the user
+config directory after you authorize it in the browser. Use these commands to
+authorize ahead of time, check which account and scopes are in use, and revoke
+access. Service account keys and Application Default Credentials need no login.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Authorize the tool in the browser and store the token",
+	RunE:  runAuthLogin,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the authorized account, scopes and token expiry",
+	RunE:  runAuthStatus,
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke the stored token and delete it",
+	RunE:  runAuthLogout,
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authLogoutCmd)
+
+	authLoginCmd.Flags().BoolVar(&loginWrite, "write", false, "Also request calendar write access, for features that create events")
+}
+
+func runAuthLogin(cmd *cobra.Command, args []string) error {
+	opts := authOptions()
+	if loginWrite {
+		opts.Scopes = append(opts.Scopes, auth.WriteScopes...)
+	}
+
+	stored, err := auth.Login(cmd.Context(), opts)
+	if err != nil {
+		if interrupted := scheduler.InterruptionError(cmd.Context(), "authorization"); interrupted != nil {
+			return interrupted
+		}
+		return scheduler.NewError(scheduler.KindAuthFailure, err, "login failed")
+	}
+
+	fmt.Printf("Logged in. Granted scopes:\n")
+	for _, scope := range stored.Scopes {
+		fmt.Printf("  %s\n", scope)
+	}
+	return nil
+}
+
+func runAuthStatus(cmd *cobra.Command, args []string) error {
+	status, err := auth.GetStatus(cmd.Context(), authOptions())
+	if status == nil {
+		return scheduler.NewError(scheduler.KindAuthFailure, err, "unable to read credentials")
+	}
+
+	if profile := viper.GetString("profile"); profile != "" {
+		fmt.Printf("Profile:     %s\n", profile)
+	}
+	fmt.Printf("Credentials: %s\n", status.CredentialsType)
+	if status.TokenLocation != "" {
+		fmt.Printf("Token:       %s\n", status.TokenLocation)
+	}
+	if !status.LoggedIn {
+		if err != nil {
+			fmt.Printf("Status:      not authorized (%v)\n", err)
+			return reportedError{scheduler.NewError(scheduler.KindAuthFailure, err, "credentials are not usable")}
+		}
+		fmt.Printf("Status:      not logged in (run \"auth login\")\n")
+		return reportedError{scheduler.NewError(scheduler.KindAuthFailure, nil, "not logged in")}
+	}
+
+	account := status.Account
+	if account == "" {
+		account = "unknown"
+	}
+	fmt.Printf("Account:     %s\n", account)
+	fmt.Printf("Scopes:      %s\n", strings.Join(status.Scopes, "\n             "))
+	if !status.Expiry.IsZero() {
+		fmt.Printf("Expires:     %s (in %s)\n", status.Expiry.Local().Format(time.RFC3339), time.Until(status.Expiry).Round(time.Second))
+	}
+	if status.TokenLocation != "" {
+		fmt.Printf("Refreshable: %t\n", status.RefreshToken)
+	}
+	return nil
+}
+
+func runAuthLogout(cmd *cobra.Command, args []string) error {
+	err := auth.Logout(cmd.Context(), authOptions())
+	if errors.Is(err, auth.ErrNotLoggedIn) {
+		fmt.Println("Not logged in.")
+		return nil
+	}
+	if err != nil {
+		return scheduler.NewError(scheduler.KindFailure, err, "logout failed")
+	}
+	fmt.Println("Logged out.")
+	return nil
+}
+
+// tokenPassphrase returns the passphrase for encrypted token storage from the
+// environment, or asks for it when stdin is a terminal
+func tokenPassphrase() (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("set %s to unlock the encrypted token", passphraseEnv)
+	}
+	logger.Printf("Token passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	logger.Println()
+	if err != nil {
+		return "", fmt.Errorf("unable to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
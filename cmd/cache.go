@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cacheKind    string
+	clearExpired bool
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clear cached calendar data and group memberships",
+	Long: `Busy times, calendar timezones, group member lists and primary addresses are cached on disk so that
+repeated searches don't hit the Google APIs again. Use these commands to see what
+is cached and to remove entries.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached entries",
+	RunE:  runCacheList,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove cached entries",
+	RunE:  runCacheClear,
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	cacheCmd.PersistentFlags().StringVar(&cacheKind, "kind", "", fmt.Sprintf("Only include entries of this kind (%s, %s, %s, %s or %s)",
+		calendar.CacheKindFreeBusy, calendar.CacheKindTimeZone, directory.CacheKindMembers, directory.CacheKindSnapshots, directory.CacheKindUsers))
+	cacheClearCmd.Flags().BoolVar(&clearExpired, "expired", false, "Only remove entries older than the cache TTL")
+}
+
+// openCalendarCache opens the on-disk cache according to the cache_ttl, refresh and offline settings.
+// It returns nil when caching is disabled.
+func openCalendarCache() (*cache.Store, error) {
+	return openCache("calendar", viper.GetDuration("cache_ttl"), viper.GetBool("refresh"))
+}
+
+// openGroupCache opens the on-disk cache for group memberships according to the
+// group_cache_ttl and offline settings. It returns nil when caching is disabled.
+func openGroupCache(refresh bool) (*cache.Store, error) {
+	return openCache("group", viper.GetDuration("group_cache_ttl"), refresh)
+}
+
+// openCache opens the cache directory with the given TTL, honoring --offline
+func openCache(name string, ttl time.Duration, refresh bool) (*cache.Store, error) {
+	offline := viper.GetBool("offline")
+
+	if refresh && offline {
+		return nil, fmt.Errorf("--refresh and --offline cannot be used together")
+	}
+
+	mode := cache.ModeDefault
+	switch {
+	case offline:
+		mode = cache.ModeOffline
+	case refresh:
+		mode = cache.ModeRefresh
+	case ttl <= 0:
+		log.Debug().Msgf("%s cache disabled", strings.ToUpper(name[:1])+name[1:])
+		return nil, nil
+	}
+
+	store, err := cache.New(viper.GetString("cache_dir"), ttl, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().
+		Str("dir", store.Dir()).
+		Dur("ttl", ttl).
+		Bool("refresh", refresh).
+		Bool("offline", offline).
+		Msgf("Using %s cache", name)
+
+	return store, nil
+}
+
+// openCacheForInspection opens the cache directory with the configured TTLs to report expiry
+func openCacheForInspection() (*cache.Store, error) {
+	store, err := cache.New(viper.GetString("cache_dir"), viper.GetDuration("cache_ttl"), cache.ModeDefault)
+	if err != nil {
+		return nil, scheduler.NewError(scheduler.KindInvalidInput, err, "failed to open cache")
+	}
+	store.SetKindTTL(directory.CacheKindMembers, viper.GetDuration("group_cache_ttl"))
+	store.SetKindTTL(directory.CacheKindSnapshots, viper.GetDuration("group_cache_ttl"))
+	store.SetKindTTL(directory.CacheKindUsers, viper.GetDuration("group_cache_ttl"))
+	return store, nil
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	store, err := openCacheForInspection()
+	if err != nil {
+		return err
+	}
+
+	entries, err := store.Entries(cacheKind)
+	if err != nil {
+		return scheduler.NewError(scheduler.KindFailure, err, "failed to read cache")
+	}
+
+	fmt.Printf("Cache directory: %s\n", store.Dir())
+	if len(entries) == 0 {
+		fmt.Println("No cached entries.")
+		return nil
+	}
+
+	var totalSize int64
+	expired := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "KIND\tKEY\tAGE\tSTATUS")
+	for _, entry := range entries {
+		status := "fresh"
+		if entry.Expired {
+			status = "expired"
+			expired++
+		}
+		age := "-"
+		if !entry.StoredAt.IsZero() {
+			age = time.Since(entry.StoredAt).Round(time.Second).String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", entry.Kind, entry.Key, age, status)
+		totalSize += entry.Size
+	}
+	writer.Flush()
+
+	fmt.Printf("\n%d entries (%d expired), %d bytes\n", len(entries), expired, totalSize)
+	return nil
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	store, err := openCacheForInspection()
+	if err != nil {
+		return err
+	}
+
+	removed, err := store.Clear(cacheKind, clearExpired)
+	if err != nil {
+		return scheduler.NewError(scheduler.KindFailure, err, "failed to clear cache after removing %d entries", removed).
+			WithDetail("removed", removed)
+	}
+
+	fmt.Printf("Removed %d cached entries from %s\n", removed, store.Dir())
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// reportedError wraps an error that was already written as part of the command output
+type reportedError struct {
+	error
+}
+
+func (e reportedError) Unwrap() error {
+	return e.error
+}
+
+// outputRenderer returns the renderer selected by --json
+func outputRenderer() scheduler.Renderer {
+	if viper.GetBool("json_output") {
+		return scheduler.JSONRenderer{}
+	}
+	return scheduler.TextRenderer{}
+}
+
+// reportError writes err with the output renderer, falling back to an error log.
+// result may be nil when the search never started.
+func reportError(result *scheduler.Result, err error) {
+	if written, renderErr := outputRenderer().RenderError(os.Stdout, result, err); renderErr == nil && written {
+		return
+	}
+
+	schedErr := scheduler.AsError(err)
+	event := log.Error().Str("code", string(schedErr.Kind))
+	if schedErr.Err != nil {
+		event = event.Err(schedErr.Err)
+	}
+	for key, value := range schedErr.Details {
+		event = event.Interface(key, value)
+	}
+	event.Msg(schedErr.Message)
+}
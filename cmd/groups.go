@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/auth"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/logger"
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var groupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "Inspect mailing list memberships",
+}
+
+var groupsDiffCmd = &cobra.Command{
+	Use:   "diff [group...]",
+	Short: "Show who joined or left a mailing list since it was last resolved",
+	Long: `Resolves the given groups or org selectors (or the configured mailing_lists) again from the
+Directory API and compares the members with the membership cached by the previous
+complete resolution. The cache is updated with the new membership afterwards.`,
+	PreRunE: bindGroupsDiffFlags,
+	RunE:    runGroupsDiff,
+}
+
+// groupsDiffFlags maps the config keys groups diff reads to the flags it registers.
+// The root command registers flags of the same names for the search.
+var groupsDiffFlags = map[string]string{
+	"domain":          "domain",
+	"offline":         "offline",
+	"progress":        "progress",
+	"concurrency":     "concurrency",
+	"member_roles":    "member-roles",
+	"member_status":   "member-status",
+	"member_delivery": "member-delivery",
+	"allow_domains":   "allow-domains",
+	"deny_domains":    "deny-domains",
+}
+
+func init() {
+	rootCmd.AddCommand(groupsCmd)
+	groupsCmd.AddCommand(groupsDiffCmd)
+
+	groupsDiffCmd.Flags().StringVar(&domain, "domain", "", "Domain appended to groups given without one (e.g. 'engineering')")
+	groupsDiffCmd.Flags().BoolVar(&offline, "offline", false, "Not supported: groups diff always resolves the groups from the Directory API")
+	groupsDiffCmd.Flags().StringVar(&progressMode, "progress", "auto", "Progress on stderr: auto (bar on a terminal, silent otherwise), bar, json or none")
+	groupsDiffCmd.Flags().IntVar(&concurrency, "concurrency", calendar.DefaultConcurrency, "Maximum number of Directory API calls in flight at once")
+	groupsDiffCmd.Flags().StringSliceVar(&memberRoles, "member-roles", nil, "Only count group members with these roles: OWNER, MANAGER, MEMBER (comma-separated)")
+	groupsDiffCmd.Flags().StringSliceVar(&memberStatuses, "member-status", nil, "Only count group members with these statuses, e.g. ACTIVE to skip suspended accounts")
+	groupsDiffCmd.Flags().StringSliceVar(&memberDelivery, "member-delivery", nil, "Only count group members with these delivery settings: ALL_MAIL, DAILY, DIGEST, DISABLED, NONE")
+	groupsDiffCmd.Flags().StringSliceVar(&allowDomains, "allow-domains", nil, "Only count group members from these domains")
+	groupsDiffCmd.Flags().StringSliceVar(&denyDomains, "deny-domains", nil, "Never count group members from these domains")
+}
+
+// bindGroupsDiffFlags binds the config keys to the groups diff flags instead of the root
+// command's, which are not parsed when the subcommand runs
+func bindGroupsDiffFlags(cmd *cobra.Command, args []string) error {
+	for key, name := range groupsDiffFlags {
+		if err := viper.BindPFlag(key, cmd.Flags().Lookup(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newGroupResolver returns a resolver for mailing lists backed by the group cache.
+// In offline mode it serves member lists from the cache only and needs no credentials.
+func newGroupResolver(ctx context.Context, retrier *scheduler.Retrier, reporter scheduler.ProgressReporter, refresh bool) (*scheduler.DirectoryResolver, error) {
+	filter := memberFilter()
+	if err := filter.Validate(); err != nil {
+		return nil, scheduler.NewError(scheduler.KindInvalidInput, err, "invalid member filter")
+	}
+	groupCache, err := openGroupCache(refresh)
+	if err != nil {
+		return nil, scheduler.NewError(scheduler.KindInvalidInput, err, "failed to open group cache")
+	}
+
+	resolver := &scheduler.DirectoryResolver{
+		Options: scheduler.ResolveOptions{
+			Retrier:     retrier,
+			Progress:    reporter,
+			Concurrency: viper.GetInt("concurrency"),
+			Limiter:     directory.NewRateLimiter(),
+			Filter:      filter,
+			Cache:       groupCache,
+		},
+	}
+	if groupCache.Offline() {
+		return resolver, nil
+	}
+
+	resolver.Service, err = auth.GetDirectoryServiceWithOptions(ctx, authOptions())
+	if err != nil {
+		if interrupted := scheduler.InterruptionError(ctx, "authorization"); interrupted != nil {
+			return nil, interrupted
+		}
+		return nil, scheduler.NewError(scheduler.KindAuthFailure, err, "failed to get Directory service")
+	}
+	return resolver, nil
+}
+
+func runGroupsDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	// Groups given as arguments stand in for mailing_lists, which also decides the scopes requested
+	if len(args) > 0 {
+		viper.Set("mailing_lists", strings.Join(args, ","))
+	}
+	groups := nonEmpty(qualifyAddresses(strings.Split(viper.GetString("mailing_lists"), ","), viper.GetString("domain")))
+	if len(groups) == 0 {
+		return scheduler.NewError(scheduler.KindInvalidInput, nil, "no groups given and no mailing_lists configured")
+	}
+	if viper.GetBool("offline") {
+		return scheduler.NewError(scheduler.KindInvalidInput, nil, "groups diff needs the Directory API and cannot run offline")
+	}
+
+	reporter, err := progressReporter()
+	if err != nil {
+		return err
+	}
+	resolver, err := newGroupResolver(ctx, scheduler.NewRetrier(scheduler.NewRetryStats()), reporter, true)
+	if err != nil {
+		return err
+	}
+
+	// Read the previous snapshots before resolving replaces them
+	previous := make(map[string]*directory.MembershipSnapshot, len(groups))
+	for _, group := range groups {
+		snapshot, found, err := directory.LoadSnapshot(resolver.Options.Cache, group)
+		if err != nil {
+			log.Warn().Err(err).Str("group", group).Msg("Ignoring unreadable group membership snapshot")
+		}
+		if found {
+			previous[group] = snapshot
+		}
+	}
+
+	_, summary, err := resolver.ResolveGroups(ctx, groups)
+	if err != nil {
+		return err
+	}
+	if interrupted := scheduler.InterruptionError(ctx, "group resolution"); interrupted != nil {
+		return interrupted
+	}
+
+	failed := 0
+	for i, result := range summary.Results {
+		if i > 0 {
+			fmt.Println()
+		}
+		group := result.OriginalEmail
+		if result.Error != nil {
+			failed++
+			fmt.Printf("%s: could not be resolved: %v\n", group, result.Error)
+			continue
+		}
+		if !result.IsGroup {
+			failed++
+			fmt.Printf("%s: not a group\n", group)
+			continue
+		}
+
+		snapshot, found := previous[group]
+		var diff directory.MembershipDiff
+		if found {
+			diff, err = snapshot.Diff(result.ResolvedTo, resolver.Options.Filter)
+		}
+		switch {
+		case !found:
+			fmt.Printf("%s: %d members, no previous membership to compare with\n", group, len(result.ResolvedTo))
+		case errors.Is(err, directory.ErrFilterChanged):
+			fmt.Printf("%s: %d members, not compared since %v; they replace it from now on\n", group, len(result.ResolvedTo), err)
+		default:
+			fmt.Printf("%s (since %s, %s ago)\n", group,
+				diff.Since.Local().Format("2006-01-02 15:04"), time.Since(diff.Since).Round(time.Minute))
+			for _, email := range diff.Joined {
+				fmt.Printf("  + %s\n", email)
+			}
+			for _, email := range diff.Left {
+				fmt.Printf("  - %s\n", email)
+			}
+			fmt.Printf("  %d joined, %d left, %d members\n", len(diff.Joined), len(diff.Left), len(result.ResolvedTo))
+		}
+		if len(result.Excluded) > 0 {
+			fmt.Printf("  %d members left out by the member filters\n", len(result.Excluded))
+		}
+		if result.PartialFailure {
+			logger.Printf("Warning: some nested groups of %s could not be resolved; departures may be missing members rather than leavers, and the snapshot was not updated\n", group)
+		}
+	}
+
+	if failed > 0 {
+		return scheduler.NewError(scheduler.KindFailure, nil, "%d of %d groups could not be resolved", failed, len(summary.Results))
+	}
+	return nil
+}
+
+// memberFilter returns the group member filters selected by flags and config
+func memberFilter() scheduler.MemberFilter {
+	return scheduler.MemberFilter{
+		Roles:            nonEmpty(viper.GetStringSlice("member_roles")),
+		Statuses:         nonEmpty(viper.GetStringSlice("member_status")),
+		DeliverySettings: nonEmpty(viper.GetStringSlice("member_delivery")),
+		AllowDomains:     nonEmpty(viper.GetStringSlice("allow_domains")),
+		DenyDomains:      nonEmpty(viper.GetStringSlice("deny_domains")),
+	}
+}
+
+// nonEmpty drops blank entries from a comma-separated list
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/auth"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// profileKeys maps the settings a profile can override to their command line flags
+var profileKeys = map[string]string{
+	"credentials":   "credentials",
+	"subject":       "subject",
+	"adc":           "adc",
+	"token_file":    "token-file",
+	"auth_flow":     "auth-flow",
+	"token_storage": "token-storage",
+	"domain":        "domain",
+	"cache_dir":     "cache-dir",
+}
+
+// applyProfile copies the settings of the selected profile over the top-level config.
+// Flags given on the command line still win.
+func applyProfile(cmd *cobra.Command) error {
+	name := viper.GetString("profile")
+	if name == "" {
+		return nil
+	}
+	if err := auth.ValidateProfileName(name); err != nil {
+		return scheduler.NewError(scheduler.KindInvalidInput, err, "invalid profile")
+	}
+
+	profile := viper.Sub("profiles." + name)
+	if profile == nil {
+		return scheduler.NewError(scheduler.KindInvalidInput, nil, "profile %q is not defined in the config file", name)
+	}
+	for key, flag := range profileKeys {
+		if profile.IsSet(key) && !cmd.Flags().Changed(flag) {
+			viper.Set(key, profile.Get(key))
+		}
+	}
+
+	log.Info().Str("profile", name).Str("credentials", viper.GetString("credentials")).Msg("Using profile")
+	return nil
+}
+
+// qualifyAddresses appends @domain to entries given as bare user or group names.
+// Org selectors are left alone, except for the manager named by reports-of.
+func qualifyAddresses(addresses []string, domain string) []string {
+	domain = strings.TrimPrefix(strings.TrimSpace(domain), "@")
+	if domain == "" {
+		return addresses
+	}
+	qualified := make([]string, len(addresses))
+	for i, address := range addresses {
+		address = strings.TrimSpace(address)
+		if selector, ok := directory.ParseSelector(address); ok && selector.Kind != directory.SelectorReportsOf {
+			qualified[i] = address
+			continue
+		}
+		if address != "" && !strings.Contains(address, "@") {
+			address += "@" + domain
+		}
+		qualified[i] = address
+	}
+	return qualified
+}
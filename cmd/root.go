@@ -2,19 +2,22 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
-	"sort"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/LorisFriedel/find-best-meeting-time-google/internal/auth"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
 	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
 	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
-	"github.com/LorisFriedel/find-best-meeting-time-google/internal/holidays"
 	"github.com/LorisFriedel/find-best-meeting-time-google/internal/logger"
-	"github.com/LorisFriedel/find-best-meeting-time-google/internal/optimizer"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/snapshot"
+	"github.com/LorisFriedel/find-best-meeting-time-google/scheduler"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,7 +26,16 @@ import (
 var (
 	cfgFile          string
 	credentialsFile  string
+	subject          string
+	useADC           bool
+	profileName      string
+	tokenFile        string
+	authFlow         string
+	tokenStorage     string
+	domain           string
 	emails           string
+	exclude          string
+	resolveAliases   bool
 	mailingLists     string
 	startDate        string
 	endDate          string
@@ -39,123 +51,88 @@ var (
 	debug            bool
 	jsonOutput       bool
 	batchSize        int
+	concurrency      int
+	strict           bool
+	cacheDir         string
+	cacheTTL         time.Duration
+	groupCacheTTL    time.Duration
+	memberRoles      []string
+	memberStatuses   []string
+	memberDelivery   []string
+	allowDomains     []string
+	denyDomains      []string
+	refreshCache     bool
+	offline          bool
+	saveSnapshot     string
+	attendeeCals     []string
+	discoverCals     bool
+	fromSnapshot     string
+	timeout          time.Duration
+	logFile          string
+	logFormat        string
+	progressMode     string
 	includeHolidays  bool
 	holidayOverrides map[string]string
 )
 
-// JSONOutput represents the complete output in JSON format
-type JSONOutput struct {
-	Metadata       OutputMetadata      `json:"metadata"`
-	Summary        Summary             `json:"summary"`
-	TimezoneInfo   TimezoneInfo        `json:"timezone_info"`
-	BestOptions    BestOptions         `json:"best_options"`
-	DailySummary   []DailySummary      `json:"daily_summary"`
-	DetailedSlots  []DetailedTimeSlot  `json:"detailed_slots"`
-	Recommendation *RecommendationSlot `json:"recommendation"`
-}
-
-// OutputMetadata contains metadata about the search
-type OutputMetadata struct {
-	SearchStartDate     string  `json:"search_start_date"`
-	SearchEndDate       string  `json:"search_end_date"`
-	MeetingDuration     int     `json:"meeting_duration_minutes"`
-	TotalAttendees      int     `json:"total_attendees"`
-	AccessibleCalendars int     `json:"accessible_calendars"`
-	WorkingHours        string  `json:"working_hours"`
-	LunchHours          string  `json:"lunch_hours"`
-	ExcludeWeekends     bool    `json:"exclude_weekends"`
-	MaxConflicts        float64 `json:"max_conflicts_percentage"`
-	Timezone            string  `json:"timezone"`
-}
-
-// Summary contains high-level statistics
-type Summary struct {
-	TotalSlotsFound     int `json:"total_slots_found"`
-	PerfectSlots        int `json:"perfect_slots"`
-	LowConflictSlots    int `json:"low_conflict_slots"`
-	MediumConflictSlots int `json:"medium_conflict_slots"`
-}
-
-// TimezoneInfo contains timezone information for attendees
-type TimezoneInfo struct {
-	AttendeesByTimezone map[string][]string `json:"attendees_by_timezone"`
-	WorkingHoursNote    string              `json:"working_hours_note"`
-}
-
-// BestOptions contains categorized best meeting options
-type BestOptions struct {
-	PerfectSlots []TimeSlotSummary `json:"perfect_slots"`
-	GoodOptions  []TimeSlotSummary `json:"good_options"`
-}
-
-// TimeSlotSummary is a simplified view of a time slot
-type TimeSlotSummary struct {
-	StartTime          string  `json:"start_time"`
-	EndTime            string  `json:"end_time"`
-	ConflictPercentage float64 `json:"conflict_percentage"`
-	ConflictCount      int     `json:"conflict_count"`
-}
-
-// DailySummary contains summary statistics for a day
-type DailySummary struct {
-	Date             string  `json:"date"`
-	TotalSlots       int     `json:"total_slots"`
-	PerfectSlots     int     `json:"perfect_slots"`
-	BestConflict     float64 `json:"best_conflict_percentage"`
-	AverageConflict  float64 `json:"average_conflict_percentage"`
-	EarliestSlotTime string  `json:"earliest_slot_time"`
-	LatestSlotTime   string  `json:"latest_slot_time"`
-}
-
-// DetailedTimeSlot contains detailed information about a time slot
-type DetailedTimeSlot struct {
-	StartTime          string              `json:"start_time"`
-	EndTime            string              `json:"end_time"`
-	ConflictPercentage float64             `json:"conflict_percentage"`
-	UnavailableCount   int                 `json:"unavailable_count"`
-	UnavailableEmails  []string            `json:"unavailable_emails"`
-	AvailableEmails    []string            `json:"available_emails"`
-	TimeZoneScore      float64             `json:"timezone_score"`
-	ConflictsByType    map[string][]string `json:"conflicts_by_type"`
-	HolidayConflicts   map[string]string   `json:"holiday_conflicts,omitempty"`
-}
-
-// RecommendationSlot contains the recommended meeting slot
-type RecommendationSlot struct {
-	StartTime             string  `json:"start_time"`
-	EndTime               string  `json:"end_time"`
-	ConflictPercentage    float64 `json:"conflict_percentage"`
-	UnavailableCount      int     `json:"unavailable_count"`
-	CalendarConflicts     int     `json:"calendar_conflicts"`
-	WorkingHoursConflicts int     `json:"working_hours_conflicts"`
-	HolidayConflicts      int     `json:"holiday_conflicts"`
-	Reason                string  `json:"reason"`
-}
-
 var rootCmd = &cobra.Command{
 	Use:   "best-time-to-meet",
 	Short: "Find optimal meeting times across multiple Google calendars",
 	Long: `A tool that analyzes multiple Google calendars to find the best meeting times
 with the least number of conflicts. It uses the Google Calendar API to check
 availability and suggests optimal time slots.`,
-	Run: runFindMeetingTime,
+	PersistentPreRunE: prepareRun,
+	RunE:              runFindMeetingTime,
+	SilenceErrors:     true,
 }
 
+// The first Ctrl-C (or SIGTERM) cancels the run context so in-flight work can stop cleanly;
+// a second one terminates immediately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		var reported reportedError
+		if !errors.As(err, &reported) {
+			reportError(nil, err)
+		}
+		logger.Close()
+		os.Exit(scheduler.ExitCode(err))
 	}
+	logger.Close()
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return scheduler.NewError(scheduler.KindInvalidInput, err, "invalid command line")
+	})
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./config.yaml)")
-	rootCmd.PersistentFlags().StringVar(&credentialsFile, "credentials", "credentials.json", "Google API credentials file")
+	rootCmd.PersistentFlags().StringVar(&credentialsFile, "credentials", "credentials.json", "Google API credentials file (OAuth client secret or service account key, detected automatically)")
+	rootCmd.PersistentFlags().StringVar(&subject, "subject", "", "User to impersonate with a service account's domain-wide delegation")
+	rootCmd.PersistentFlags().BoolVar(&useADC, "adc", false, "Use Application Default Credentials instead of --credentials")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Named profile from the config file with its own credentials, token and domain")
+	rootCmd.PersistentFlags().StringVar(&authFlow, "auth-flow", auth.FlowAuto, "How to authorize an OAuth client: auto, browser, device (code entered on another device) or manual")
+	rootCmd.PersistentFlags().StringVar(&tokenStorage, "token-storage", auth.StorageFile, "Where to keep the OAuth token: file, encrypted (passphrase-protected file) or keyring (OS keyring)")
+	rootCmd.PersistentFlags().StringVar(&tokenFile, "token-file", "", "Where the OAuth token is stored (default is in the user config directory, per profile)")
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "Directory for cached calendar data (default is the user cache directory)")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Maximum time for the whole run, e.g. 2m (0 means no limit)")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug logging")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append logs to this file instead of stderr (warnings and errors are still shown)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logger.FormatConsole, "Log format: console or json")
 
 	rootCmd.Flags().StringVarP(&emails, "emails", "e", "", "Comma-separated list of individual email addresses")
-	rootCmd.Flags().StringVarP(&mailingLists, "mailing-lists", "l", "", "Comma-separated list of mailing list/group email addresses")
+	rootCmd.Flags().StringVarP(&mailingLists, "mailing-lists", "l", "", "Comma-separated list of mailing list/group email addresses, or org selectors (reports-of:, orgunit:, query:)")
+	rootCmd.Flags().StringVarP(&exclude, "exclude", "x", "", "Comma-separated people and mailing lists to leave out; mailing lists are expanded and their members removed")
+	rootCmd.Flags().BoolVar(&resolveAliases, "resolve-aliases", false, "Merge attendees listed under aliases by looking up primary addresses (needs the admin.directory.user.readonly scope)")
+	rootCmd.Flags().StringVar(&domain, "domain", "", "Domain appended to emails and mailing lists given without one (e.g. 'alice')")
 	rootCmd.Flags().StringVarP(&startDate, "start", "s", "", "Start date (YYYY-MM-DD) (required)")
 	rootCmd.Flags().StringVarP(&endDate, "end", "E", "", "End date (YYYY-MM-DD) (required)")
 	rootCmd.Flags().IntVarP(&duration, "duration", "d", 60, "Meeting duration in minutes")
@@ -167,20 +144,45 @@ func init() {
 	rootCmd.Flags().IntVarP(&maxSlots, "max-slots", "m", 10, "Maximum number of slots to display")
 	rootCmd.Flags().BoolVarP(&excludeWeekends, "exclude-weekends", "w", true, "Exclude weekends from search")
 	rootCmd.Flags().Float64VarP(&maxConflicts, "max-conflicts", "c", 100, "Maximum conflict percentage to display (0-100)")
-	rootCmd.Flags().BoolVar(&debug, "debug", false, "Enable debug logging")
 	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results in JSON format")
+	rootCmd.Flags().StringVar(&progressMode, "progress", "auto", "Progress on stderr: auto (bar on a terminal, silent otherwise), bar, json or none")
 	rootCmd.Flags().IntVar(&batchSize, "batch-size", 50, "Number of calendars to process per API request (for large groups)")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", calendar.DefaultConcurrency, "Maximum number of Calendar API calls, and separately of Directory API calls, in flight at once")
+	rootCmd.Flags().BoolVar(&strict, "strict", false, "Fail instead of returning partial results when any attendee's availability is missing")
+	rootCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", cache.DefaultTTL, "How long cached busy data and timezones stay fresh (0 disables the cache)")
+	rootCmd.Flags().StringSliceVar(&memberRoles, "member-roles", nil, "Only count group members with these roles: OWNER, MANAGER, MEMBER (comma-separated)")
+	rootCmd.Flags().StringSliceVar(&memberStatuses, "member-status", nil, "Only count group members with these statuses, e.g. ACTIVE to skip suspended accounts")
+	rootCmd.Flags().StringSliceVar(&memberDelivery, "member-delivery", nil, "Only count group members with these delivery settings: ALL_MAIL, DAILY, DIGEST, DISABLED, NONE")
+	rootCmd.Flags().StringSliceVar(&allowDomains, "allow-domains", nil, "Only count group members from these domains")
+	rootCmd.Flags().StringSliceVar(&denyDomains, "deny-domains", nil, "Never count group members from these domains")
+	rootCmd.Flags().DurationVar(&groupCacheTTL, "group-cache-ttl", directory.DefaultCacheTTL, "How long cached group member lists stay fresh (0 disables the cache)")
+	rootCmd.Flags().BoolVar(&refreshCache, "refresh", false, "Ignore cached calendar data and group memberships and fetch everything again")
+	rootCmd.Flags().BoolVar(&offline, "offline", false, "Use only cached calendar data and group memberships, and make no Google API calls")
+	rootCmd.Flags().StringArrayVar(&attendeeCals, "attendee-calendar", nil, "Also check an additional calendar for an attendee (email=calendarID, repeatable)")
+	rootCmd.Flags().BoolVar(&discoverCals, "discover-calendars", false, "Add other calendars you own from your calendar list when you are an attendee")
+	rootCmd.Flags().StringVar(&saveSnapshot, "save-snapshot", "", "Write the attendees, fetched availability and search parameters to a file for offline replay")
+	rootCmd.Flags().StringVar(&fromSnapshot, "from-snapshot", "", "Replay a saved snapshot instead of calling Google APIs")
 	rootCmd.Flags().BoolVar(&includeHolidays, "include-holidays", true, "Consider regional bank holidays when computing availability")
 	rootCmd.Flags().StringToStringVar(&holidayOverrides, "holiday-region", nil, "Override the bank holiday region for attendees (email=ISO code)")
 
-	// At least one of emails or mailing-lists is required
-	rootCmd.MarkFlagRequired("start")
-	rootCmd.MarkFlagRequired("end")
-
 	// Bind flags to viper
 	viper.BindPFlag("credentials", rootCmd.PersistentFlags().Lookup("credentials"))
+	viper.BindPFlag("subject", rootCmd.PersistentFlags().Lookup("subject"))
+	viper.BindPFlag("adc", rootCmd.PersistentFlags().Lookup("adc"))
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindPFlag("token_file", rootCmd.PersistentFlags().Lookup("token-file"))
+	viper.BindPFlag("auth_flow", rootCmd.PersistentFlags().Lookup("auth-flow"))
+	viper.BindPFlag("token_storage", rootCmd.PersistentFlags().Lookup("token-storage"))
+	viper.BindPFlag("cache_dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
+	viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
+	viper.BindPFlag("log_file", rootCmd.PersistentFlags().Lookup("log-file"))
+	viper.BindPFlag("log_format", rootCmd.PersistentFlags().Lookup("log-format"))
 	viper.BindPFlag("emails", rootCmd.Flags().Lookup("emails"))
 	viper.BindPFlag("mailing_lists", rootCmd.Flags().Lookup("mailing-lists"))
+	viper.BindPFlag("exclude", rootCmd.Flags().Lookup("exclude"))
+	viper.BindPFlag("resolve_aliases", rootCmd.Flags().Lookup("resolve-aliases"))
+	viper.BindPFlag("domain", rootCmd.Flags().Lookup("domain"))
 	viper.BindPFlag("start", rootCmd.Flags().Lookup("start"))
 	viper.BindPFlag("end", rootCmd.Flags().Lookup("end"))
 	viper.BindPFlag("duration", rootCmd.Flags().Lookup("duration"))
@@ -192,9 +194,23 @@ func init() {
 	viper.BindPFlag("max_slots", rootCmd.Flags().Lookup("max-slots"))
 	viper.BindPFlag("exclude_weekends", rootCmd.Flags().Lookup("exclude-weekends"))
 	viper.BindPFlag("max_conflicts", rootCmd.Flags().Lookup("max-conflicts"))
-	viper.BindPFlag("debug", rootCmd.Flags().Lookup("debug"))
 	viper.BindPFlag("json_output", rootCmd.Flags().Lookup("json"))
+	viper.BindPFlag("progress", rootCmd.Flags().Lookup("progress"))
 	viper.BindPFlag("batch_size", rootCmd.Flags().Lookup("batch-size"))
+	viper.BindPFlag("concurrency", rootCmd.Flags().Lookup("concurrency"))
+	viper.BindPFlag("strict", rootCmd.Flags().Lookup("strict"))
+	viper.BindPFlag("cache_ttl", rootCmd.Flags().Lookup("cache-ttl"))
+	viper.BindPFlag("group_cache_ttl", rootCmd.Flags().Lookup("group-cache-ttl"))
+	viper.BindPFlag("member_roles", rootCmd.Flags().Lookup("member-roles"))
+	viper.BindPFlag("member_status", rootCmd.Flags().Lookup("member-status"))
+	viper.BindPFlag("member_delivery", rootCmd.Flags().Lookup("member-delivery"))
+	viper.BindPFlag("allow_domains", rootCmd.Flags().Lookup("allow-domains"))
+	viper.BindPFlag("deny_domains", rootCmd.Flags().Lookup("deny-domains"))
+	viper.BindPFlag("refresh", rootCmd.Flags().Lookup("refresh"))
+	viper.BindPFlag("offline", rootCmd.Flags().Lookup("offline"))
+	viper.BindPFlag("discover_calendars", rootCmd.Flags().Lookup("discover-calendars"))
+	viper.BindPFlag("save_snapshot", rootCmd.Flags().Lookup("save-snapshot"))
+	viper.BindPFlag("from_snapshot", rootCmd.Flags().Lookup("from-snapshot"))
 	viper.BindPFlag("include_holidays", rootCmd.Flags().Lookup("include-holidays"))
 	viper.BindPFlag("holiday_region_overrides", rootCmd.Flags().Lookup("holiday-region"))
 }
@@ -210,861 +226,543 @@ func initConfig() {
 
 	viper.AutomaticEnv()
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	viper.ReadInConfig()
+}
+
+// prepareRun runs before every command once flags and config are loaded
+func prepareRun(cmd *cobra.Command, args []string) error {
+	if err := initLogging(cmd, args); err != nil {
+		return err
 	}
+	return applyProfile(cmd)
 }
 
-func runFindMeetingTime(cmd *cobra.Command, args []string) {
-	// Initialize logger
-	logger.Init(viper.GetBool("debug"))
+// initLogging sets up the stderr reporter once flags and config are loaded, so stdout
+// carries only the selected result format
+func initLogging(cmd *cobra.Command, args []string) error {
+	// Errors past this point are reported by us, not as usage problems
+	cmd.SilenceUsage = true
 
-	// Parse inputs
-	emailsStr := viper.GetString("emails")
-	mailingListsStr := viper.GetString("mailing_lists")
+	err := logger.Init(logger.Options{
+		Debug:  viper.GetBool("debug"),
+		Format: viper.GetString("log_format"),
+		File:   viper.GetString("log_file"),
+	})
+	if err != nil {
+		return scheduler.NewError(scheduler.KindInvalidInput, err, "invalid logging options")
+	}
 
-	// Check that at least one of emails or mailing-lists is provided
-	if emailsStr == "" && mailingListsStr == "" {
-		log.Fatal().Msg("At least one of --emails or --mailing-lists must be provided")
+	if path := viper.ConfigFileUsed(); path != "" {
+		log.Info().Str("path", path).Msg("Using config file")
 	}
+	return nil
+}
 
-	var allEmails []string
+func runFindMeetingTime(cmd *cobra.Command, args []string) error {
+	// Bound the whole run by --timeout; Ctrl-C cancels the parent context
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if limit := viper.GetDuration("timeout"); limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
 
-	// Parse individual emails
-	if emailsStr != "" {
-		emails := strings.Split(emailsStr, ",")
-		for _, email := range emails {
-			email = strings.TrimSpace(email)
-			if email != "" {
-				allEmails = append(allEmails, email)
-			}
-		}
+	result, err := findMeetingTime(ctx, cmd)
+	if err != nil {
+		reportError(result, err)
+		return reportedError{err}
 	}
 
-	// Parse and resolve mailing lists
-	var resolutionSummary *directory.ResolutionSummary
-	if mailingListsStr != "" {
-		mailingLists := strings.Split(mailingListsStr, ",")
-		var mailingListsClean []string
-		for _, ml := range mailingLists {
-			ml = strings.TrimSpace(ml)
-			if ml != "" {
-				mailingListsClean = append(mailingListsClean, ml)
-			}
-		}
+	if err := outputRenderer().Render(os.Stdout, result); err != nil {
+		return scheduler.NewError(scheduler.KindFailure, err, "failed to write output")
+	}
+	return nil
+}
 
-		if len(mailingListsClean) > 0 {
-			// Get Directory service
-			directoryService, err := auth.GetDirectoryService(viper.GetString("credentials"))
-			if err != nil {
-				log.Warn().Err(err).Msg("Could not get Directory service for mailing list resolution")
-				log.Warn().Msg("Treating mailing lists as individual emails")
-				allEmails = append(allEmails, mailingListsClean...)
-			} else {
-				// Check if we have proper access
-				if err := directory.CheckGroupAccess(directoryService, mailingListsClean); err != nil {
-					log.Warn().Err(err).Msg("Group access check failed; attempting best-effort resolution anyway")
-				}
+// findMeetingTime builds a scheduler request from flags and config, runs it and
+// saves a snapshot when asked. The result is returned even on error when available.
+func findMeetingTime(ctx context.Context, cmd *cobra.Command) (*scheduler.Result, error) {
+	// Share one retry policy and statistics collector across Calendar and Directory calls
+	retryStats := scheduler.NewRetryStats()
+	retrier := scheduler.NewRetrier(retryStats)
 
-				// Resolve mailing list members with detailed information
-				log.Info().Msg("Resolving mailing lists...")
-				var resolvedEmails []string
-				resolvedEmails, resolutionSummary = directory.ResolveMemberEmailsDetailed(directoryService, mailingListsClean)
-
-				// Provide overall debug summary
-				log.Debug().
-					Int("requested_groups", len(mailingListsClean)).
-					Int("groups_processed", len(resolutionSummary.Results)).
-					Int("groups_resolved", resolutionSummary.ResolvedGroups).
-					Int("groups_unresolved", resolutionSummary.UnresolvedGroups).
-					Int("individual_fallbacks", resolutionSummary.IndividualEmails).
-					Int("unique_members", len(resolvedEmails)).
-					Msg("Mailing list resolution summary")
-
-				// Report on resolution results
-				if resolutionSummary.ResolvedGroups > 0 {
-					log.Info().
-						Int("resolved_groups", resolutionSummary.ResolvedGroups).
-						Int("total_members", len(resolvedEmails)).
-						Int("max_nesting_depth", resolutionSummary.MaxDepthReached).
-						Int("nested_groups_total", resolutionSummary.NestedGroupsTotal).
-						Msg("Successfully resolved mailing lists")
-				} else {
-					log.Debug().
-						Int("groups_processed", len(resolutionSummary.Results)).
-						Int("unique_members", len(resolvedEmails)).
-						Msg("Mailing list resolution produced no group expansions")
-				}
+	// Replay a saved snapshot instead of calling Google APIs
+	var snap *snapshot.Snapshot
+	if path := viper.GetString("from_snapshot"); path != "" {
+		var err error
+		snap, err = snapshot.Load(path)
+		if err != nil {
+			return nil, scheduler.NewError(scheduler.KindInvalidInput, err, "failed to load snapshot")
+		}
+		if err := applySnapshotParameters(cmd, snap.Parameters); err != nil {
+			return nil, err
+		}
+		log.Info().
+			Str("path", path).
+			Time("created_at", snap.CreatedAt).
+			Int("attendees", len(snap.Attendees)).
+			Msg("Replaying availability snapshot")
+	}
 
-				// Report on nested group complexity
-				if resolutionSummary.NestedGroupsTotal > 0 {
-					log.Info().
-						Int("nested_groups", resolutionSummary.NestedGroupsTotal).
-						Int("max_depth", resolutionSummary.MaxDepthReached).
-						Msg("Found nested mailing lists")
-				}
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
 
-				// Warn about circular references
-				if resolutionSummary.CircularRefsFound > 0 {
-					log.Warn().
-						Int("circular_refs", resolutionSummary.CircularRefsFound).
-						Msg("Circular references detected and handled")
-
-					// Show which groups had circular references
-					for _, result := range resolutionSummary.Results {
-						if result.CircularRef {
-							log.Warn().
-								Str("group", result.OriginalEmail).
-								Msg("⚠️  Group involved in circular reference")
-						}
-					}
-				}
+	sched := &scheduler.Scheduler{RetryStats: retryStats}
+	if snap != nil {
+		// Snapshots already carry resolved attendees and the holidays captured when they were saved
+		req.Emails, req.Groups = snap.Attendees, nil
+		sched.Availability = &scheduler.SnapshotProvider{Snapshot: snap}
+	} else if err := configureProviders(ctx, sched, retrier); err != nil {
+		return nil, err
+	}
 
-				// Provide per-group debug details when debug logging is enabled
-				for _, result := range resolutionSummary.Results {
-					if result.IsGroup {
-						log.Debug().
-							Str("group", result.OriginalEmail).
-							Int("members_resolved", len(result.ResolvedTo)).
-							Int("nested_groups", len(result.NestedGroups)).
-							Int("failed_nested_groups", len(result.FailedNestedGroups)).
-							Bool("partial_failure", result.PartialFailure).
-							Bool("circular_ref", result.CircularRef).
-							Msg("Mailing list resolved")
-					} else if result.Error != nil {
-						log.Debug().
-							Str("email", result.OriginalEmail).
-							Str("error_type", result.ErrorType).
-							Int("members_resolved", len(result.ResolvedTo)).
-							Err(result.Error).
-							Msg("Mailing list resolution failed")
-					}
-				}
+	result, err := sched.Find(ctx, req)
+	printAttendeeNotices(&result, err)
 
-				// Report on partial failures
-				hasPartialFailures := false
-				for _, result := range resolutionSummary.Results {
-					if result.PartialFailure && result.IsGroup {
-						hasPartialFailures = true
-						log.Warn().
-							Str("group", result.OriginalEmail).
-							Int("failed_nested_groups", len(result.FailedNestedGroups)).
-							Int("resolved_members", len(result.ResolvedTo)).
-							Msg("⚠️  Group partially resolved - some nested groups failed")
-
-						// Show which nested groups failed
-						for failedGroup, failErr := range result.FailedNestedGroups {
-							log.Warn().
-								Str("nested_group", failedGroup).
-								Str("parent_group", result.OriginalEmail).
-								Err(failErr).
-								Msg("   Failed to resolve nested group")
-						}
-					}
-				}
+	if path := viper.GetString("save_snapshot"); path != "" && (err == nil || scheduler.IsKind(err, scheduler.KindNoSlots)) {
+		snap := snapshot.New(result.Attendees, currentSnapshotParameters(result.Request.Location), result.Availabilities, result.FetchReport)
+		if saveErr := snap.Save(path); saveErr != nil {
+			return &result, scheduler.NewError(scheduler.KindFailure, saveErr, "failed to save snapshot")
+		}
+		log.Info().Str("path", path).Int("attendees", len(result.Attendees)).Msg("Saved availability snapshot")
+	}
 
-				if hasPartialFailures {
-					fmt.Fprintf(os.Stderr, "\n⚠️  Some nested mailing lists could not be fully resolved.\n")
-					fmt.Fprintf(os.Stderr, "   The tool will use the members it could find, but the list may be incomplete.\n\n")
-				}
+	for _, operation := range retryStats.Operations() {
+		opStats := result.APIRetries[operation]
+		log.Debug().
+			Str("operation", operation).
+			Int("calls", opStats.Calls).
+			Int("retries", opStats.Retries).
+			Int("recovered", opStats.Recovered).
+			Int("failures", opStats.Failures).
+			Msg("API retry summary")
+	}
 
-				// Warn about unresolved groups
-				if resolutionSummary.UnresolvedGroups > 0 {
-					log.Warn().
-						Int("unresolved_groups", resolutionSummary.UnresolvedGroups).
-						Msg("Some mailing lists could not be resolved")
-
-					// Show details for each unresolved group
-					for _, result := range resolutionSummary.Results {
-						if result.Error != nil {
-							if result.ErrorType == "external_domain" || result.ErrorType == "not_found" {
-								log.Warn().
-									Str("email", result.OriginalEmail).
-									Str("reason", "external domain or not found").
-									Msg("❌ Could not resolve mailing list - may be external domain")
-								fmt.Fprintf(os.Stderr, "\n⚠️  Mailing list '%s' could not be resolved.\n", result.OriginalEmail)
-								fmt.Fprintf(os.Stderr, "   This appears to be an external mailing list or doesn't exist in your domain.\n")
-								fmt.Fprintf(os.Stderr, "   The tool will attempt to use it as an individual email, but group emails don't have calendars.\n")
-								fmt.Fprintf(os.Stderr, "   Note: Google Calendar cannot expand groups with more than 200 members.\n\n")
-							}
-						}
-					}
-				}
+	return &result, err
+}
 
-				allEmails = append(allEmails, resolvedEmails...)
-			}
-		}
+// newRequest builds the search request from flags and config
+func newRequest() (scheduler.Request, error) {
+	req := scheduler.Request{
+		Emails:       qualifyAddresses(strings.Split(viper.GetString("emails"), ","), viper.GetString("domain")),
+		Groups:       qualifyAddresses(strings.Split(viper.GetString("mailing_lists"), ","), viper.GetString("domain")),
+		Exclude:      qualifyAddresses(strings.Split(viper.GetString("exclude"), ","), viper.GetString("domain")),
+		Duration:     time.Duration(viper.GetInt("duration")) * time.Minute,
+		MaxSlots:     viper.GetInt("max_slots"),
+		MaxConflicts: viper.GetFloat64("max_conflicts"),
+		Strict:       viper.GetBool("strict"),
+		WorkingHours: scheduler.WorkingHours{
+			StartHour:       viper.GetInt("start_hour"),
+			EndHour:         viper.GetInt("end_hour"),
+			LunchStartHour:  viper.GetInt("lunch_start_hour"),
+			LunchEndHour:    viper.GetInt("lunch_end_hour"),
+			ExcludeWeekends: viper.GetBool("exclude_weekends"),
+		},
 	}
 
-	// Remove duplicates
-	emailMap := make(map[string]bool)
-	var emailList []string
-	for _, email := range allEmails {
-		if !emailMap[email] {
-			emailMap[email] = true
-			emailList = append(emailList, email)
-		}
+	if viper.GetString("emails") == "" && viper.GetString("mailing_lists") == "" && viper.GetString("from_snapshot") == "" {
+		return req, scheduler.NewError(scheduler.KindInvalidInput, nil, "at least one of --emails or --mailing-lists must be provided")
 	}
-
-	if len(emailList) == 0 {
-		log.Fatal().Msg("No valid email addresses found")
+	if viper.GetString("start") == "" || viper.GetString("end") == "" {
+		return req, scheduler.NewError(scheduler.KindInvalidInput, nil, "--start and --end are required")
 	}
 
 	// Handle timezone
-	var loc *time.Location
-	tzName := viper.GetString("timezone")
-	if tzName == "" {
-		loc = time.Local
-	} else {
-		var err error
-		loc, err = time.LoadLocation(tzName)
+	req.Location = time.Local
+	if tzName := viper.GetString("timezone"); tzName != "" {
+		loc, err := time.LoadLocation(tzName)
 		if err != nil {
-			log.Fatal().Err(err).Str("timezone", tzName).Msg("Invalid timezone")
+			return req, scheduler.NewError(scheduler.KindInvalidInput, err, "invalid timezone %q", tzName)
 		}
+		req.Location = loc
 	}
 
 	// Parse dates in the specified timezone
-	startTime, err := time.ParseInLocation("2006-01-02", viper.GetString("start"), loc)
+	var err error
+	req.Start, err = time.ParseInLocation("2006-01-02", viper.GetString("start"), req.Location)
 	if err != nil {
-		log.Fatal().Err(err).Str("date", viper.GetString("start")).Msg("Invalid start date")
+		return req, scheduler.NewError(scheduler.KindInvalidInput, err, "invalid start date %q", viper.GetString("start"))
 	}
-
-	endTime, err := time.ParseInLocation("2006-01-02", viper.GetString("end"), loc)
+	req.End, err = time.ParseInLocation("2006-01-02", viper.GetString("end"), req.Location)
 	if err != nil {
-		log.Fatal().Err(err).Str("date", viper.GetString("end")).Msg("Invalid end date")
+		return req, scheduler.NewError(scheduler.KindInvalidInput, err, "invalid end date %q", viper.GetString("end"))
 	}
 
-	meetingDuration := time.Duration(viper.GetInt("duration")) * time.Minute
-
-	log.Info().Msg("Searching for optimal meeting times...")
-	log.Info().
-		Strs("attendees", emailList).
-		Str("start_date", startTime.Format("2006-01-02")).
-		Str("end_date", endTime.Format("2006-01-02")).
-		Int("duration_minutes", viper.GetInt("duration")).
-		Int("start_hour", viper.GetInt("start_hour")).
-		Int("end_hour", viper.GetInt("end_hour")).
-		Int("lunch_start_hour", viper.GetInt("lunch_start_hour")).
-		Int("lunch_end_hour", viper.GetInt("lunch_end_hour")).
-		Str("timezone", loc.String()).
-		Bool("exclude_weekends", viper.GetBool("exclude_weekends")).
-		Msg("Search parameters")
-
-	// Initialize Google Calendar service
-	service, err := auth.GetCalendarService(viper.GetString("credentials"))
+	return req, nil
+}
+
+// configureProviders sets up the Google-backed group, calendar and holiday providers
+func configureProviders(ctx context.Context, sched *scheduler.Scheduler, retrier *scheduler.Retrier) error {
+	calendarCache, err := openCalendarCache()
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to get calendar service")
+		return scheduler.NewError(scheduler.KindInvalidInput, err, "failed to open calendar cache")
 	}
 
-	// Get busy times for all attendees
-	availabilities, err := calendar.GetBusyTimesWithBatching(service, emailList, startTime, endTime.Add(24*time.Hour), viper.GetInt("batch_size"))
+	reporter, err := progressReporter()
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to get busy times")
+		return err
+	}
+
+	// Exclusions may name mailing lists too
+	resolveAliases := viper.GetBool("resolve_aliases")
+	if resolveAliases || strings.Trim(viper.GetString("mailing_lists")+viper.GetString("exclude"), ", ") != "" {
+		resolver, err := newGroupResolver(ctx, retrier, reporter, viper.GetBool("refresh"))
+		switch {
+		case scheduler.IsKind(err, scheduler.KindAuthFailure):
+			log.Warn().Err(err).Msg("Could not get Directory service for mailing list resolution")
+		case err != nil:
+			return err
+		default:
+			sched.Groups = resolver
+			if resolveAliases {
+				sched.Identities = resolver
+			}
+		}
 	}
 
-	log.Debug().
-		Int("requested_attendees", len(emailList)).
-		Int("available_calendars", len(availabilities)).
-		Msg("Calendar access summary")
-
-	for _, avail := range availabilities {
-		log.Debug().Str("email", avail.Email).Msg("Got calendar data")
+	attendeeCalendars, err := configuredAttendeeCalendars()
+	if err != nil {
+		return err
+	}
+	if sched.Identities != nil {
+		attendeeCalendars = scheduler.ByPrimaryAddress(ctx, sched.Identities, attendeeCalendars, func(existing, ids []string) []string {
+			return appendUnique(existing, ids...)
+		})
+	}
+	provider := &scheduler.CalendarProvider{
+		Options: scheduler.FetchOptions{
+			BatchSize:         viper.GetInt("batch_size"),
+			Concurrency:       viper.GetInt("concurrency"),
+			Retrier:           retrier,
+			Cache:             calendarCache,
+			AttendeeCalendars: attendeeCalendars,
+			Progress:          reporter,
+		},
+		DiscoverCalendars: viper.GetBool("discover_calendars"),
 	}
 
-	// Check for missing calendars and provide detailed feedback
-	if len(availabilities) < len(emailList) {
-		missingCalendars := calendar.GetMissingCalendars(emailList, availabilities)
-
-		log.Warn().
-			Int("accessible_calendars", len(availabilities)).
-			Int("requested_attendees", len(emailList)).
-			Int("missing_calendars", len(missingCalendars)).
-			Msg("Could not access all requested calendars")
-
-		// If there are unresolved groups from earlier, check if they're the missing ones
-		if resolutionSummary != nil && resolutionSummary.UnresolvedGroups > 0 {
-			for _, missing := range missingCalendars {
-				// Check if this was an unresolved group
-				for _, result := range resolutionSummary.Results {
-					if result.OriginalEmail == missing && result.Error != nil {
-						fmt.Fprintf(os.Stderr, "\n❌ No calendar found for '%s'\n", missing)
-						fmt.Fprintf(os.Stderr, "   This email was identified as an external mailing list.\n")
-						fmt.Fprintf(os.Stderr, "   Group/mailing list emails don't have calendars.\n\n")
-						break
-					}
-				}
+	// Initialize Google Calendar service (not needed when serving from the cache only)
+	if !calendarCache.Offline() {
+		provider.Service, err = auth.GetCalendarServiceWithOptions(ctx, authOptions())
+		if err != nil {
+			if interrupted := scheduler.InterruptionError(ctx, "authorization"); interrupted != nil {
+				return interrupted
 			}
+			return scheduler.NewError(scheduler.KindAuthFailure, err, "failed to get calendar service")
 		}
-
-		// If we have NO calendars at all, provide helpful error message and exit
-		if len(availabilities) == 0 {
-			fmt.Fprintf(os.Stderr, "\n🚫 ERROR: No calendar data could be retrieved for any attendees.\n\n")
-			fmt.Fprintf(os.Stderr, "Possible reasons:\n")
-			fmt.Fprintf(os.Stderr, "  1. External mailing lists: Group emails from external domains cannot be resolved\n")
-			fmt.Fprintf(os.Stderr, "     and don't have calendars.\n\n")
-			fmt.Fprintf(os.Stderr, "  2. Large groups: Google Calendar cannot process groups with more than 200 members.\n\n")
-			fmt.Fprintf(os.Stderr, "  3. No calendar access: You may not have permission to view these calendars.\n\n")
-			fmt.Fprintf(os.Stderr, "Solutions:\n")
-			fmt.Fprintf(os.Stderr, "  • For external groups: Request the individual member email addresses from\n")
-			fmt.Fprintf(os.Stderr, "    the group owner and use --emails instead.\n\n")
-			fmt.Fprintf(os.Stderr, "  • For internal groups: Verify the group exists in your Google Workspace domain.\n\n")
-			fmt.Fprintf(os.Stderr, "  • Check calendar sharing: Ensure calendars are shared with you or set to\n")
-			fmt.Fprintf(os.Stderr, "    \"show free/busy\" at minimum.\n\n")
-			log.Fatal().Msg("No calendar data available to process")
-		}
-
-		fmt.Fprintf(os.Stderr, "\n⚠️  Results are based only on %d out of %d requested attendees.\n",
-			len(availabilities), len(emailList))
-		fmt.Fprintf(os.Stderr, "   Missing calendar data for: %v\n\n", missingCalendars)
 	}
+	sched.Availability = provider
 
 	// Enrich attendee availability with public holidays if requested
 	if viper.GetBool("include_holidays") {
-		overrideMap := make(map[string]string)
-
-		for email, region := range viper.GetStringMapString("holiday_region_overrides") {
-			email = strings.ToLower(strings.TrimSpace(email))
-			region = strings.ToUpper(strings.TrimSpace(region))
-			if email != "" && region != "" {
-				overrideMap[email] = region
-			}
-		}
-
-		for email, region := range holidayOverrides {
-			email = strings.ToLower(strings.TrimSpace(email))
-			region = strings.ToUpper(strings.TrimSpace(region))
-			if email != "" && region != "" {
-				overrideMap[email] = region
+		if calendarCache.Offline() {
+			log.Warn().Msg("Skipping bank holiday lookups in offline mode")
+		} else {
+			overrides := holidayRegionOverrides()
+			if sched.Identities != nil {
+				overrides = scheduler.ByPrimaryAddress(ctx, sched.Identities, overrides, func(existing, _ string) string { return existing })
 			}
-		}
-
-		ctx := cmd.Context()
-		if ctx == nil {
-			ctx = context.Background()
-		}
-
-		holidayService := holidays.NewService(nil, overrideMap)
-		if err := holidayService.Augment(ctx, availabilities, startTime, endTime); err != nil {
-			log.Warn().Err(err).Msg("Some bank holiday lookups failed")
+			sched.Holidays = scheduler.NewHolidayProvider(nil, overrides)
 		}
 	}
 
-	// Get potential meeting slots (working hours)
-	potentialSlots := calendar.GetWorkingHours(
-		startTime,
-		endTime,
-		viper.GetInt("start_hour"),
-		viper.GetInt("end_hour"),
-		viper.GetInt("lunch_start_hour"),
-		viper.GetInt("lunch_end_hour"),
-		viper.GetBool("exclude_weekends"),
-	)
-
-	// Create working hours config
-	workingHoursConfig := optimizer.WorkingHoursConfig{
-		StartHour:       viper.GetInt("start_hour"),
-		EndHour:         viper.GetInt("end_hour"),
-		LunchStartHour:  viper.GetInt("lunch_start_hour"),
-		LunchEndHour:    viper.GetInt("lunch_end_hour"),
-		ExcludeWeekends: viper.GetBool("exclude_weekends"),
-	}
-
-	// Find optimal meeting times
-	optimalSlots := optimizer.FindOptimalMeetingSlots(
-		availabilities,
-		potentialSlots,
-		meetingDuration,
-		viper.GetInt("max_slots")*3, // Get more slots initially for filtering
-		workingHoursConfig,
-	)
+	return nil
+}
 
-	log.Debug().
-		Int("total_slots", len(optimalSlots)).
-		Msg("Found optimal slots")
+// authOptions returns the credentials selected by flags and config
+func authOptions() auth.Options {
+	opts := auth.Options{
+		CredentialsFile: viper.GetString("credentials"),
+		Subject:         viper.GetString("subject"),
+		UseADC:          viper.GetBool("adc"),
+		Profile:         viper.GetString("profile"),
+		TokenFile:       viper.GetString("token_file"),
+		Flow:            viper.GetString("auth_flow"),
+		TokenStorage:    viper.GetString("token_storage"),
+		Passphrase:      tokenPassphrase,
+	}
+	if viper.GetBool("resolve_aliases") || usesOrgSelectors() {
+		opts.Scopes = append([]string(nil), auth.UserScopes...)
+	}
+	return opts
+}
 
-	if len(optimalSlots) > 0 {
-		log.Debug().
-			Float64("first_slot_conflict_pct", optimalSlots[0].ConflictPercentage).
-			Float64("last_slot_conflict_pct", optimalSlots[len(optimalSlots)-1].ConflictPercentage).
-			Msg("Conflict percentage range")
+// usesOrgSelectors reports whether the mailing lists or exclusions list users by org
+// selector, which needs the user read scope
+func usesOrgSelectors() bool {
+	entries := strings.Split(viper.GetString("mailing_lists")+","+viper.GetString("exclude"), ",")
+	for _, entry := range entries {
+		if _, ok := directory.ParseSelector(entry); ok {
+			return true
+		}
 	}
+	return false
+}
 
-	// Filter by conflict threshold
-	filteredSlots := optimizer.FilterSlotsByThreshold(optimalSlots, viper.GetFloat64("max_conflicts"))
-
-	log.Debug().
-		Float64("max_conflicts_threshold", viper.GetFloat64("max_conflicts")).
-		Int("filtered_slots", len(filteredSlots)).
-		Msg("Filtered by conflict threshold")
-
-	// Limit to requested number of slots
-	if len(filteredSlots) > viper.GetInt("max_slots") {
-		filteredSlots = filteredSlots[:viper.GetInt("max_slots")]
+// progressReporter returns the reporter selected by --progress, or nil to stay silent
+func progressReporter() (scheduler.ProgressReporter, error) {
+	switch mode := strings.ToLower(viper.GetString("progress")); mode {
+	case "", "auto":
+		return progress.Auto(os.Stderr, logger.Writer()), nil
+	case "bar":
+		return progress.NewBar(logger.Writer()), nil
+	case "json":
+		return progress.NewStream(logger.Writer()), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, scheduler.NewError(scheduler.KindInvalidInput, nil, "unknown progress mode %q (expected auto, bar, json or none)", mode)
 	}
+}
 
-	// Sort the final results chronologically for calendar-style display
-	sort.Slice(filteredSlots, func(i, j int) bool {
-		return filteredSlots[i].TimeSlot.Start.Before(filteredSlots[j].TimeSlot.Start)
-	})
+// holidayRegionOverrides merges the holiday_region_overrides config map with --holiday-region flags
+func holidayRegionOverrides() map[string]string {
+	overrideMap := make(map[string]string)
 
-	// Display results
-	if len(filteredSlots) == 0 {
-		if viper.GetBool("json_output") {
-			output := JSONOutput{
-				Metadata: OutputMetadata{
-					SearchStartDate:     startTime.Format("2006-01-02"),
-					SearchEndDate:       endTime.Format("2006-01-02"),
-					MeetingDuration:     viper.GetInt("duration"),
-					TotalAttendees:      len(emailList),
-					AccessibleCalendars: len(availabilities),
-					WorkingHours:        fmt.Sprintf("%d:00 - %d:00", viper.GetInt("start_hour"), viper.GetInt("end_hour")),
-					LunchHours:          fmt.Sprintf("%d:00 - %d:00", viper.GetInt("lunch_start_hour"), viper.GetInt("lunch_end_hour")),
-					ExcludeWeekends:     viper.GetBool("exclude_weekends"),
-					MaxConflicts:        viper.GetFloat64("max_conflicts"),
-					Timezone:            loc.String(),
-				},
-				Summary: Summary{
-					TotalSlotsFound: 0,
-				},
-			}
-			jsonData, err := json.MarshalIndent(output, "", "  ")
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to marshal JSON output")
-			}
-			fmt.Println(string(jsonData))
-		} else {
-			fmt.Println("No suitable meeting times found within the specified constraints.")
+	for email, region := range viper.GetStringMapString("holiday_region_overrides") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		region = strings.ToUpper(strings.TrimSpace(region))
+		if email != "" && region != "" {
+			overrideMap[email] = region
 		}
-		return
-	}
-
-	// Check for JSON output mode
-	if viper.GetBool("json_output") {
-		outputJSON(availabilities, filteredSlots, optimalSlots, emailList, startTime, endTime, loc)
-		return
 	}
 
-	// === TIMEZONE SUMMARY ===
-	fmt.Println("\n" + strings.Repeat("=", 80))
-	fmt.Println("🌍 TIMEZONE INFORMATION")
-	fmt.Println(strings.Repeat("=", 80))
-
-	// Collect timezone information
-	tzMap := make(map[string][]string) // timezone -> list of emails
-	for _, avail := range availabilities {
-		tzName := "Unknown"
-		if avail.TimeZone != nil {
-			tzName = avail.TimeZone.String()
+	for email, region := range holidayOverrides {
+		email = strings.ToLower(strings.TrimSpace(email))
+		region = strings.ToUpper(strings.TrimSpace(region))
+		if email != "" && region != "" {
+			overrideMap[email] = region
 		}
-		tzMap[tzName] = append(tzMap[tzName], avail.Email)
 	}
 
-	fmt.Printf("\nAttendees by timezone:\n")
-	for tz, emails := range tzMap {
-		fmt.Printf("  • %s: %d attendee(s)\n", tz, len(emails))
-		for _, email := range emails {
-			fmt.Printf("    - %s\n", email)
-		}
-	}
-	fmt.Printf("\nWorking hours: %d:00 - %d:00 (in each attendee's local time)\n",
-		viper.GetInt("start_hour"), viper.GetInt("end_hour"))
-
-	// === BEST OPTIONS SUMMARY ===
-	fmt.Println("\n" + strings.Repeat("=", 80))
-	fmt.Println("📅 BEST MEETING TIME OPTIONS")
-	fmt.Println(strings.Repeat("=", 80))
-
-	// Group slots by conflict level
-	conflictGroups := optimizer.GroupSlotsByConflictLevel(filteredSlots)
-
-	// Show best options first
-	if len(conflictGroups["no-conflicts"]) > 0 {
-		fmt.Printf("\n🏆 PERFECT SLOTS (All attendees available):\n")
-		fmt.Printf("   Found %d perfect slot(s)\n\n", len(conflictGroups["no-conflicts"]))
-
-		// Show up to 3 best no-conflict slots
-		maxShow := 3
-		if len(conflictGroups["no-conflicts"]) < maxShow {
-			maxShow = len(conflictGroups["no-conflicts"])
-		}
+	return overrideMap
+}
 
-		for i := 0; i < maxShow; i++ {
-			slot := conflictGroups["no-conflicts"][i]
-			fmt.Printf("   ⭐ %s - %s\n",
-				slot.TimeSlot.Start.Format("Mon, Jan 2 at 15:04"),
-				slot.TimeSlot.End.Format("15:04"),
-			)
-		}
-		if len(conflictGroups["no-conflicts"]) > 3 {
-			fmt.Printf("   ... and %d more perfect slots\n", len(conflictGroups["no-conflicts"])-3)
+// printAttendeeNotices explains unresolved mailing lists and missing calendars on stderr
+func printAttendeeNotices(result *scheduler.Result, err error) {
+	if summary := result.Resolution; summary != nil {
+		for _, res := range summary.Results {
+			if res.PartialFailure && res.IsGroup {
+				logger.Printf("\n⚠️  Some nested mailing lists could not be fully resolved.\n")
+				logger.Printf("   The tool will use the members it could find, but the list may be incomplete.\n\n")
+				break
+			}
 		}
-	}
 
-	// Show slots with minimal conflicts
-	if len(conflictGroups["low-conflicts"]) > 0 {
-		fmt.Printf("\n✅ GOOD OPTIONS (1-25%% conflicts):\n")
-		fmt.Printf("   Found %d slot(s) with minimal conflicts\n", len(conflictGroups["low-conflicts"]))
+		if summary.ExcludedMembers > 0 {
+			logger.Printf("\nℹ️  %d group members were left out by the member filters (use --debug to list them).\n\n", summary.ExcludedMembers)
+		}
 
-		// Show best one from this group
-		bestLowConflict := conflictGroups["low-conflicts"][0]
-		for _, slot := range conflictGroups["low-conflicts"] {
-			if slot.ConflictPercentage < bestLowConflict.ConflictPercentage {
-				bestLowConflict = slot
+		for _, res := range summary.Results {
+			if res.Error != nil && res.Selector != "" {
+				logger.Printf("\n⚠️  Org selector '%s' could not be resolved: %v\n", res.OriginalEmail, res.Error)
+				logger.Printf("   Nobody was added for it. Org selectors need the admin.directory.user.readonly scope\n")
+				logger.Printf("   and an account allowed to view users in the Admin console.\n\n")
+				continue
+			}
+			if res.Error != nil && (res.ErrorType == "external_domain" || res.ErrorType == "not_found") {
+				logger.Printf("\n⚠️  Mailing list '%s' could not be resolved.\n", res.OriginalEmail)
+				logger.Printf("   This appears to be an external mailing list or doesn't exist in your domain.\n")
+				logger.Printf("   The tool will attempt to use it as an individual email, but group emails don't have calendars.\n")
+				logger.Printf("   Note: Google Calendar cannot expand groups with more than 200 members.\n\n")
 			}
 		}
-		fmt.Printf("   Best: %s - %s (%.0f%% conflict)\n",
-			bestLowConflict.TimeSlot.Start.Format("Mon, Jan 2 at 15:04"),
-			bestLowConflict.TimeSlot.End.Format("15:04"),
-			bestLowConflict.ConflictPercentage,
-		)
 	}
 
-	// === SUMMARY BY DAY ===
-	fmt.Println("\n" + strings.Repeat("-", 80))
-	fmt.Printf("\n📊 AVAILABILITY SUMMARY BY DAY:\n\n")
-
-	// Group by day for summary
-	grouped := optimizer.GroupSlotsByDay(filteredSlots)
+	// Only searches that got as far as checking calendar coverage have anything to report
+	if err != nil && !scheduler.IsKind(err, scheduler.KindNoSlots) && !scheduler.IsKind(err, scheduler.KindNoCalendars) {
+		return
+	}
 
-	// Sort days chronologically
-	var days []string
-	for day := range grouped {
-		days = append(days, day)
+	knownCalendars := result.KnownCalendars()
+	if knownCalendars >= len(result.Attendees) {
+		return
 	}
-	sort.Strings(days)
-
-	for _, day := range days {
-		slots := grouped[day]
-		dayTime, _ := time.Parse("2006-01-02", day)
-
-		bestConflict, avgConflict, perfectCount, _ := optimizer.GetDaySummaryStats(slots)
-
-		dayName := dayTime.Format("Mon, Jan 2")
-		fmt.Printf("📆 %s\n", dayName)
-		fmt.Printf("   Total slots: %d | Perfect slots: %d | Best conflict: %.0f%% | Avg: %.0f%%\n",
-			len(slots), perfectCount, bestConflict, avgConflict)
-
-		// Show time ranges for this day
-		if len(slots) > 0 {
-			// Find earliest and latest slots
-			earliest := slots[0].TimeSlot.Start
-			latest := slots[0].TimeSlot.End
-			for _, s := range slots {
-				if s.TimeSlot.Start.Before(earliest) {
-					earliest = s.TimeSlot.Start
-				}
-				if s.TimeSlot.End.After(latest) {
-					latest = s.TimeSlot.End
+	missingCalendars := result.Missing()
+
+	// If there are unresolved groups from earlier, check if they're the missing ones
+	if result.Resolution != nil && result.Resolution.UnresolvedGroups > 0 {
+		for _, missing := range missingCalendars {
+			for _, res := range result.Resolution.Results {
+				if res.OriginalEmail == missing && res.Error != nil {
+					logger.Printf("\n❌ No calendar found for '%s'\n", missing)
+					logger.Printf("   This email was identified as an external mailing list.\n")
+					logger.Printf("   Group/mailing list emails don't have calendars.\n\n")
+					break
 				}
 			}
-			fmt.Printf("   Time range: %s - %s\n",
-				earliest.Format("15:04"),
-				latest.Format("15:04"))
 		}
-		fmt.Println()
 	}
 
-	// === DETAILED TIME SLOTS ===
-	fmt.Println(strings.Repeat("-", 80))
-	fmt.Printf("\n📋 DETAILED TIME SLOTS (Top %d):\n", len(filteredSlots))
-	fmt.Println(strings.Repeat("-", 80))
-
-	for i, slot := range filteredSlots {
-		fmt.Printf("\n%d. %s - %s",
-			i+1,
-			slot.TimeSlot.Start.Format("Mon, Jan 2, 2006 at 15:04"),
-			slot.TimeSlot.End.Format("15:04"),
-		)
+	// If we have NO calendars at all, provide a helpful error message
+	if knownCalendars == 0 {
+		logger.Printf("\n🚫 ERROR: No calendar data could be retrieved for any attendees.\n\n")
+		logger.Printf("Possible reasons:\n")
+		logger.Printf("  1. External mailing lists: Group emails from external domains cannot be resolved\n")
+		logger.Printf("     and don't have calendars.\n\n")
+		logger.Printf("  2. Large groups: Google Calendar cannot process groups with more than 200 members.\n\n")
+		logger.Printf("  3. No calendar access: You may not have permission to view these calendars.\n\n")
+		logger.Printf("Solutions:\n")
+		logger.Printf("  • For external groups: Request the individual member email addresses from\n")
+		logger.Printf("    the group owner and use --emails instead.\n\n")
+		logger.Printf("  • For internal groups: Verify the group exists in your Google Workspace domain.\n\n")
+		logger.Printf("  • Check calendar sharing: Ensure calendars are shared with you or set to\n")
+		logger.Printf("    \"show free/busy\" at minimum.\n\n")
+		return
+	}
 
-		if slot.UnavailableCount == 0 {
-			fmt.Printf(" ✅ Perfect - All attendees available!\n")
-		} else {
-			conflictIcon := "⚠️"
-			if slot.ConflictPercentage > 50 {
-				conflictIcon = "❌"
-			} else if slot.ConflictPercentage <= 25 {
-				conflictIcon = "🟡"
-			}
+	logger.Printf("\n⚠️  Results are based only on %d out of %d requested attendees.\n",
+		knownCalendars, len(result.Attendees))
+	if len(missingCalendars) > 0 {
+		logger.Printf("   Missing calendar data for: %v\n", missingCalendars)
+	}
+	for _, avail := range result.Unknown() {
+		logger.Printf("   Unknown availability for %s (%s)\n", avail.Email, strings.Join(avail.ErrorReasons(), ", "))
+	}
+	logger.Println()
+}
 
-			fmt.Printf(" %s %.0f%% conflict\n",
-				conflictIcon,
-				slot.ConflictPercentage,
-			)
+// configuredAttendeeCalendars merges the attendee_calendars config map with --attendee-calendar flags
+func configuredAttendeeCalendars() (map[string][]string, error) {
+	attendeeCalendars := make(map[string][]string)
 
-			// Show conflicts by type
-			if len(slot.ConflictsByType["calendar"]) > 0 {
-				fmt.Printf("   📅 Calendar conflicts (%d): %s\n",
-					len(slot.ConflictsByType["calendar"]),
-					strings.Join(slot.ConflictsByType["calendar"], ", "))
-			}
-			if len(slot.ConflictsByType["working_hours"]) > 0 {
-				fmt.Printf("   ⏰ Outside working hours (%d): %s\n",
-					len(slot.ConflictsByType["working_hours"]),
-					strings.Join(slot.ConflictsByType["working_hours"], ", "))
-			}
-			if len(slot.ConflictsByType["holiday"]) > 0 {
-				var holidayDetails []string
-				for _, email := range slot.ConflictsByType["holiday"] {
-					if name, ok := slot.HolidayConflicts[email]; ok && name != "" {
-						holidayDetails = append(holidayDetails, fmt.Sprintf("%s (%s)", email, name))
-					} else {
-						holidayDetails = append(holidayDetails, email)
-					}
-				}
-				fmt.Printf("   🎉 Bank holidays (%d): %s\n",
-					len(slot.ConflictsByType["holiday"]),
-					strings.Join(holidayDetails, ", "))
+	for email, ids := range viper.GetStringMapStringSlice("attendee_calendars") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		for _, id := range ids {
+			if id = strings.TrimSpace(id); email != "" && id != "" {
+				attendeeCalendars[email] = appendUnique(attendeeCalendars[email], id)
 			}
 		}
 	}
 
-	// === QUICK RECOMMENDATION ===
-	fmt.Println("\n" + strings.Repeat("=", 80))
-	fmt.Println("💡 RECOMMENDATION:")
-
-	// Find the actual best slot across all filtered slots
-	var bestSlot optimizer.MeetingSlot
-	if len(filteredSlots) > 0 {
-		bestSlot = filteredSlots[0]
-		for _, slot := range filteredSlots {
-			// Since working hours violations are now counted as conflicts,
-			// we can simply use conflict percentage as the primary criterion
-			if slot.ConflictPercentage < bestSlot.ConflictPercentage {
-				bestSlot = slot
-			} else if slot.ConflictPercentage == bestSlot.ConflictPercentage {
-				// If conflicts are equal, prefer fewer working hours violations
-				currentWorkingHoursConflicts := len(slot.ConflictsByType["working_hours"])
-				bestWorkingHoursConflicts := len(bestSlot.ConflictsByType["working_hours"])
-
-				if currentWorkingHoursConflicts < bestWorkingHoursConflicts {
-					bestSlot = slot
-				} else if currentWorkingHoursConflicts == bestWorkingHoursConflicts {
-					// If still equal, prefer earlier time
-					if slot.TimeSlot.Start.Before(bestSlot.TimeSlot.Start) {
-						bestSlot = slot
-					}
-				}
-			}
+	for _, mapping := range attendeeCals {
+		email, id, ok := strings.Cut(mapping, "=")
+		email = strings.ToLower(strings.TrimSpace(email))
+		id = strings.TrimSpace(id)
+		if !ok || email == "" || id == "" {
+			return nil, scheduler.NewError(scheduler.KindInvalidInput, nil, "invalid --attendee-calendar %q, expected email=calendarID", mapping)
 		}
+		attendeeCalendars[email] = appendUnique(attendeeCalendars[email], id)
+	}
 
-		fmt.Printf("   Book: %s - %s\n",
-			bestSlot.TimeSlot.Start.Format("Monday, January 2 at 15:04"),
-			bestSlot.TimeSlot.End.Format("15:04"),
-		)
-
-		if bestSlot.UnavailableCount == 0 {
-			fmt.Println("   This slot has perfect attendance with all attendees available!")
-		} else {
-			fmt.Printf("   Only %.0f%% conflict rate (%d/%d unavailable)\n",
-				bestSlot.ConflictPercentage,
-				bestSlot.UnavailableCount,
-				len(availabilities),
-			)
-
-			// Show breakdown of conflicts
-			if len(bestSlot.ConflictsByType["calendar"]) > 0 {
-				fmt.Printf("   - Calendar conflicts: %d attendee(s)\n", len(bestSlot.ConflictsByType["calendar"]))
-			}
-			if len(bestSlot.ConflictsByType["working_hours"]) > 0 {
-				fmt.Printf("   - Outside working hours: %d attendee(s)\n", len(bestSlot.ConflictsByType["working_hours"]))
-			}
-			if len(bestSlot.ConflictsByType["holiday"]) > 0 {
-				fmt.Printf("   - Bank holidays: %d attendee(s)\n", len(bestSlot.ConflictsByType["holiday"]))
-			}
+	return attendeeCalendars, nil
+}
 
-			// If this matches what we showed in the GOOD OPTIONS section, mention it
-			if len(conflictGroups["low-conflicts"]) > 0 {
-				bestLowConflict := conflictGroups["low-conflicts"][0]
-				for _, slot := range conflictGroups["low-conflicts"] {
-					if slot.ConflictPercentage < bestLowConflict.ConflictPercentage {
-						bestLowConflict = slot
-					}
-				}
-				if bestSlot.TimeSlot.Start.Equal(bestLowConflict.TimeSlot.Start) &&
-					bestSlot.ConflictPercentage == bestLowConflict.ConflictPercentage {
-					fmt.Println("   (This matches the best option shown above)")
-				}
+// appendUnique appends values that are not already in the list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
 			}
 		}
+		if !found {
+			list = append(list, value)
+		}
 	}
-	fmt.Println(strings.Repeat("=", 80))
+	return list
 }
 
-// outputJSON outputs the results in JSON format
-func outputJSON(availabilities []calendar.UserAvailability, filteredSlots []optimizer.MeetingSlot,
-	allSlots []optimizer.MeetingSlot, emailList []string, startTime, endTime time.Time, loc *time.Location) {
-
-	output := JSONOutput{
-		Metadata: OutputMetadata{
-			SearchStartDate:     startTime.Format("2006-01-02"),
-			SearchEndDate:       endTime.Format("2006-01-02"),
-			MeetingDuration:     viper.GetInt("duration"),
-			TotalAttendees:      len(emailList),
-			AccessibleCalendars: len(availabilities),
-			WorkingHours:        fmt.Sprintf("%d:00 - %d:00", viper.GetInt("start_hour"), viper.GetInt("end_hour")),
-			LunchHours:          fmt.Sprintf("%d:00 - %d:00", viper.GetInt("lunch_start_hour"), viper.GetInt("lunch_end_hour")),
-			ExcludeWeekends:     viper.GetBool("exclude_weekends"),
-			MaxConflicts:        viper.GetFloat64("max_conflicts"),
-			Timezone:            loc.String(),
-		},
-	}
-
-	// Prepare timezone info
-	tzMap := make(map[string][]string)
-	for _, avail := range availabilities {
-		tzName := "Unknown"
-		if avail.TimeZone != nil {
-			tzName = avail.TimeZone.String()
+// applySnapshotParameters restores the search parameters saved in a snapshot.
+// The search range always comes from the snapshot since only that data is available;
+// other parameters can still be overridden on the command line. Snapshots saved without a
+// timezone can only be replayed with an explicit --timezone, since the local zone differs
+// from one machine to the next.
+func applySnapshotParameters(cmd *cobra.Command, params snapshot.Parameters) error {
+	if params.Timezone == "" {
+		if !cmd.Flags().Changed("timezone") {
+			return scheduler.NewError(scheduler.KindInvalidInput, nil,
+				"the snapshot does not record its timezone; pass the --timezone it was taken in to replay it")
 		}
-		tzMap[tzName] = append(tzMap[tzName], avail.Email)
-	}
-
-	output.TimezoneInfo = TimezoneInfo{
-		AttendeesByTimezone: tzMap,
-		WorkingHoursNote: fmt.Sprintf("%d:00 - %d:00 (in each attendee's local time)",
-			viper.GetInt("start_hour"), viper.GetInt("end_hour")),
+		params.Timezone = viper.GetString("timezone")
 	}
-
-	// Group slots by conflict level
-	conflictGroups := optimizer.GroupSlotsByConflictLevel(filteredSlots)
-
-	// Prepare summary
-	output.Summary = Summary{
-		TotalSlotsFound:     len(filteredSlots),
-		PerfectSlots:        len(conflictGroups["no-conflicts"]),
-		LowConflictSlots:    len(conflictGroups["low-conflicts"]),
-		MediumConflictSlots: len(conflictGroups["med-conflicts"]),
-	}
-
-	// Prepare best options
-	output.BestOptions = BestOptions{
-		PerfectSlots: []TimeSlotSummary{},
-		GoodOptions:  []TimeSlotSummary{},
-	}
-
-	// Add perfect slots (up to 5)
-	maxPerfect := 5
-	if len(conflictGroups["no-conflicts"]) < maxPerfect {
-		maxPerfect = len(conflictGroups["no-conflicts"])
-	}
-	for i := 0; i < maxPerfect; i++ {
-		slot := conflictGroups["no-conflicts"][i]
-		output.BestOptions.PerfectSlots = append(output.BestOptions.PerfectSlots, TimeSlotSummary{
-			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
-			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
-			ConflictPercentage: slot.ConflictPercentage,
-			ConflictCount:      slot.UnavailableCount,
-		})
+	for flag, value := range map[string]string{"start": params.Start, "end": params.End, "timezone": params.Timezone} {
+		if cmd.Flags().Changed(flag) && viper.GetString(flag) != value {
+			log.Warn().Str("flag", flag).Str("snapshot_value", value).Msg("Ignoring flag, using the snapshot search range")
+		}
+		viper.Set(flag, value)
 	}
 
-	// Add good options (up to 5)
-	maxGood := 5
-	if len(conflictGroups["low-conflicts"]) < maxGood {
-		maxGood = len(conflictGroups["low-conflicts"])
-	}
-	for i := 0; i < maxGood; i++ {
-		slot := conflictGroups["low-conflicts"][i]
-		output.BestOptions.GoodOptions = append(output.BestOptions.GoodOptions, TimeSlotSummary{
-			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
-			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
-			ConflictPercentage: slot.ConflictPercentage,
-			ConflictCount:      slot.UnavailableCount,
-		})
+	setUnlessChanged := func(flag, key string, value interface{}) {
+		if !cmd.Flags().Changed(flag) {
+			viper.Set(key, value)
+		}
 	}
+	setUnlessChanged("duration", "duration", params.Duration)
+	setUnlessChanged("start-hour", "start_hour", params.StartHour)
+	setUnlessChanged("end-hour", "end_hour", params.EndHour)
+	setUnlessChanged("lunch-start-hour", "lunch_start_hour", params.LunchStartHour)
+	setUnlessChanged("lunch-end-hour", "lunch_end_hour", params.LunchEndHour)
+	setUnlessChanged("exclude-weekends", "exclude_weekends", params.ExcludeWeekends)
+	setUnlessChanged("max-slots", "max_slots", params.MaxSlots)
+	setUnlessChanged("max-conflicts", "max_conflicts", params.MaxConflicts)
+	return nil
+}
 
-	// Prepare daily summary
-	grouped := optimizer.GroupSlotsByDay(filteredSlots)
-	var days []string
-	for day := range grouped {
-		days = append(days, day)
+// localZoneName returns the IANA name of time.Local: the TZ variable when set, else the
+// zone /etc/localtime links to or /etc/timezone names. It reports false rather than a
+// fixed offset, which would shift working hours when a replayed range crosses a DST change.
+func localZoneName() (string, bool) {
+	if tz, set := os.LookupEnv("TZ"); set {
+		tz = strings.TrimPrefix(tz, ":")
+		if tz == "" {
+			return "UTC", true
+		}
+		if _, err := time.LoadLocation(tz); err == nil && !filepath.IsAbs(tz) {
+			return tz, true
+		}
 	}
-	sort.Strings(days)
-
-	for _, day := range days {
-		slots := grouped[day]
-		bestConflict, avgConflict, perfectCount, _ := optimizer.GetDaySummaryStats(slots)
-
-		// Find earliest and latest slots
-		earliest := slots[0].TimeSlot.Start
-		latest := slots[0].TimeSlot.End
-		for _, s := range slots {
-			if s.TimeSlot.Start.Before(earliest) {
-				earliest = s.TimeSlot.Start
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, found := strings.Cut(target, "zoneinfo/"); found {
+			if _, err := time.LoadLocation(name); err == nil {
+				return name, true
 			}
-			if s.TimeSlot.End.After(latest) {
-				latest = s.TimeSlot.End
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		// Without /etc/localtime, Go uses UTC
+		return "UTC", true
+	}
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			if _, err := time.LoadLocation(name); err == nil {
+				return name, true
 			}
 		}
-
-		output.DailySummary = append(output.DailySummary, DailySummary{
-			Date:             day,
-			TotalSlots:       len(slots),
-			PerfectSlots:     perfectCount,
-			BestConflict:     bestConflict,
-			AverageConflict:  avgConflict,
-			EarliestSlotTime: earliest.Format("15:04"),
-			LatestSlotTime:   latest.Format("15:04"),
-		})
 	}
+	return "", false
+}
 
-	// Prepare detailed slots
-	for _, slot := range filteredSlots {
-		output.DetailedSlots = append(output.DetailedSlots, DetailedTimeSlot{
-			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
-			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
-			ConflictPercentage: slot.ConflictPercentage,
-			UnavailableCount:   slot.UnavailableCount,
-			UnavailableEmails:  slot.UnavailableEmails,
-			AvailableEmails:    slot.AvailableEmails,
-			TimeZoneScore:      slot.TimeZoneScore,
-			ConflictsByType:    slot.ConflictsByType,
-			HolidayConflicts:   slot.HolidayConflicts,
-		})
+// currentSnapshotParameters captures the search parameters in effect for this run
+func currentSnapshotParameters(loc *time.Location) snapshot.Parameters {
+	tzName := viper.GetString("timezone")
+	if tzName == "" && loc != time.Local {
+		tzName = loc.String()
 	}
-
-	// Find the best recommendation
-	if len(filteredSlots) > 0 {
-		bestSlot := filteredSlots[0]
-		for _, slot := range filteredSlots {
-			if slot.ConflictPercentage < bestSlot.ConflictPercentage {
-				bestSlot = slot
-			} else if slot.ConflictPercentage == bestSlot.ConflictPercentage {
-				currentWorkingHoursConflicts := len(slot.ConflictsByType["working_hours"])
-				bestWorkingHoursConflicts := len(bestSlot.ConflictsByType["working_hours"])
-
-				if currentWorkingHoursConflicts < bestWorkingHoursConflicts {
-					bestSlot = slot
-				} else if currentWorkingHoursConflicts == bestWorkingHoursConflicts {
-					if slot.TimeSlot.Start.Before(bestSlot.TimeSlot.Start) {
-						bestSlot = slot
-					}
-				}
-			}
-		}
-
-		reason := "Best overall slot with lowest conflicts"
-		if bestSlot.UnavailableCount == 0 {
-			reason = "Perfect slot with all attendees available"
-		} else if bestSlot.ConflictPercentage <= 25 {
-			reason = "Good slot with minimal conflicts"
-		}
-
-		output.Recommendation = &RecommendationSlot{
-			StartTime:             bestSlot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
-			EndTime:               bestSlot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
-			ConflictPercentage:    bestSlot.ConflictPercentage,
-			UnavailableCount:      bestSlot.UnavailableCount,
-			CalendarConflicts:     len(bestSlot.ConflictsByType["calendar"]),
-			WorkingHoursConflicts: len(bestSlot.ConflictsByType["working_hours"]),
-			HolidayConflicts:      len(bestSlot.ConflictsByType["holiday"]),
-			Reason:                reason,
+	if tzName == "" {
+		var ok bool
+		if tzName, ok = localZoneName(); !ok {
+			log.Warn().Msg("Could not determine the local IANA timezone; replaying the snapshot will need --timezone")
 		}
 	}
 
-	// Marshal and output JSON
-	jsonData, err := json.MarshalIndent(output, "", "  ")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to marshal JSON output")
+	return snapshot.Parameters{
+		Start:           viper.GetString("start"),
+		End:             viper.GetString("end"),
+		Timezone:        tzName,
+		Duration:        viper.GetInt("duration"),
+		StartHour:       viper.GetInt("start_hour"),
+		EndHour:         viper.GetInt("end_hour"),
+		LunchStartHour:  viper.GetInt("lunch_start_hour"),
+		LunchEndHour:    viper.GetInt("lunch_end_hour"),
+		ExcludeWeekends: viper.GetBool("exclude_weekends"),
+		MaxSlots:        viper.GetInt("max_slots"),
+		MaxConflicts:    viper.GetFloat64("max_conflicts"),
 	}
-	fmt.Println(string(jsonData))
 }
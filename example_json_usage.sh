@@ -1,5 +1,6 @@
 #!/bin/bash
 # Example script showing how to use the JSON output feature
+# Logs and warnings go to stderr, so stdout can be piped straight into jq
 
 echo "Example 1: Get the recommended meeting time"
 echo "============================================"
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// revokeURL is Google's OAuth token revocation endpoint
+var revokeURL = "https://oauth2.googleapis.com/revoke"
+
+// ErrNotLoggedIn is returned when no OAuth token is stored
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// Status describes the credentials the tool would use
+type Status struct {
+	CredentialsType string    // One of the Credentials* constants, or "application_default"
+	TokenLocation   string    // Where the OAuth token is stored (OAuth client credentials only)
+	LoggedIn        bool      // A token is available
+	Account         string    // Authorized user, impersonated subject or service account email
+	Scopes          []string  // Granted (OAuth) or requested (service account, ADC) scopes
+	Expiry          time.Time // Access token expiry; zero when unknown
+	RefreshToken    bool      // The stored token can be refreshed without a browser
+}
+
+// oauthConfig reads opts.CredentialsFile, which must be an OAuth client secret
+func oauthConfig(opts Options, scopes []string) (*oauth2.Config, error) {
+	b, err := os.ReadFile(opts.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials file: %w", err)
+	}
+	credType, err := DetectCredentialsType(b)
+	if err != nil {
+		return nil, err
+	}
+	if credType != CredentialsOAuthClient {
+		return nil, fmt.Errorf("%s credentials don't use an interactive login", credType)
+	}
+	config, err := google.ConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
+	}
+	return config, nil
+}
+
+// Login runs the browser flow and stores the token, even when one already exists.
+// Scopes granted earlier are requested again so an upgrade is not lost.
+func Login(ctx context.Context, opts Options) (*StoredToken, error) {
+	store, err := NewTokenStore(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := opts.requiredScopes()
+	if existing, err := loadTokenFromStore(store, opts.plainTokenFiles()); err == nil {
+		scopes = mergeScopes(existing.Scopes, scopes)
+	}
+
+	config, err := oauthConfig(opts, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return authorize(ctx, config, opts.Flow, scopes, store)
+}
+
+// Logout revokes the stored token with Google and deletes it. The file is deleted
+// even when revocation fails, e.g. because the token had already expired.
+func Logout(ctx context.Context, opts Options) error {
+	store, err := NewTokenStore(opts)
+	if err != nil {
+		return err
+	}
+	stored, err := loadTokenFromStore(store, opts.plainTokenFiles())
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotLoggedIn
+	}
+	if err != nil {
+		return err
+	}
+
+	if revokeErr := revokeToken(ctx, stored); revokeErr != nil {
+		log.Warn().Err(revokeErr).Msg("Could not revoke token; deleting it locally anyway")
+	}
+
+	if err := store.Delete(); err != nil {
+		return fmt.Errorf("unable to delete stored token: %w", err)
+	}
+	log.Info().Str("location", store.Location()).Msg("Deleted stored token")
+	return nil
+}
+
+// revokeToken asks Google to revoke the token; revoking the refresh token also revokes its access tokens
+func revokeToken(ctx context.Context, stored *StoredToken) error {
+	token := stored.RefreshToken
+	if token == "" {
+		token = stored.AccessToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revokeURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revocation failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+// GetStatus reports the credentials selected by opts without starting a browser flow.
+// The account is looked up with the Calendar API when a token is available.
+func GetStatus(ctx context.Context, opts Options) (*Status, error) {
+	if opts.UseADC {
+		return adcStatus(ctx, opts)
+	}
+
+	b, err := os.ReadFile(opts.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials file: %w", err)
+	}
+	credType, err := DetectCredentialsType(b)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{CredentialsType: credType}
+
+	switch credType {
+	case CredentialsOAuthClient:
+		return oauthStatus(ctx, opts, status)
+
+	case CredentialsServiceAccount:
+		config, err := google.JWTConfigFromJSON(b, opts.requiredScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account key: %w", err)
+		}
+		config.Subject = opts.Subject
+		status.Account = config.Email
+		if opts.Subject != "" {
+			status.Account = opts.Subject
+		}
+		status.Scopes = opts.requiredScopes()
+		tok, err := config.TokenSource(ctx).Token()
+		if err != nil {
+			return status, fmt.Errorf("unable to obtain a service account token: %w", err)
+		}
+		status.LoggedIn, status.Expiry = true, tok.Expiry
+		return status, nil
+
+	default:
+		creds, err := google.CredentialsFromJSONWithParams(ctx, b, google.CredentialsParams{Scopes: opts.requiredScopes(), Subject: opts.Subject})
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %s credentials: %w", credType, err)
+		}
+		return tokenSourceStatus(ctx, status, creds.TokenSource, opts.requiredScopes())
+	}
+}
+
+// oauthStatus describes the stored OAuth token, refreshing it to check it still works
+func oauthStatus(ctx context.Context, opts Options, status *Status) (*Status, error) {
+	store, err := NewTokenStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	status.TokenLocation = store.Location()
+
+	stored, err := loadTokenFromStore(store, opts.plainTokenFiles())
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := oauthConfig(opts, stored.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	status.Scopes = stored.Scopes
+	status.RefreshToken = stored.RefreshToken != ""
+	return tokenSourceStatus(ctx, status, newTokenSource(ctx, config, stored, store), stored.Scopes)
+}
+
+// adcStatus describes Application Default Credentials
+func adcStatus(ctx context.Context, opts Options) (*Status, error) {
+	creds, err := google.FindDefaultCredentialsWithParams(ctx, google.CredentialsParams{Scopes: opts.requiredScopes(), Subject: opts.Subject})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find application default credentials: %w", err)
+	}
+	status := &Status{CredentialsType: "application_default", Account: opts.Subject}
+	if status.Account == "" && len(creds.JSON) > 0 {
+		var key struct {
+			ClientEmail string `json:"client_email"`
+		}
+		if json.Unmarshal(creds.JSON, &key) == nil {
+			status.Account = key.ClientEmail
+		}
+	}
+	return tokenSourceStatus(ctx, status, creds.TokenSource, opts.requiredScopes())
+}
+
+// tokenSourceStatus fetches a token from source and, when the account is unknown,
+// asks the Calendar API for the primary calendar ID, which is the user's email
+func tokenSourceStatus(ctx context.Context, status *Status, source oauth2.TokenSource, scopes []string) (*Status, error) {
+	if len(status.Scopes) == 0 {
+		status.Scopes = scopes
+	}
+	tok, err := source.Token()
+	if err != nil {
+		return status, fmt.Errorf("unable to obtain an access token: %w", err)
+	}
+	status.LoggedIn, status.Expiry = true, tok.Expiry
+
+	if status.Account == "" {
+		srv, err := calendar.NewService(ctx, option.WithTokenSource(source))
+		if err == nil {
+			var primary *calendar.CalendarListEntry
+			primary, err = srv.CalendarList.Get("primary").Context(ctx).Do()
+			if err == nil {
+				status.Account = primary.Id
+			}
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("Could not look up the authorized account")
+		}
+	}
+	return status, nil
+}
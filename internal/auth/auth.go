@@ -3,15 +3,17 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/logger"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -20,28 +22,100 @@ import (
 	"google.golang.org/api/option"
 )
 
-// GetClient retrieves a token, saves the token, then returns the generated client.
-func GetClient(config *oauth2.Config) *http.Client {
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
+// GetClient returns a client authorized by the token stored for opts, running the
+// browser flow when there is no token yet or it lacks a required scope.
+// The context bounds the authorization flow and any later token refreshes.
+func GetClient(ctx context.Context, config *oauth2.Config, opts Options) (*http.Client, error) {
+	store, err := NewTokenStore(opts)
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		return nil, err
+	}
+
+	required := opts.requiredScopes()
+	stored, err := loadTokenFromStore(store, opts.plainTokenFiles())
+	switch {
+	case err != nil:
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Msg("Ignoring unreadable stored token")
+		}
+		stored, err = authorize(ctx, config, opts.Flow, required, store)
+	case !stored.HasScopes(required):
+		// Incremental authorization: keep what was granted and ask only for the rest
+		log.Info().Strs("missing_scopes", missingScopes(stored.Scopes, required)).Msg("Requesting additional permissions")
+		stored, err = authorize(ctx, config, opts.Flow, mergeScopes(stored.Scopes, required), store)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, newTokenSource(ctx, config, stored, store)), nil
+}
+
+// authorize runs the selected authorization flow for scopes and saves the resulting token to store
+func authorize(ctx context.Context, config *oauth2.Config, flow string, scopes []string, store TokenStore) (*StoredToken, error) {
+	config.Scopes = scopes
+	tok, err := getTokenFromWeb(ctx, config, flow)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StoredToken{Token: *tok, Scopes: grantedScopes(tok, scopes)}
+	if err := store.Save(stored); err != nil {
+		return nil, err
 	}
-	return config.Client(context.Background(), tok)
+	return stored, nil
 }
 
-// Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	tok, err := getTokenFromWebWithLocalServer(config)
+// grantedScopes returns the scopes reported in the token response, or the requested ones
+func grantedScopes(tok *oauth2.Token, requested []string) []string {
+	if granted, ok := tok.Extra("scope").(string); ok && granted != "" {
+		return mergeScopes(strings.Fields(granted))
+	}
+	return mergeScopes(requested)
+}
+
+// Request a token from the web with the selected flow, then returns the retrieved token.
+// FlowAuto uses the browser when a display is available and the device flow otherwise,
+// falling back to the manual copy-paste flow if either fails.
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config, flow string) (*oauth2.Token, error) {
+	var tok *oauth2.Token
+	var err error
+	switch flow {
+	case FlowBrowser:
+		return getTokenFromWebWithLocalServer(ctx, config)
+	case FlowDevice:
+		return getTokenFromDevice(ctx, config)
+	case FlowManual:
+		return getTokenFromCLI(ctx, config)
+	case FlowAuto, "":
+		if hasDisplay() {
+			tok, err = getTokenFromWebWithLocalServer(ctx, config)
+		} else {
+			log.Debug().Msg("No display available, using the device authorization flow")
+			tok, err = getTokenFromDevice(ctx, config)
+		}
+	default:
+		return nil, fmt.Errorf("unknown authorization flow %q (expected auto, browser, device or manual)", flow)
+	}
+
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		log.Warn().Err(err).Msg("Falling back to manual OAuth flow")
-		return getTokenFromCLI(config)
+		return getTokenFromCLI(ctx, config)
 	}
-	return tok
+	return tok, nil
 }
 
-func getTokenFromWebWithLocalServer(config *oauth2.Config) (*oauth2.Token, error) {
+// getTokenFromWebWithLocalServer runs the authorization code flow with PKCE, receiving
+// the code on a short-lived local callback server
+func getTokenFromWebWithLocalServer(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	state, err := newState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
 	listener, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		return nil, fmt.Errorf("unable to start local callback server: %w", err)
@@ -52,73 +126,46 @@ func getTokenFromWebWithLocalServer(config *oauth2.Config) (*oauth2.Token, error
 	redirectURL := fmt.Sprintf("http://localhost:%d/", port)
 	config.RedirectURL = redirectURL
 
-	state := fmt.Sprintf("state-token-%d", time.Now().UnixNano())
-	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
-
-	fmt.Printf("\nOpening browser for Google authorization...\nIf it does not open automatically, please visit:\n%v\n\n", authURL)
-	openBrowser(authURL)
-
-	codeCh := make(chan string, 1)
-	errCh := make(chan error, 1)
-
-	srv := &http.Server{}
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-
-		if e := query.Get("error"); e != "" {
-			message := fmt.Sprintf("Authorization failed: %s", e)
-			http.Error(w, message, http.StatusBadRequest)
-			select {
-			case errCh <- fmt.Errorf("%s", message):
-			default:
-			}
-			return
-		}
-
-		if query.Get("state") != state {
-			http.Error(w, "Invalid state parameter", http.StatusBadRequest)
-			return
-		}
-
-		code := query.Get("code")
-		if code == "" {
-			http.Error(w, "Missing authorization code", http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprintln(w, "<html><body><h1>Authentication complete</h1><p>You can close this tab and return to the terminal.</p></body></html>")
-
-		select {
-		case codeCh <- code:
-		default:
-		}
-	})
-	srv.Handler = mux
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"))
 
+	handler := newCallbackHandler(state)
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
 	go func() {
 		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
-			errCh <- err
+			serveErr <- err
+		}
+	}()
+	defer func() {
+		// Let the browser receive the result page before closing
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Warn().Err(shutdownErr).Msg("Failed to cleanly shutdown OAuth callback server")
 		}
 	}()
 
-	var authCode string
+	logger.Printf("\nOpening browser for Google authorization...\nIf it does not open automatically, please visit:\n%v\n\n", authURL)
+	browserOpener(authURL)
+
+	var result callbackResult
 	select {
-	case authCode = <-codeCh:
-	case err := <-errCh:
+	case result = <-handler.result:
+	case err := <-serveErr:
 		return nil, err
-	case <-time.After(2 * time.Minute):
-		return nil, fmt.Errorf("timed out waiting for authorization response")
+	case <-time.After(callbackTimeout):
+		return nil, fmt.Errorf("timed out after %s waiting for authorization response", callbackTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if shutdownErr := srv.Shutdown(ctx); shutdownErr != nil {
-		log.Warn().Err(shutdownErr).Msg("Failed to cleanly shutdown OAuth callback server")
+	if result.err != nil {
+		return nil, result.err
 	}
 
-	tok, err := config.Exchange(context.Background(), authCode)
+	tok, err := config.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve token from web: %w", err)
 	}
@@ -126,44 +173,32 @@ func getTokenFromWebWithLocalServer(config *oauth2.Config) (*oauth2.Token, error
 	return tok, nil
 }
 
-func getTokenFromCLI(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
+func getTokenFromCLI(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	state, err := newState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	logger.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatal().Err(err).Msg("Unable to read authorization code")
-	}
-
-	tok, err := config.Exchange(context.TODO(), authCode)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Unable to retrieve token from web")
+		return nil, fmt.Errorf("unable to read authorization code: %w", err)
 	}
-	return tok
-}
 
-// Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+	tok, err := config.Exchange(ctx, authCode, oauth2.VerifierOption(verifier))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to retrieve token from web: %w", err)
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	return tok, nil
 }
 
-// Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	log.Info().Str("path", path).Msg("Saving credential file")
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatal().Err(err).Str("path", path).Msg("Unable to cache oauth token")
-	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
-}
+// browserOpener opens authorization URLs; tests replace it to follow the redirect themselves
+var browserOpener = openBrowser
 
 func openBrowser(url string) {
 	var cmd *exec.Cmd
@@ -186,22 +221,139 @@ func openBrowser(url string) {
 	}
 }
 
-// GetCalendarService creates and returns a Google Calendar service
-func GetCalendarService(credentialsFile string) (*calendar.Service, error) {
-	b, err := ioutil.ReadFile(credentialsFile)
+// Scopes requested for every credential type
+var Scopes = []string{
+	calendar.CalendarReadonlyScope,
+	directory.AdminDirectoryGroupMemberReadonlyScope,
+	directory.AdminDirectoryGroupReadonlyScope,
+}
+
+// UserScopes are needed on top of Scopes to look up users' primary addresses
+var UserScopes = []string{directory.AdminDirectoryUserReadonlyScope}
+
+// Credential types detected from a credentials JSON file. All but CredentialsOAuthClient
+// match the file's "type" field.
+const (
+	CredentialsOAuthClient      = "oauth_client"    // Installed-app or web client secret (interactive flow)
+	CredentialsServiceAccount   = "service_account" // Service account key, optionally with domain-wide delegation
+	CredentialsAuthorizedUser   = "authorized_user" // User credentials written by gcloud
+	CredentialsExternalAccount  = "external_account"
+	CredentialsImpersonatedUser = "impersonated_service_account"
+)
+
+// Authorization flows for OAuth client credentials
+const (
+	FlowAuto    = "auto"    // Browser when a display is available, device flow otherwise
+	FlowBrowser = "browser" // Local callback server and the system browser
+	FlowDevice  = "device"  // Verification URL and user code, completed on any other device
+	FlowManual  = "manual"  // Paste the authorization code into the terminal
+)
+
+// Options selects the credentials used to call Google APIs
+type Options struct {
+	CredentialsFile string // OAuth client secret, service account key or other Google credentials JSON
+	Subject         string // User a service account impersonates through domain-wide delegation
+	UseADC          bool   // Use Application Default Credentials instead of CredentialsFile
+	Profile         string // Named account whose token is kept apart from the others
+	Flow            string // How OAuth clients are authorized: one of the Flow* constants (default FlowAuto)
+	TokenFile       string // Where file-based stores keep the token (default: DefaultTokenFile(Profile))
+	TokenStorage    string // One of the Storage* constants (default StorageFile)
+
+	// Passphrase returns the passphrase for StorageEncrypted; it is called at most once
+	Passphrase func() (string, error)
+	Scopes     []string // Scopes needed on top of the default read-only Scopes, e.g. WriteScopes
+}
+
+// DetectCredentialsType returns the kind of Google credentials stored in data
+func DetectCredentialsType(data []byte) (string, error) {
+	var file struct {
+		Type      string          `json:"type"`
+		Installed json.RawMessage `json:"installed"`
+		Web       json.RawMessage `json:"web"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", fmt.Errorf("unable to parse credentials file: %w", err)
+	}
+
+	switch {
+	case len(file.Installed) > 0 || len(file.Web) > 0:
+		return CredentialsOAuthClient, nil
+	case file.Type != "":
+		return file.Type, nil
+	default:
+		return "", fmt.Errorf("unrecognized credentials file: expected an OAuth client secret or a credentials file with a \"type\" field")
+	}
+}
+
+// NewHTTPClient returns an authorized HTTP client for the credentials selected by opts
+func NewHTTPClient(ctx context.Context, opts Options) (*http.Client, error) {
+	if opts.UseADC {
+		creds, err := google.FindDefaultCredentialsWithParams(ctx, google.CredentialsParams{Scopes: opts.requiredScopes(), Subject: opts.Subject})
+		if err != nil {
+			return nil, fmt.Errorf("unable to find application default credentials: %w", err)
+		}
+		log.Debug().Str("subject", opts.Subject).Msg("Using application default credentials")
+		return oauth2.NewClient(ctx, creds.TokenSource), nil
+	}
+
+	b, err := os.ReadFile(opts.CredentialsFile)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+		return nil, fmt.Errorf("unable to read credentials file: %w", err)
 	}
 
-	// If modifying these scopes, delete your previously saved token.json.
-	// We need both calendar.readonly and directory.group.member.readonly scopes
-	config, err := google.ConfigFromJSON(b, calendar.CalendarReadonlyScope, directory.AdminDirectoryGroupMemberReadonlyScope, directory.AdminDirectoryGroupReadonlyScope)
+	credType, err := DetectCredentialsType(b)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+		return nil, err
 	}
-	client := GetClient(config)
+	log.Debug().Str("path", opts.CredentialsFile).Str("type", credType).Msg("Detected credentials type")
 
-	srv, err := calendar.NewService(context.Background(), option.WithHTTPClient(client))
+	switch credType {
+	case CredentialsOAuthClient:
+		if opts.Subject != "" {
+			log.Warn().Msg("Ignoring subject: impersonation requires a service account key")
+		}
+		config, err := google.ConfigFromJSON(b, opts.requiredScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
+		}
+		return GetClient(ctx, config, opts)
+
+	case CredentialsServiceAccount:
+		config, err := google.JWTConfigFromJSON(b, opts.requiredScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse service account key: %w", err)
+		}
+		if opts.Subject == "" {
+			log.Warn().Msg("Service account used without a subject: only calendars shared with it are visible and mailing lists cannot be resolved")
+		}
+		config.Subject = opts.Subject
+		return config.Client(ctx), nil
+
+	case CredentialsAuthorizedUser, CredentialsExternalAccount, CredentialsImpersonatedUser:
+		creds, err := google.CredentialsFromJSONWithParams(ctx, b, google.CredentialsParams{Scopes: opts.requiredScopes(), Subject: opts.Subject})
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %s credentials: %w", credType, err)
+		}
+		return oauth2.NewClient(ctx, creds.TokenSource), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %q", credType)
+	}
+}
+
+// GetCalendarService creates and returns a Google Calendar service
+func GetCalendarService(ctx context.Context, credentialsFile string) (*calendar.Service, error) {
+	return GetCalendarServiceWithOptions(ctx, Options{CredentialsFile: credentialsFile})
+}
+
+// GetCalendarServiceWithOptions creates a Google Calendar service using the credentials selected by opts
+func GetCalendarServiceWithOptions(ctx context.Context, opts Options) (*calendar.Service, error) {
+	client, err := NewHTTPClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
 	}
@@ -210,21 +362,19 @@ func GetCalendarService(credentialsFile string) (*calendar.Service, error) {
 }
 
 // GetDirectoryService creates and returns a Google Directory service
-func GetDirectoryService(credentialsFile string) (*directory.Service, error) {
-	b, err := ioutil.ReadFile(credentialsFile)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read client secret file: %v", err)
-	}
+func GetDirectoryService(ctx context.Context, credentialsFile string) (*directory.Service, error) {
+	return GetDirectoryServiceWithOptions(ctx, Options{CredentialsFile: credentialsFile})
+}
 
-	// If modifying these scopes, delete your previously saved token.json.
-	// We need both calendar.readonly and directory.group.member.readonly scopes
-	config, err := google.ConfigFromJSON(b, calendar.CalendarReadonlyScope, directory.AdminDirectoryGroupMemberReadonlyScope, directory.AdminDirectoryGroupReadonlyScope)
+// GetDirectoryServiceWithOptions creates a Google Directory service using the credentials selected by opts.
+// Service accounts need a Subject with admin rights on the groups to read their members.
+func GetDirectoryServiceWithOptions(ctx context.Context, opts Options) (*directory.Service, error) {
+	client, err := NewHTTPClient(ctx, opts)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file to config: %v", err)
+		return nil, err
 	}
-	client := GetClient(config)
 
-	srv, err := directory.NewService(context.Background(), option.WithHTTPClient(client))
+	srv, err := directory.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve Directory client: %v", err)
 	}
@@ -0,0 +1,495 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+func TestDetectCredentialsType(t *testing.T) {
+	cases := map[string]string{
+		`{"installed": {"client_id": "id"}}`:              CredentialsOAuthClient,
+		`{"web": {"client_id": "id"}}`:                    CredentialsOAuthClient,
+		`{"type": "service_account", "client_email": ""}`: CredentialsServiceAccount,
+		`{"type": "authorized_user"}`:                     CredentialsAuthorizedUser,
+	}
+	for data, want := range cases {
+		got, err := DetectCredentialsType([]byte(data))
+		if err != nil || got != want {
+			t.Fatalf("DetectCredentialsType(%s) = %q, %v; want %q", data, got, err, want)
+		}
+	}
+
+	if _, err := DetectCredentialsType([]byte(`{"client_id": "id"}`)); err == nil {
+		t.Fatalf("expected an error for a file without a type")
+	}
+}
+
+func TestServiceAccountImpersonatesSubject(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	// Stub token endpoint that records the JWT assertion's claims
+	var claims map[string]interface{}
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Errorf("unexpected assertion %q", r.FormValue("assertion"))
+		} else if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+			t.Errorf("decode assertion: %v", err)
+		} else if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Errorf("unmarshal claims: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "sa-token", "token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer tokenServer.Close()
+
+	var authorization string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer apiServer.Close()
+
+	keyFile, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "scheduler@project.iam.gserviceaccount.com",
+		"private_key_id": "key-id",
+		"private_key":    string(keyPEM),
+		"token_uri":      tokenServer.URL,
+	})
+	if err != nil {
+		t.Fatalf("marshal key file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(path, keyFile, 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+
+	client, err := NewHTTPClient(context.Background(), Options{CredentialsFile: path, Subject: "admin@example.com"})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	resp, err := client.Get(apiServer.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	if authorization != "Bearer sa-token" {
+		t.Fatalf("unexpected Authorization header %q", authorization)
+	}
+	if claims["sub"] != "admin@example.com" || claims["iss"] != "scheduler@project.iam.gserviceaccount.com" {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+	if scope, _ := claims["scope"].(string); !strings.Contains(scope, "calendar.readonly") {
+		t.Fatalf("expected calendar scope, got %q", scope)
+	}
+}
+
+func TestLegacyTokenMovesToConfigDirectory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(legacyTokenFile, []byte(`{"access_token": "legacy", "refresh_token": "refresh"}`), 0o600); err != nil {
+		t.Fatalf("write legacy token: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config", "token.json")
+	stored, err := loadTokenFromStore(&fileStore{path: path}, []string{path, legacyTokenFile})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if stored.AccessToken != "legacy" || !stored.HasScopes(Scopes) {
+		t.Fatalf("unexpected token %+v", stored)
+	}
+	if _, err := os.Stat(legacyTokenFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the legacy token to be removed, got %v", err)
+	}
+	if moved, err := LoadToken(path); err != nil || moved.RefreshToken != "refresh" {
+		t.Fatalf("expected the token at %s, got %+v, %v", path, moved, err)
+	}
+}
+
+func TestStoredTokenScopeUpgrade(t *testing.T) {
+	stored := &StoredToken{Scopes: mergeScopes(Scopes)}
+	required := Options{Scopes: WriteScopes}.requiredScopes()
+
+	if stored.HasScopes(required) {
+		t.Fatalf("read-only token should not satisfy write scopes")
+	}
+	if missing := missingScopes(stored.Scopes, required); len(missing) != 1 || missing[0] != WriteScopes[0] {
+		t.Fatalf("unexpected missing scopes %v", missing)
+	}
+	if upgraded := mergeScopes(stored.Scopes, required); len(upgraded) != len(Scopes)+1 {
+		t.Fatalf("unexpected upgraded scopes %v", upgraded)
+	}
+}
+
+func TestLogoutRevokesAndDeletesToken(t *testing.T) {
+	var revoked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+	}))
+	defer server.Close()
+	defer func(original string) { revokeURL = original }(revokeURL)
+	revokeURL = server.URL
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := SaveToken(path, &StoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	opts := Options{TokenFile: path}
+	if err := Logout(context.Background(), opts); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if revoked != "refresh" {
+		t.Fatalf("expected the refresh token to be revoked, got %q", revoked)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the token file to be deleted, got %v", err)
+	}
+	if err := Logout(context.Background(), opts); err != ErrNotLoggedIn {
+		t.Fatalf("expected ErrNotLoggedIn, got %v", err)
+	}
+}
+
+func TestRefreshedTokenIsSaved(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" {
+			t.Errorf("unexpected token request %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "fresh", "token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+	stored := &StoredToken{
+		Token:  oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)},
+		Scopes: mergeScopes(Scopes),
+	}
+	if err := SaveToken(path, stored); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	config := &oauth2.Config{ClientID: "id", Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+	tok, err := newTokenSource(context.Background(), config, stored, &fileStore{path: path}).Token()
+	if err != nil || tok.AccessToken != "fresh" {
+		t.Fatalf("unexpected token %+v, %v", tok, err)
+	}
+
+	saved, err := LoadToken(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if saved.AccessToken != "fresh" || saved.RefreshToken != "refresh" || !saved.HasScopes(Scopes) {
+		t.Fatalf("refresh was not persisted: %+v", saved)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("unexpected token file mode: %v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the token file, got %v", entries)
+	}
+}
+
+func TestProfilesUseSeparateTokenFiles(t *testing.T) {
+	defaultPath, err := DefaultTokenFile("")
+	if err != nil {
+		t.Fatalf("default: %v", err)
+	}
+	profilePath, err := Options{Profile: "work-eu"}.tokenFile()
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if profilePath == defaultPath || filepath.Base(filepath.Dir(profilePath)) != "work-eu" {
+		t.Fatalf("unexpected profile token file %s (default %s)", profilePath, defaultPath)
+	}
+
+	for _, name := range []string{"../work", "a/b", ".."} {
+		if _, err := DefaultTokenFile(name); err == nil {
+			t.Fatalf("expected profile name %q to be rejected", name)
+		}
+	}
+}
+
+func TestDeviceFlowPollsForToken(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "id" || !strings.Contains(r.FormValue("scope"), "calendar.readonly") {
+			t.Errorf("unexpected device request %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// Google spells the field verification_url
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code": "device-code", "user_code": "ABCD-EFGH",
+			"verification_url": "https://www.google.com/device", "expires_in": 60, "interval": 1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("device_code") != "device-code" {
+			t.Errorf("unexpected token request %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if polls++; polls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "device-token", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "id",
+		Scopes:   Scopes,
+		Endpoint: oauth2.Endpoint{DeviceAuthURL: server.URL + "/device", TokenURL: server.URL + "/token", AuthStyle: oauth2.AuthStyleInParams},
+	}
+	tok, err := getTokenFromWeb(context.Background(), config, FlowDevice)
+	if err != nil {
+		t.Fatalf("device flow: %v", err)
+	}
+	if tok.AccessToken != "device-token" || tok.RefreshToken != "refresh" || polls != 2 {
+		t.Fatalf("unexpected token %+v after %d polls", tok, polls)
+	}
+}
+
+func TestSSHSessionHasNoDisplay(t *testing.T) {
+	t.Setenv("SSH_CONNECTION", "10.0.0.1 50000 10.0.0.2 22")
+	t.Setenv("DISPLAY", ":0")
+	if hasDisplay() {
+		t.Fatalf("expected an SSH session to use the device flow")
+	}
+}
+
+func TestLocalServerFlowUsesPKCE(t *testing.T) {
+	var challenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || len(query.Get("state")) < 32 {
+			t.Errorf("unexpected authorization request %v", query)
+		}
+		challenge = query.Get("code_challenge")
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code=auth-code&state="+query.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "auth-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			t.Errorf("verifier does not match the challenge: %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "pkce-token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Play the browser: follow the redirect back to the local callback server
+	page := make(chan string, 1)
+	defer func(original func(string)) { browserOpener = original }(browserOpener)
+	browserOpener = func(authURL string) {
+		go func() {
+			resp, err := http.Get(authURL)
+			if err != nil {
+				page <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			page <- string(body)
+		}()
+	}
+
+	config := &oauth2.Config{
+		ClientID: "id",
+		Endpoint: oauth2.Endpoint{AuthURL: server.URL + "/auth", TokenURL: server.URL + "/token", AuthStyle: oauth2.AuthStyleInParams},
+	}
+	tok, err := getTokenFromWebWithLocalServer(context.Background(), config)
+	if err != nil || tok.AccessToken != "pkce-token" {
+		t.Fatalf("unexpected token %+v, %v", tok, err)
+	}
+	if body := <-page; !strings.Contains(body, "Authentication complete") {
+		t.Fatalf("unexpected callback page %q", body)
+	}
+}
+
+func TestCallbackHandlerRejectsInvalidAndReplayedResponses(t *testing.T) {
+	handler := newCallbackHandler("expected-state")
+	serve := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		return recorder
+	}
+
+	if rec := serve("code=forged&state=other"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid state") {
+		t.Fatalf("expected a mismatched state to be rejected, got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(handler.result) != 0 {
+		t.Fatalf("a rejected callback must not complete the flow")
+	}
+
+	if rec := serve("code=good&state=expected-state"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the valid callback to succeed, got %d", rec.Code)
+	}
+	if result := <-handler.result; result.code != "good" || result.err != nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if rec := serve("code=replayed&state=expected-state"); rec.Code != http.StatusConflict {
+		t.Fatalf("expected the replayed callback to be rejected, got %d", rec.Code)
+	}
+	if len(handler.result) != 0 {
+		t.Fatalf("a replayed callback must not produce another result")
+	}
+}
+
+func TestCallbackHandlerReportsAuthorizationError(t *testing.T) {
+	handler := newCallbackHandler("state")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?error=access_denied&error_description=User+declined&state=state", nil))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "Authentication failed") {
+		t.Fatalf("unexpected page %d %q", recorder.Code, recorder.Body.String())
+	}
+	if result := <-handler.result; result.err == nil || !strings.Contains(result.err.Error(), "User declined") {
+		t.Fatalf("expected the error to be reported, got %+v", result)
+	}
+}
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json.age")
+	store := &encryptedFileStore{path: path, passphrase: func() (string, error) { return "correct horse", nil }, workFactor: 10}
+	token := &StoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "secret-refresh"}, Scopes: mergeScopes(Scopes)}
+	if err := store.Save(token); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if strings.Contains(string(data), "secret-refresh") {
+		t.Fatalf("refresh token stored in plaintext")
+	}
+
+	loaded, err := store.Load()
+	if err != nil || loaded.RefreshToken != "secret-refresh" || !loaded.HasScopes(Scopes) {
+		t.Fatalf("unexpected token %+v, %v", loaded, err)
+	}
+
+	wrong := &encryptedFileStore{path: path, passphrase: func() (string, error) { return "wrong", nil }}
+	if _, err := wrong.Load(); err == nil {
+		t.Fatalf("expected a wrong passphrase to fail")
+	}
+}
+
+func TestKeyringStoreImportsPlainTokenFile(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	plain := filepath.Join(t.TempDir(), "token.json")
+	if err := SaveToken(plain, &StoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	store, err := NewTokenStore(Options{TokenStorage: StorageKeyring, Profile: "work-eu"})
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an empty keyring, got %v", err)
+	}
+
+	stored, err := loadTokenFromStore(store, []string{plain})
+	if err != nil || stored.RefreshToken != "refresh" {
+		t.Fatalf("unexpected token %+v, %v", stored, err)
+	}
+	if _, err := os.Stat(plain); !os.IsNotExist(err) {
+		t.Fatalf("expected the plain token file to be removed, got %v", err)
+	}
+	if loaded, err := store.Load(); err != nil || loaded.RefreshToken != "refresh" {
+		t.Fatalf("expected the token in the keyring, got %+v, %v", loaded, err)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.Delete(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist after delete, got %v", err)
+	}
+}
+
+func TestKeyringStoreFallsBackToFile(t *testing.T) {
+	keyring.MockInitWithError(errors.New("no Secret Service provider"))
+	t.Cleanup(keyring.MockInit)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+
+	// Without a passphrase the token goes to the plain file
+	store, err := NewTokenStore(Options{TokenStorage: StorageKeyring, TokenFile: path})
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no token, got %v", err)
+	}
+	token := &StoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}, Scopes: mergeScopes(Scopes)}
+	if err := store.Save(token); err != nil {
+		t.Fatalf("save with an unavailable keyring: %v", err)
+	}
+	if loaded, err := LoadToken(path); err != nil || loaded.RefreshToken != "refresh" {
+		t.Fatalf("expected the token in %s, got %+v, %v", path, loaded, err)
+	}
+	if store.Location() != path {
+		t.Fatalf("expected the location to name the fallback file, got %q", store.Location())
+	}
+
+	// A fresh store finds it there, and logging out removes it
+	again, _ := NewTokenStore(Options{TokenStorage: StorageKeyring, TokenFile: path})
+	if loaded, err := again.Load(); err != nil || loaded.RefreshToken != "refresh" {
+		t.Fatalf("expected the fallback token, got %+v, %v", loaded, err)
+	}
+	if err := again.Delete(); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the fallback file to be removed, got %v", err)
+	}
+
+	// With a passphrase it is encrypted instead
+	encrypted, _ := NewTokenStore(Options{TokenStorage: StorageKeyring, TokenFile: path,
+		Passphrase: func() (string, error) { return "correct horse", nil }})
+	encrypted.(*keyringStore).fallbacks[0].(*encryptedFileStore).workFactor = 10
+	if err := encrypted.Save(token); err != nil {
+		t.Fatalf("save encrypted: %v", err)
+	}
+	data, err := os.ReadFile(path + ".age")
+	if err != nil || strings.Contains(string(data), "refresh") {
+		t.Fatalf("expected an encrypted fallback file, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no plain token file, got %v", err)
+	}
+}
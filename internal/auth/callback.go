@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// callbackTimeout bounds how long the local server waits for the browser to return
+var callbackTimeout = 2 * time.Minute
+
+// errCallbackUsed is returned to callbacks arriving after the flow already completed
+var errCallbackUsed = errors.New("this authorization response was already used")
+
+// newState returns a random, URL-safe value for the OAuth state parameter
+func newState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate OAuth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// callbackResult is the outcome of the single accepted callback
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackHandler receives the authorization response on the local redirect URL.
+// Only the first response carrying the expected state is accepted; later ones are replays.
+type callbackHandler struct {
+	state  string
+	result chan callbackResult
+
+	mu   sync.Mutex
+	done bool
+}
+
+func newCallbackHandler(state string) *callbackHandler {
+	return &callbackHandler{state: state, result: make(chan callbackResult, 1)}
+}
+
+func (h *callbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers also ask for /favicon.ico and the like
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.done {
+		renderCallbackPage(w, http.StatusConflict, false, errCallbackUsed.Error())
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(h.state)) != 1 {
+		log.Warn().Str("remote", r.RemoteAddr).Msg("Rejected OAuth callback with an invalid state")
+		renderCallbackPage(w, http.StatusBadRequest, false, "The request did not come from this login attempt (invalid state). Start the login again from the terminal.")
+		return
+	}
+
+	if e := query.Get("error"); e != "" {
+		message := e
+		if description := query.Get("error_description"); description != "" {
+			message = fmt.Sprintf("%s: %s", e, description)
+		}
+		h.done = true
+		h.result <- callbackResult{err: fmt.Errorf("authorization failed: %s", message)}
+		renderCallbackPage(w, http.StatusBadRequest, false, "Google reported an error: "+message)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		renderCallbackPage(w, http.StatusBadRequest, false, "The response is missing the authorization code.")
+		return
+	}
+
+	h.done = true
+	h.result <- callbackResult{code: code}
+	renderCallbackPage(w, http.StatusOK, true, "You can close this tab and return to the terminal.")
+}
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 4em auto; text-align: center">
+<h1 style="color: {{if .Success}}#188038{{else}}#c5221f{{end}}">{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// renderCallbackPage shows the login result in the browser
+func renderCallbackPage(w http.ResponseWriter, status int, success bool, message string) {
+	title := "Authentication failed"
+	if success {
+		title = "Authentication complete"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	callbackPage.Execute(w, struct {
+		Title   string
+		Message string
+		Success bool
+	}{title, message, success})
+}
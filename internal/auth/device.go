@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/logger"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// hasDisplay reports whether a browser opened by the tool can be seen by the user.
+// SSH sessions are treated as headless even with X forwarding.
+func hasDisplay() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	default:
+		return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	}
+}
+
+// getTokenFromDevice runs the OAuth device authorization flow: the user opens the
+// verification URL on any device and enters the code while we poll for the token.
+// Google only accepts it for "TVs and Limited Input devices" OAuth clients.
+func getTokenFromDevice(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+	if config.Endpoint.DeviceAuthURL == "" {
+		// Client secret files don't carry the device endpoint
+		config.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+	}
+
+	resp, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization: %w", err)
+	}
+
+	logger.Printf("\nTo authorize this device, visit:\n%v\nand enter the code: %s\n\n", resp.VerificationURI, resp.UserCode)
+	if resp.VerificationURIComplete != "" {
+		logger.Printf("Or open this link directly:\n%v\n\n", resp.VerificationURIComplete)
+	}
+
+	tok, err := config.DeviceAccessToken(ctx, resp)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization failed: %w", err)
+	}
+	return tok, nil
+}
@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/rs/zerolog/log"
+	"github.com/zalando/go-keyring"
+)
+
+// Token storage backends selected with Options.TokenStorage
+const (
+	StorageFile      = "file"      // Plain JSON file readable only by the current user
+	StorageEncrypted = "encrypted" // age file encrypted with a passphrase
+	StorageKeyring   = "keyring"   // OS keyring: Secret Service on Linux, Keychain on macOS, Credential Manager on Windows
+)
+
+// keyringService is the service name tokens are stored under in the OS keyring
+const keyringService = "best-time-to-meet"
+
+// TokenStore persists the OAuth token of one account
+type TokenStore interface {
+	// Load returns the stored token, or an error wrapping os.ErrNotExist when there is none
+	Load() (*StoredToken, error)
+	Save(token *StoredToken) error
+	// Delete removes the token, returning an error wrapping os.ErrNotExist when there is none
+	Delete() error
+	// Location describes where the token is kept, for status output
+	Location() string
+}
+
+// NewTokenStore returns the store selected by opts.TokenStorage for opts.Profile
+func NewTokenStore(opts Options) (TokenStore, error) {
+	switch opts.TokenStorage {
+	case StorageFile, "":
+		path, err := opts.tokenFile()
+		if err != nil {
+			return nil, err
+		}
+		return &fileStore{path: path}, nil
+
+	case StorageEncrypted:
+		path, err := opts.tokenFile()
+		if err != nil {
+			return nil, err
+		}
+		if opts.TokenFile == "" {
+			path += ".age"
+		}
+		if opts.Passphrase == nil {
+			return nil, fmt.Errorf("encrypted token storage needs a passphrase")
+		}
+		return &encryptedFileStore{path: path, passphrase: opts.Passphrase}, nil
+
+	case StorageKeyring:
+		account := opts.Profile
+		if account == "" {
+			account = "default"
+		}
+		store := &keyringStore{account: account}
+		// Without a usable keyring (headless Linux, locked keychain), tokens go to a file instead
+		if path, err := opts.tokenFile(); err == nil {
+			if opts.Passphrase != nil {
+				store.fallbacks = append(store.fallbacks, &encryptedFileStore{path: path + ".age", passphrase: opts.Passphrase})
+			}
+			store.fallbacks = append(store.fallbacks, &fileStore{path: path})
+		}
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("unknown token storage %q (expected file, encrypted or keyring)", opts.TokenStorage)
+	}
+}
+
+// fileStore keeps the token in a plain JSON file
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Load() (*StoredToken, error)   { return LoadToken(s.path) }
+func (s *fileStore) Save(token *StoredToken) error { return SaveToken(s.path, token) }
+func (s *fileStore) Delete() error                 { return os.Remove(s.path) }
+func (s *fileStore) Location() string              { return s.path }
+
+// encryptedFileStore keeps the token in an age file encrypted with a passphrase.
+// The passphrase is asked for once and reused to save refreshed tokens.
+type encryptedFileStore struct {
+	path       string
+	passphrase func() (string, error)
+	workFactor int // scrypt work factor; 0 uses age's default
+
+	once   sync.Once
+	secret string
+	err    error
+}
+
+func (s *encryptedFileStore) getPassphrase() (string, error) {
+	s.once.Do(func() {
+		s.secret, s.err = s.passphrase()
+		if s.err == nil && s.secret == "" {
+			s.err = errors.New("empty passphrase")
+		}
+	})
+	return s.secret, s.err
+}
+
+func (s *encryptedFileStore) Load() (*StoredToken, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token file %s (wrong passphrase?): %w", s.path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token file %s: %w", s.path, err)
+	}
+	return parseToken(plain, s.path)
+}
+
+func (s *encryptedFileStore) Save(token *StoredToken) error {
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	if s.workFactor > 0 {
+		recipient.SetWorkFactor(s.workFactor)
+	}
+
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(plain); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	log.Debug().Str("path", s.path).Msg("Saving encrypted credential file")
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+func (s *encryptedFileStore) Delete() error    { return os.Remove(s.path) }
+func (s *encryptedFileStore) Location() string { return s.path + " (encrypted)" }
+
+// keyringStore keeps the token in the OS keyring under keyringService. When the keyring
+// can't be used, it falls back to the first of fallbacks that works: the encrypted file
+// when a passphrase is available, then the plain file.
+type keyringStore struct {
+	account   string
+	fallbacks []TokenStore
+
+	mu          sync.Mutex
+	unavailable bool       // The keyring failed once; later calls go to the fallbacks
+	active      TokenStore // Fallback the token was last loaded from or saved to
+}
+
+// disable switches the store to its fallbacks after the keyring failed with err
+func (s *keyringStore) disable(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.unavailable {
+		log.Warn().Err(err).Msg("OS keyring unavailable, keeping the token in a file instead")
+	}
+	s.unavailable = true
+}
+
+func (s *keyringStore) state() (unavailable bool, active TokenStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unavailable, s.active
+}
+
+func (s *keyringStore) activate(store TokenStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = store
+}
+
+func (s *keyringStore) Load() (*StoredToken, error) {
+	if unavailable, _ := s.state(); unavailable {
+		return s.loadFallback()
+	}
+	secret, err := keyring.Get(keyringService, s.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no token in the keyring: %w", os.ErrNotExist)
+	}
+	if err != nil {
+		s.disable(fmt.Errorf("unable to read the keyring: %w", err))
+		return s.loadFallback()
+	}
+	return parseToken([]byte(secret), s.Location())
+}
+
+// loadFallback reads the token from the first fallback that has one
+func (s *keyringStore) loadFallback() (*StoredToken, error) {
+	for _, fallback := range s.fallbacks {
+		token, err := fallback.Load()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			s.activate(fallback)
+		}
+		return token, err
+	}
+	return nil, fmt.Errorf("no token in the keyring or its fallback files: %w", os.ErrNotExist)
+}
+
+func (s *keyringStore) Save(token *StoredToken) error {
+	unavailable, active := s.state()
+	if !unavailable {
+		data, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("account", s.account).Msg("Saving token to the keyring")
+		err = keyring.Set(keyringService, s.account, string(data))
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("unable to write to the keyring: %w", err)
+		if len(s.fallbacks) == 0 {
+			return err
+		}
+		s.disable(err)
+	}
+
+	// Keep saving where the token was found, so a refreshed token doesn't end up in two files
+	candidates := s.fallbacks
+	if active != nil {
+		candidates = append([]TokenStore{active}, s.fallbacks...)
+	}
+	var err error
+	for _, fallback := range candidates {
+		if err = fallback.Save(token); err == nil {
+			s.activate(fallback)
+			log.Info().Str("location", fallback.Location()).Msg("Saved token outside the keyring")
+			return nil
+		}
+		log.Debug().Err(err).Str("location", fallback.Location()).Msg("Could not save token to fallback store")
+	}
+	return err
+}
+
+func (s *keyringStore) Delete() error {
+	deleted := false
+	if unavailable, _ := s.state(); !unavailable {
+		err := keyring.Delete(keyringService, s.account)
+		switch {
+		case err == nil:
+			deleted = true
+		case !errors.Is(err, keyring.ErrNotFound):
+			if len(s.fallbacks) == 0 {
+				return err
+			}
+			s.disable(err)
+		}
+	}
+	// A token saved while the keyring was unavailable may be in a fallback file
+	for _, fallback := range s.fallbacks {
+		err := fallback.Delete()
+		if err == nil {
+			deleted = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if !deleted {
+		return fmt.Errorf("no token in the keyring: %w", os.ErrNotExist)
+	}
+	return nil
+}
+
+func (s *keyringStore) Location() string {
+	if _, active := s.state(); active != nil {
+		return active.Location()
+	}
+	return fmt.Sprintf("OS keyring (%s/%s)", keyringService, s.account)
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+)
+
+// legacyTokenFile is where tokens were stored before they moved to the user config directory
+const legacyTokenFile = "token.json"
+
+// WriteScopes are requested on top of Scopes by features that modify calendars
+var WriteScopes = []string{calendar.CalendarEventsScope}
+
+// StoredToken is an OAuth token saved on disk with the scopes it was granted for.
+// The token fields are inlined, so files written before scopes were recorded still load.
+type StoredToken struct {
+	oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// DefaultTokenFile returns the per-user token location for a profile; the empty
+// profile keeps the original location so existing logins carry over
+func DefaultTokenFile(profile string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user config directory: %w", err)
+	}
+	if profile == "" {
+		return filepath.Join(base, "best-time-to-meet", "token.json"), nil
+	}
+	if err := ValidateProfileName(profile); err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "best-time-to-meet", "profiles", profile, "token.json"), nil
+}
+
+// ValidateProfileName rejects names that can't be used as a directory name
+func ValidateProfileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+// tokenFile returns opts.TokenFile or the default location for opts.Profile
+func (o Options) tokenFile() (string, error) {
+	if o.TokenFile != "" {
+		return o.TokenFile, nil
+	}
+	return DefaultTokenFile(o.Profile)
+}
+
+// requiredScopes returns the default scopes plus any extra ones requested by opts
+func (o Options) requiredScopes() []string {
+	return mergeScopes(Scopes, o.Scopes)
+}
+
+// LoadToken reads a stored token. Tokens saved before scopes were recorded are
+// assumed to carry the default Scopes.
+func LoadToken(path string) (*StoredToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseToken(data, path)
+}
+
+// parseToken decodes a token read from location
+func parseToken(data []byte, location string) (*StoredToken, error) {
+	stored := &StoredToken{}
+	if err := json.Unmarshal(data, stored); err != nil {
+		return nil, fmt.Errorf("unable to parse token from %s: %w", location, err)
+	}
+	if len(stored.Scopes) == 0 {
+		stored.Scopes = append([]string(nil), Scopes...)
+	}
+	return stored, nil
+}
+
+// plainTokenFiles lists the plain token files an empty store imports: the file
+// location for this profile and, for the default profile, the token.json older
+// versions left in the working directory
+func (o Options) plainTokenFiles() []string {
+	var files []string
+	if path, err := o.tokenFile(); err == nil {
+		files = append(files, path)
+	}
+	if o.Profile == "" && o.TokenFile == "" {
+		files = append(files, legacyTokenFile)
+	}
+	return files
+}
+
+// loadTokenFromStore reads the token from store. When the store is empty, the first
+// plain token file found in candidates is moved into it.
+func loadTokenFromStore(store TokenStore, candidates []string) (*StoredToken, error) {
+	stored, err := store.Load()
+	if !errors.Is(err, os.ErrNotExist) {
+		return stored, err
+	}
+
+	for _, candidate := range candidates {
+		if candidate == store.Location() {
+			continue
+		}
+		plain, loadErr := LoadToken(candidate)
+		if loadErr != nil {
+			if !errors.Is(loadErr, os.ErrNotExist) {
+				log.Warn().Err(loadErr).Str("path", candidate).Msg("Ignoring unreadable token file")
+			}
+			continue
+		}
+		if saveErr := store.Save(plain); saveErr != nil {
+			log.Warn().Err(saveErr).Str("path", candidate).Msg("Could not move token file to the token store")
+			return plain, nil
+		}
+		if removeErr := os.Remove(candidate); removeErr != nil {
+			log.Warn().Err(removeErr).Str("path", candidate).Msg("Could not remove the old token file")
+		}
+		log.Info().Str("from", candidate).Str("to", store.Location()).Msg("Moved token to the token store")
+		return plain, nil
+	}
+	return nil, err
+}
+
+// SaveToken writes a token readable only by the current user, creating its directory if needed.
+// The file is replaced atomically so a concurrent run never reads a partial token.
+func SaveToken(path string, token *StoredToken) error {
+	log.Debug().Str("path", path).Msg("Saving credential file")
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the same directory
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create token directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".token-*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
+	return nil
+}
+
+// persistingTokenSource writes tokens refreshed by source back to the store, so later
+// runs start from a valid access token and keep any rotated refresh token
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	source oauth2.TokenSource
+	store  TokenStore
+	stored StoredToken
+}
+
+// newTokenSource returns a token source for stored that persists refreshes to store
+func newTokenSource(ctx context.Context, config *oauth2.Config, stored *StoredToken, store TokenStore) oauth2.TokenSource {
+	return &persistingTokenSource{
+		source: config.TokenSource(ctx, &stored.Token),
+		store:  store,
+		stored: *stored,
+	}
+}
+
+// Token returns a valid token, saving it when it differs from the stored one
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tok, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken != s.stored.AccessToken || tok.RefreshToken != s.stored.RefreshToken {
+		s.stored.Token = *tok
+		if err := s.store.Save(&s.stored); err != nil {
+			log.Warn().Err(err).Msg("Could not save the refreshed token")
+		} else {
+			log.Debug().Time("expiry", tok.Expiry).Msg("Saved refreshed token")
+		}
+	}
+	return tok, nil
+}
+
+// HasScopes reports whether the token was granted every scope in required
+func (t *StoredToken) HasScopes(required []string) bool {
+	return len(missingScopes(t.Scopes, required)) == 0
+}
+
+// missingScopes returns the required scopes not present in granted
+func missingScopes(granted, required []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		have[scope] = true
+	}
+	var missing []string
+	for _, scope := range required {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// mergeScopes returns the sorted union of the scope lists
+func mergeScopes(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, scope := range list {
+			if scope != "" && !seen[scope] {
+				seen[scope] = true
+				merged = append(merged, scope)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Mode controls how cached entries are used
+type Mode int
+
+const (
+	// ModeDefault serves fresh entries from the cache and stores new results
+	ModeDefault Mode = iota
+	// ModeRefresh ignores existing entries but stores new results
+	ModeRefresh
+	// ModeOffline serves entries regardless of age and never expects new results
+	ModeOffline
+)
+
+// DefaultTTL is how long cached entries are considered fresh
+const DefaultTTL = time.Hour
+
+// Store is a file-based cache holding one JSON document per entry.
+// A nil *Store is valid and behaves as an always-empty cache.
+type Store struct {
+	dir      string
+	ttl      time.Duration
+	kindTTLs map[string]time.Duration
+	mode     Mode
+	now      func() time.Time
+}
+
+// entry is the on-disk representation of a cached value
+type entry struct {
+	Kind     string          `json:"kind"`
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"stored_at"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// EntryInfo describes a cached entry for inspection
+type EntryInfo struct {
+	Kind     string
+	Key      string
+	StoredAt time.Time
+	Expired  bool
+	Size     int64
+	Path     string
+}
+
+// DefaultDir returns the per-user cache directory for the tool
+func DefaultDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine user cache directory: %w", err)
+	}
+	return filepath.Join(base, "best-time-to-meet"), nil
+}
+
+// New opens (and creates if needed) a cache rooted at dir
+func New(dir string, ttl time.Duration, mode Mode) (*Store, error) {
+	if dir == "" {
+		var err error
+		dir, err = DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create cache directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir, ttl: ttl, mode: mode, now: time.Now}, nil
+}
+
+// Dir returns the cache root directory
+func (s *Store) Dir() string {
+	if s == nil {
+		return ""
+	}
+	return s.dir
+}
+
+// Offline reports whether callers must not fetch fresh data
+func (s *Store) Offline() bool {
+	return s != nil && s.mode == ModeOffline
+}
+
+// SetKindTTL overrides the TTL for entries of one kind
+func (s *Store) SetKindTTL(kind string, ttl time.Duration) {
+	if s == nil {
+		return
+	}
+	if s.kindTTLs == nil {
+		s.kindTTLs = make(map[string]time.Duration)
+	}
+	s.kindTTLs[kind] = ttl
+}
+
+// Get loads the entry for kind/key into v. It reports whether a usable entry was found.
+func (s *Store) Get(kind, key string, v interface{}) (bool, error) {
+	if s == nil || s.mode == ModeRefresh {
+		return false, nil
+	}
+
+	e, err := s.read(kind, key)
+	if e == nil || err != nil {
+		return false, err
+	}
+
+	if s.mode != ModeOffline && s.expired(kind, e.StoredAt) {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return false, fmt.Errorf("corrupt cache entry for %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Peek loads the entry for kind/key into v whatever its age and the store's mode.
+// It reports whether an entry was found.
+func (s *Store) Peek(kind, key string, v interface{}) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	e, err := s.read(kind, key)
+	if e == nil || err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return false, fmt.Errorf("corrupt cache entry for %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// read returns the entry stored for kind/key, or nil when there is none
+func (s *Store) read(kind, key string) (*entry, error) {
+	data, err := os.ReadFile(s.path(kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("corrupt cache entry for %s: %w", key, err)
+	}
+
+	// Hash collisions are practically impossible, but never serve another key's data
+	if e.Key != key {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// Put stores v under kind/key, replacing any existing entry atomically
+func (s *Store) Put(kind, key string, v interface{}) error {
+	if s == nil || s.mode == ModeOffline {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(entry{
+		Kind:     kind,
+		Key:      key,
+		StoredAt: s.now().UTC(),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := s.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(encoded); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Entries lists cached entries, optionally restricted to one kind, sorted by kind and key
+func (s *Store) Entries(kind string) ([]EntryInfo, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	var infos []EntryInfo
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return readErr
+		}
+
+		var e entry
+		if json.Unmarshal(data, &e) != nil {
+			// Surface unreadable files so they can be cleared
+			infos = append(infos, EntryInfo{Kind: filepath.Base(filepath.Dir(path)), Key: "(corrupt)", Expired: true, Size: int64(len(data)), Path: path})
+			return nil
+		}
+		if kind != "" && e.Kind != kind {
+			return nil
+		}
+
+		infos = append(infos, EntryInfo{
+			Kind:     e.Kind,
+			Key:      e.Key,
+			StoredAt: e.StoredAt,
+			Expired:  s.expired(e.Kind, e.StoredAt),
+			Size:     int64(len(data)),
+			Path:     path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind < infos[j].Kind
+		}
+		return infos[i].Key < infos[j].Key
+	})
+	return infos, nil
+}
+
+// Clear removes cached entries of the given kind (all kinds when empty).
+// When expiredOnly is set, fresh entries are kept. It returns the number of entries removed.
+func (s *Store) Clear(kind string, expiredOnly bool) (int, error) {
+	infos, err := s.Entries(kind)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, info := range infos {
+		if expiredOnly && !info.Expired {
+			continue
+		}
+		if err := os.Remove(info.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *Store) expired(kind string, storedAt time.Time) bool {
+	ttl, ok := s.kindTTLs[kind]
+	if !ok {
+		ttl = s.ttl
+	}
+	return ttl > 0 && s.now().Sub(storedAt) > ttl
+}
+
+func (s *Store) path(kind, key string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + key))
+	return filepath.Join(s.dir, kind, hex.EncodeToString(sum[:])+".json")
+}
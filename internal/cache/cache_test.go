@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreModesAndExpiry(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	store, err := New(dir, time.Hour, ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	if err := store.Put("freebusy", "alice@example.com", []string{"busy"}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	var value []string
+	if hit, err := store.Get("freebusy", "alice@example.com", &value); err != nil || !hit || len(value) != 1 {
+		t.Fatalf("expected fresh hit, got hit=%v err=%v value=%v", hit, err, value)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if hit, _ := store.Get("freebusy", "alice@example.com", &value); hit {
+		t.Fatalf("expected expired entry to miss")
+	}
+
+	offline := &Store{dir: dir, ttl: time.Hour, mode: ModeOffline, now: store.now}
+	if hit, _ := offline.Get("freebusy", "alice@example.com", &value); !hit {
+		t.Fatalf("expected offline mode to serve expired entries")
+	}
+
+	refresh := &Store{dir: dir, ttl: time.Hour, mode: ModeRefresh, now: store.now}
+	if hit, _ := refresh.Get("freebusy", "alice@example.com", &value); hit {
+		t.Fatalf("expected refresh mode to ignore cached entries")
+	}
+	if hit, err := refresh.Peek("freebusy", "alice@example.com", &value); err != nil || !hit {
+		t.Fatalf("expected peek to read expired entries in any mode, got hit=%v err=%v", hit, err)
+	}
+
+	perKind := &Store{dir: dir, ttl: time.Hour, mode: ModeDefault, now: store.now}
+	perKind.SetKindTTL("freebusy", 24*time.Hour)
+	if hit, _ := perKind.Get("freebusy", "alice@example.com", &value); !hit {
+		t.Fatalf("expected the per-kind TTL to keep the entry fresh")
+	}
+
+	if err := store.Put("timezone", "alice@example.com", "Europe/Paris"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	entries, err := store.Entries("")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d (%v)", len(entries), err)
+	}
+	if !entries[0].Expired || entries[1].Expired {
+		t.Fatalf("unexpected expiry flags: %+v", entries)
+	}
+
+	removed, err := store.Clear("", true)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d (%v)", removed, err)
+	}
+	removed, err = store.Clear("timezone", false)
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 timezone entry removed, got %d (%v)", removed, err)
+	}
+}
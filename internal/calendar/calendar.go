@@ -1,18 +1,27 @@
 package calendar
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/retry"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
 	"google.golang.org/api/calendar/v3"
 )
 
 // TimeSlot represents a time period
 type TimeSlot struct {
-	Start time.Time
-	End   time.Time
+	Start    time.Time
+	End      time.Time
+	Calendar string `json:",omitempty"` // Calendar ID a busy slot came from
 }
 
 // UserAvailability represents a user's busy/free times
@@ -21,6 +30,47 @@ type UserAvailability struct {
 	BusySlots []TimeSlot
 	TimeZone  *time.Location // User's calendar timezone
 	Holidays  []Holiday
+	Status    AvailabilityStatus // Whether BusySlots reflects the real calendar
+	Errors    []CalendarError    // Per-calendar errors reported by the FreeBusy API
+}
+
+// AvailabilityStatus describes whether an attendee's busy data could be read
+type AvailabilityStatus string
+
+const (
+	// AvailabilityKnown means the FreeBusy API returned busy data for the calendar
+	AvailabilityKnown AvailabilityStatus = "known"
+	// AvailabilityUnknown means the FreeBusy API reported an error for the calendar,
+	// so an empty BusySlots list must not be read as "completely free"
+	AvailabilityUnknown AvailabilityStatus = "unknown"
+)
+
+// CalendarError is a per-calendar error returned in a FreeBusy response (e.g. notFound, internalError)
+type CalendarError struct {
+	Domain string
+	Reason string
+}
+
+// IsUnknown reports whether the attendee's availability could not be determined
+func (u UserAvailability) IsUnknown() bool {
+	return u.Status == AvailabilityUnknown
+}
+
+// ErrorReasons returns the distinct FreeBusy error reasons for the attendee
+func (u UserAvailability) ErrorReasons() []string {
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, calErr := range u.Errors {
+		reason := calErr.Reason
+		if reason == "" {
+			reason = "unknown"
+		}
+		if !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
 }
 
 // Holiday represents an observed public holiday window for a user.
@@ -41,31 +91,172 @@ type CalendarAccessResult struct {
 // Default batch size for Calendar API requests
 const DefaultBatchSize = 50
 
+// DefaultMaxQueryWindow is the longest time range sent in a single FreeBusy query.
+// The API rejects ranges longer than roughly two months (timeRangeTooLong).
+const DefaultMaxQueryWindow = 60 * 24 * time.Hour
+
+// DefaultConcurrency is the default number of Calendar API requests allowed in flight at once
+const DefaultConcurrency = 4
+
+// Calendar API quotas default to 600 queries per minute per user, so the shared
+// limiter stays at 10 requests per second with a small burst allowance.
+const (
+	DefaultRequestsPerSecond = 10
+	DefaultRequestBurst      = 10
+)
+
+// FetchOptions controls how busy times are fetched from the Calendar API
+type FetchOptions struct {
+	BatchSize   int            // Number of calendars per FreeBusy request
+	Concurrency int            // Maximum number of Calendar API calls (FreeBusy and timezone lookups) in flight at once
+	Limiter     *rate.Limiter  // Shared token bucket applied to every Calendar API call
+	Retrier     *retry.Retrier // Retry policy for transient API errors (429/5xx)
+	MaxWindow   time.Duration  // Longest time range per FreeBusy query; longer searches are split
+	Cache       *cache.Store   // Optional on-disk cache for busy data and timezones
+
+	// Progress optionally receives one event per completed batch
+	Progress progress.Reporter
+
+	// AttendeeCalendars maps a lowercase attendee email to additional calendar IDs (personal,
+	// on-call, ...) whose busy slots are merged into that attendee's availability
+	AttendeeCalendars map[string][]string
+}
+
+// Cache entry kinds used by the calendar package
+const (
+	CacheKindFreeBusy = "freebusy"
+	CacheKindTimeZone = "timezone"
+)
+
+// NewRateLimiter creates a token-bucket limiter tuned to the default Calendar API quotas
+func NewRateLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(DefaultRequestsPerSecond), DefaultRequestBurst)
+}
+
+// withDefaults fills in zero values with the package defaults
+func (o FetchOptions) withDefaults() FetchOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Limiter == nil {
+		o.Limiter = NewRateLimiter()
+	}
+	if o.Retrier == nil {
+		o.Retrier = retry.Default()
+	}
+	if o.MaxWindow <= 0 {
+		o.MaxWindow = DefaultMaxQueryWindow
+	}
+	return o
+}
+
+// busyFetcher performs rate-limited Calendar API calls for a single fetch operation
+type busyFetcher struct {
+	service   *calendar.Service
+	opts      FetchOptions
+	retries   atomic.Int64    // Retries performed across all calls in this fetch
+	recovered atomic.Int64    // Calls that succeeded only after retrying
+	cached    atomic.Int64    // Calendars served from the cache
+	extra     map[string]bool // Additional calendar IDs that are not attendees themselves
+	slots     chan struct{}   // Bounds the API calls in flight across batches, windows and timezone lookups
+
+	uncachedMutex sync.Mutex
+	uncached      map[string]bool // Calendars missing from the cache in offline mode
+}
+
+// cachedBusy is the cached FreeBusy result for one calendar and time range
+type cachedBusy struct {
+	BusySlots []TimeSlot `json:"busy_slots"`
+}
+
+// wait blocks until the shared limiter allows another API call or ctx is done
+func (f *busyFetcher) wait(ctx context.Context) error {
+	return f.opts.Limiter.Wait(ctx)
+}
+
+// call runs a rate-limited API call through the retrier and tracks its retry counts.
+// It returns the number of attempts made.
+func (f *busyFetcher) call(ctx context.Context, operation string, fn func() error) (int, error) {
+	attempts, err := f.opts.Retrier.DoCounted(ctx, operation, func() error {
+		// Hold a slot only for the attempt itself, not while backing off
+		select {
+		case f.slots <- struct{}{}:
+			defer func() { <-f.slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := f.wait(ctx); err != nil {
+			return err
+		}
+		return fn()
+	})
+	if attempts > 1 {
+		f.retries.Add(int64(attempts - 1))
+		if err == nil {
+			f.recovered.Add(1)
+		}
+	}
+	return attempts, err
+}
+
 // GetBusyTimes fetches busy times for multiple users, automatically batching if needed
-func GetBusyTimes(service *calendar.Service, emails []string, startTime, endTime time.Time) ([]UserAvailability, error) {
-	return GetBusyTimesWithBatching(service, emails, startTime, endTime, DefaultBatchSize)
+func GetBusyTimes(ctx context.Context, service *calendar.Service, emails []string, startTime, endTime time.Time) ([]UserAvailability, error) {
+	return GetBusyTimesWithBatching(ctx, service, emails, startTime, endTime, DefaultBatchSize)
 }
 
 // GetBusyTimesWithBatching fetches busy times for multiple users with configurable batch size
-func GetBusyTimesWithBatching(service *calendar.Service, emails []string, startTime, endTime time.Time, batchSize int) ([]UserAvailability, error) {
-	if batchSize <= 0 {
-		batchSize = DefaultBatchSize
+func GetBusyTimesWithBatching(ctx context.Context, service *calendar.Service, emails []string, startTime, endTime time.Time, batchSize int) ([]UserAvailability, error) {
+	availabilities, _, err := GetBusyTimesWithOptions(ctx, service, emails, startTime, endTime, FetchOptions{BatchSize: batchSize})
+	return availabilities, err
+}
+
+// GetBusyTimesWithOptions fetches busy times for multiple users, running batches in parallel.
+// Results are returned in the order of the requested emails regardless of scheduling.
+// Failed batches do not abort the fetch; they are recorded in the returned FetchReport,
+// and an error is only returned when no batch succeeded at all or ctx was canceled,
+// in which case the calendars retrieved so far are still returned.
+func GetBusyTimesWithOptions(ctx context.Context, service *calendar.Service, emails []string, startTime, endTime time.Time, opts FetchOptions) ([]UserAvailability, *FetchReport, error) {
+	opts = opts.withDefaults()
+	attendees := emails
+	emails, extra := expandAttendeeCalendars(attendees, opts.AttendeeCalendars)
+	fetcher := &busyFetcher{
+		service:  service,
+		opts:     opts,
+		extra:    extra,
+		slots:    make(chan struct{}, opts.Concurrency),
+		uncached: make(map[string]bool),
 	}
+	batchSize := opts.BatchSize
+	started := time.Now()
 
-	// If we have few enough emails, process in a single batch
-	if len(emails) <= batchSize {
-		return getBusyTimesBatch(service, emails, startTime, endTime)
+	totalBatches := (len(emails) + batchSize - 1) / batchSize
+
+	if len(extra) > 0 {
+		log.Debug().
+			Int("attendees", len(attendees)).
+			Int("additional_calendars", len(extra)).
+			Msg("Querying additional attendee calendars")
 	}
 
-	// Process in batches
-	log.Info().
-		Int("total_emails", len(emails)).
-		Int("batch_size", batchSize).
-		Int("num_batches", (len(emails)+batchSize-1)/batchSize).
-		Msg("Processing calendars in batches")
+	if totalBatches > 1 {
+		log.Info().
+			Int("total_emails", len(emails)).
+			Int("batch_size", batchSize).
+			Int("num_batches", totalBatches).
+			Int("concurrency", opts.Concurrency).
+			Msg("Processing calendars in batches")
+	}
 
-	var allAvailabilities []UserAvailability
-	emailMap := make(map[string]bool) // Track which emails we've already processed
+	tracker := progress.NewTracker(opts.Progress, progress.StageBatches, totalBatches)
+
+	// Each batch writes to its own slot so the merged output stays deterministic.
+	// Batches start together; the fetcher's slots bound the API calls they make.
+	batchResults := make([][]UserAvailability, totalBatches)
+	batchReports := make([]BatchReport, totalBatches)
+	var wg sync.WaitGroup
 
 	for i := 0; i < len(emails); i += batchSize {
 		end := i + batchSize
@@ -74,52 +265,206 @@ func GetBusyTimesWithBatching(service *calendar.Service, emails []string, startT
 		}
 
 		batch := emails[i:end]
-		batchNum := (i / batchSize) + 1
-		totalBatches := (len(emails) + batchSize - 1) / batchSize
+		batchIndex := i / batchSize
 
-		log.Debug().
-			Int("batch_num", batchNum).
-			Int("total_batches", totalBatches).
-			Int("batch_size", len(batch)).
-			Msg("Processing batch")
+		wg.Add(1)
+		go func(batchIndex int, batch []string) {
+			defer wg.Done()
 
-		// Get availability for this batch
-		batchAvailabilities, err := getBusyTimesBatch(service, batch, startTime, endTime)
-		if err != nil {
-			// Log the error but continue with other batches
-			log.Warn().
-				Err(err).
+			batchNum := batchIndex + 1
+			log.Debug().
 				Int("batch_num", batchNum).
+				Int("total_batches", totalBatches).
 				Int("batch_size", len(batch)).
-				Msg("Failed to get calendar data for batch")
-			// Continue processing other batches rather than failing entirely
-			continue
-		}
+				Msg("Processing batch")
+
+			batchStarted := time.Now()
+			batchAvailabilities, attempts, err := fetcher.getBusyTimesBatch(ctx, batch, startTime, endTime)
+			defer tracker.Done(fmt.Sprintf("batch %d", batchNum), err)
+			batchReports[batchIndex] = BatchReport{
+				Number:    batchNum,
+				Emails:    batch,
+				Retrieved: len(batchAvailabilities),
+				Attempts:  attempts,
+				Duration:  time.Since(batchStarted),
+				Err:       err,
+			}
+
+			if err != nil {
+				batchReports[batchIndex].Category = categorizeFetchError(err)
+				// Log the error but continue with other batches
+				log.Warn().
+					Err(err).
+					Int("batch_num", batchNum).
+					Int("batch_size", len(batch)).
+					Str("category", batchReports[batchIndex].Category).
+					Msg("Failed to get calendar data for batch")
+				return
+			}
 
-		// Add unique results (avoid duplicates if an email appears in multiple batches)
+			batchResults[batchIndex] = batchAvailabilities
+
+			log.Debug().
+				Int("batch_num", batchNum).
+				Int("calendars_retrieved", len(batchAvailabilities)).
+				Msg("Batch completed")
+		}(batchIndex, batch)
+	}
+
+	wg.Wait()
+	tracker.Finish()
+
+	var allAvailabilities []UserAvailability
+	emailMap := make(map[string]bool) // Track which emails we've already processed
+
+	// Add unique results (avoid duplicates if an email appears in multiple batches)
+	for _, batchAvailabilities := range batchResults {
 		for _, avail := range batchAvailabilities {
 			if !emailMap[avail.Email] {
 				emailMap[avail.Email] = true
 				allAvailabilities = append(allAvailabilities, avail)
 			}
 		}
+	}
 
-		log.Debug().
-			Int("batch_num", batchNum).
-			Int("calendars_retrieved", len(batchAvailabilities)).
-			Msg("Batch completed")
+	allAvailabilities = mergeAttendeeCalendars(attendees, allAvailabilities, opts.AttendeeCalendars)
+
+	report := newFetchReport(attendees, allAvailabilities, batchReports)
+	report.Retries = int(fetcher.retries.Load())
+	report.Recovered = int(fetcher.recovered.Load())
+	report.Cached = int(fetcher.cached.Load())
+	report.Duration = time.Since(started)
+
+	for i, emailErr := range report.EmailErrors {
+		if emailErr.Category == FetchErrorNotReturned && fetcher.uncached[emailErr.Email] {
+			report.EmailErrors[i].Category = FetchErrorNotCached
+		}
+	}
+
+	if totalBatches > 1 {
+		log.Info().
+			Int("total_calendars_retrieved", len(allAvailabilities)).
+			Int("total_requested", len(attendees)).
+			Int("failed_batches", len(report.FailedBatches())).
+			Msg("Batch processing completed")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return allAvailabilities, report, fmt.Errorf("busy time fetch interrupted: %w", err)
+	}
+
+	if totalBatches > 0 && len(report.FailedBatches()) == totalBatches {
+		return allAvailabilities, report, fmt.Errorf("all %d batch(es) failed: %w", totalBatches, report.FailedBatches()[0].Err)
+	}
+
+	return allAvailabilities, report, nil
+}
+
+// getBusyTimesBatch fetches busy times for a single batch of users, serving
+// calendars from the cache when possible. It also returns the number of
+// FreeBusy attempts made for the batch.
+func (f *busyFetcher) getBusyTimesBatch(ctx context.Context, emails []string, startTime, endTime time.Time) ([]UserAvailability, int, error) {
+	byEmail := make(map[string]UserAvailability, len(emails))
+	var uncached []string
+	for _, email := range emails {
+		if avail, ok := f.cachedBusyTimes(email, startTime, endTime); ok {
+			byEmail[email] = avail
+			continue
+		}
+		uncached = append(uncached, email)
+	}
+
+	var fetched []UserAvailability
+	attempts := 0
+	if len(uncached) > 0 {
+		if f.opts.Cache.Offline() {
+			f.uncachedMutex.Lock()
+			for _, email := range uncached {
+				f.uncached[email] = true
+			}
+			f.uncachedMutex.Unlock()
+			log.Debug().Strs("emails", uncached).Msg("No cached busy data in offline mode")
+		} else {
+			var err error
+			fetched, attempts, err = f.queryBusyTimes(ctx, uncached, startTime, endTime)
+			if err != nil {
+				return nil, attempts, err
+			}
+			f.storeBusyTimes(fetched, startTime, endTime)
+		}
+	}
+
+	availabilities := make([]UserAvailability, 0, len(emails))
+	for _, avail := range fetched {
+		byEmail[avail.Email] = avail
+	}
+	for _, email := range emails {
+		if avail, ok := byEmail[email]; ok {
+			availabilities = append(availabilities, avail)
+			delete(byEmail, email)
+		}
+	}
+	// Keep any unexpected calendars the API returned, as before
+	for _, avail := range fetched {
+		if _, ok := byEmail[avail.Email]; ok {
+			availabilities = append(availabilities, avail)
+		}
+	}
+
+	f.fillTimeZones(ctx, availabilities)
+
+	return availabilities, attempts, nil
+}
+
+// cachedBusyTimes returns the cached busy data for a calendar over the exact time range
+func (f *busyFetcher) cachedBusyTimes(email string, startTime, endTime time.Time) (UserAvailability, bool) {
+	var entry cachedBusy
+	hit, err := f.opts.Cache.Get(CacheKindFreeBusy, freeBusyCacheKey(email, startTime, endTime), &entry)
+	if err != nil {
+		log.Warn().Err(err).Str("email", email).Msg("Ignoring unreadable cache entry")
+		return UserAvailability{}, false
+	}
+	if !hit {
+		return UserAvailability{}, false
 	}
 
-	log.Info().
-		Int("total_calendars_retrieved", len(allAvailabilities)).
-		Int("total_requested", len(emails)).
-		Msg("Batch processing completed")
+	f.cached.Add(1)
+	if entry.BusySlots == nil {
+		entry.BusySlots = []TimeSlot{}
+	}
+	for i := range entry.BusySlots {
+		if entry.BusySlots[i].Calendar == "" {
+			entry.BusySlots[i].Calendar = email
+		}
+	}
+	return UserAvailability{
+		Email:     email,
+		BusySlots: entry.BusySlots,
+		Status:    AvailabilityKnown,
+	}, true
+}
 
-	return allAvailabilities, nil
+// storeBusyTimes caches the known busy data of freshly fetched calendars.
+// Calendars with FreeBusy errors are not cached so the next run retries them.
+func (f *busyFetcher) storeBusyTimes(availabilities []UserAvailability, startTime, endTime time.Time) {
+	for _, avail := range availabilities {
+		if avail.IsUnknown() {
+			continue
+		}
+		if err := f.opts.Cache.Put(CacheKindFreeBusy, freeBusyCacheKey(avail.Email, startTime, endTime), cachedBusy{BusySlots: avail.BusySlots}); err != nil {
+			log.Warn().Err(err).Str("email", avail.Email).Msg("Failed to cache busy data")
+		}
+	}
+}
+
+// freeBusyCacheKey identifies a calendar's busy data for a time range
+func freeBusyCacheKey(email string, startTime, endTime time.Time) string {
+	return fmt.Sprintf("%s|%s|%s", strings.ToLower(email), startTime.UTC().Format(time.RFC3339), endTime.UTC().Format(time.RFC3339))
 }
 
-// getBusyTimesBatch fetches busy times for a single batch of users
-func getBusyTimesBatch(service *calendar.Service, emails []string, startTime, endTime time.Time) ([]UserAvailability, error) {
+// queryBusyTimes fetches busy times for the given users from the FreeBusy API.
+// It also returns the number of FreeBusy attempts made.
+func (f *busyFetcher) queryBusyTimes(ctx context.Context, emails []string, startTime, endTime time.Time) ([]UserAvailability, int, error) {
 	// Create freebusy query
 	items := make([]*calendar.FreeBusyRequestItem, len(emails))
 	for i, email := range emails {
@@ -128,58 +473,387 @@ func getBusyTimesBatch(service *calendar.Service, emails []string, startTime, en
 		}
 	}
 
-	freebusyRequest := &calendar.FreeBusyRequest{
-		TimeMin:  startTime.Format(time.RFC3339),
-		TimeMax:  endTime.Format(time.RFC3339),
-		Items:    items,
-		TimeZone: "UTC",
+	// Long searches are split into windows the FreeBusy API accepts
+	windows := splitTimeRange(startTime, endTime, f.opts.MaxWindow)
+	if len(windows) > 1 {
+		log.Debug().
+			Int("windows", len(windows)).
+			Dur("max_window", f.opts.MaxWindow).
+			Int("batch_size", len(emails)).
+			Msg("Splitting search range into FreeBusy windows")
 	}
 
-	// Execute the query
-	freebusyCall := service.Freebusy.Query(freebusyRequest)
-	response, err := freebusyCall.Do()
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve freebusy: %v", err)
+	responses := make([]*calendar.FreeBusyResponse, len(windows))
+	windowAttempts := make([]int, len(windows))
+	windowErrs := make([]error, len(windows))
+	var wg sync.WaitGroup
+
+	for i, window := range windows {
+		wg.Add(1)
+		go func(i int, window TimeSlot) {
+			defer wg.Done()
+
+			freebusyRequest := &calendar.FreeBusyRequest{
+				TimeMin:  window.Start.Format(time.RFC3339),
+				TimeMax:  window.End.Format(time.RFC3339),
+				Items:    items,
+				TimeZone: "UTC",
+			}
+
+			// Execute the query, retrying transient failures
+			windowAttempts[i], windowErrs[i] = f.call(ctx, "calendar.freebusy", func() error {
+				var callErr error
+				responses[i], callErr = f.service.Freebusy.Query(freebusyRequest).Context(ctx).Do()
+				return callErr
+			})
+		}(i, window)
 	}
 
-	// Parse results
+	wg.Wait()
+
+	attempts := 0
+	for _, windowAttempt := range windowAttempts {
+		attempts += windowAttempt
+	}
+
+	// A batch with a missing window would look free for that period, so fail it as a whole
+	for i, err := range windowErrs {
+		if err != nil {
+			if len(windows) > 1 {
+				return nil, attempts, fmt.Errorf("unable to retrieve freebusy for window %s - %s: %w",
+					windows[i].Start.Format(time.RFC3339), windows[i].End.Format(time.RFC3339), err)
+			}
+			return nil, attempts, fmt.Errorf("unable to retrieve freebusy: %w", err)
+		}
+	}
+
+	response := mergeFreeBusyResponses(responses)
+
+	// Parse results in request order; the response is keyed by calendar ID
 	var availabilities []UserAvailability
-	for email, calendar := range response.Calendars {
+	for _, email := range orderedCalendarIDs(emails, response.Calendars) {
+		calendar := response.Calendars[email]
 		userAvail := UserAvailability{
 			Email:     email,
 			BusySlots: []TimeSlot{},
+			Status:    AvailabilityKnown,
+		}
+
+		if len(calendar.Errors) > 0 {
+			userAvail.Status = AvailabilityUnknown
+			for _, calErr := range calendar.Errors {
+				if calErr == nil {
+					continue
+				}
+				userAvail.Errors = append(userAvail.Errors, CalendarError{
+					Domain: calErr.Domain,
+					Reason: calErr.Reason,
+				})
+			}
+			log.Warn().
+				Str("email", email).
+				Strs("reasons", userAvail.ErrorReasons()).
+				Msg("FreeBusy could not determine availability for calendar")
 		}
 
 		for _, busy := range calendar.Busy {
 			start, _ := time.Parse(time.RFC3339, busy.Start)
 			end, _ := time.Parse(time.RFC3339, busy.End)
 			userAvail.BusySlots = append(userAvail.BusySlots, TimeSlot{
-				Start: start,
-				End:   end,
+				Start:    start,
+				End:      end,
+				Calendar: email,
 			})
 		}
 
+		// Busy blocks crossing a window boundary come back split in two
+		if len(windows) > 1 {
+			userAvail.BusySlots = mergeBusySlots(userAvail.BusySlots)
+		}
+
 		availabilities = append(availabilities, userAvail)
 	}
 
-	// Fetch timezone for each user's calendar
+	return availabilities, attempts, nil
+}
+
+// fillTimeZones fetches the timezone for each user's calendar concurrently
+func (f *busyFetcher) fillTimeZones(ctx context.Context, availabilities []UserAvailability) {
+	var wg sync.WaitGroup
+
 	for i := range availabilities {
-		tz, err := getCalendarTimeZone(service, availabilities[i].Email)
+		// Calendars FreeBusy could not read won't expose their settings either,
+		// and additional calendars follow their attendee's timezone
+		if availabilities[i].IsUnknown() || f.extra[availabilities[i].Email] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(avail *UserAvailability) {
+			defer wg.Done()
+
+			tz, err := f.getCalendarTimeZone(ctx, avail.Email)
+			if err != nil {
+				// If we can't get timezone, assume the default timezone from the query
+				// This might happen for external calendars or permission issues
+				tz = time.UTC
+			}
+			avail.TimeZone = tz
+		}(&availabilities[i])
+	}
+
+	wg.Wait()
+}
+
+// expandAttendeeCalendars returns the attendees followed by their additional calendar IDs,
+// without duplicates, and the set of additional IDs that are not attendees themselves
+func expandAttendeeCalendars(attendees []string, attendeeCalendars map[string][]string) ([]string, map[string]bool) {
+	if len(attendeeCalendars) == 0 {
+		return attendees, nil
+	}
+
+	ids := make([]string, 0, len(attendees))
+	seen := make(map[string]bool, len(attendees))
+	for _, email := range attendees {
+		if !seen[email] {
+			seen[email] = true
+			ids = append(ids, email)
+		}
+	}
+
+	extra := make(map[string]bool)
+	for _, email := range attendees {
+		for _, id := range attendeeCalendars[strings.ToLower(email)] {
+			if !seen[id] {
+				seen[id] = true
+				extra[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, extra
+}
+
+// mergeAttendeeCalendars folds the busy slots of additional calendars into their attendees'
+// availability and drops the additional entries. An additional calendar that cannot be read
+// is skipped with a warning; the attendee's status follows their primary calendar.
+func mergeAttendeeCalendars(attendees []string, availabilities []UserAvailability, attendeeCalendars map[string][]string) []UserAvailability {
+	if len(attendeeCalendars) == 0 {
+		return availabilities
+	}
+
+	byID := make(map[string]UserAvailability, len(availabilities))
+	for _, avail := range availabilities {
+		byID[avail.Email] = avail
+	}
+
+	isAttendee := make(map[string]bool, len(attendees))
+	for _, email := range attendees {
+		isAttendee[email] = true
+	}
+
+	merged := make([]UserAvailability, 0, len(attendees))
+	for _, avail := range availabilities {
+		if !isAttendee[avail.Email] {
+			continue
+		}
+
+		ids := attendeeCalendars[strings.ToLower(avail.Email)]
+		if len(ids) > 0 {
+			busy := append([]TimeSlot{}, avail.BusySlots...)
+			for _, id := range ids {
+				extra, ok := byID[id]
+				if !ok || extra.IsUnknown() {
+					log.Warn().
+						Str("email", avail.Email).
+						Str("calendar", id).
+						Strs("reasons", extra.ErrorReasons()).
+						Msg("Could not read additional calendar; ignoring it")
+					continue
+				}
+				busy = append(busy, extra.BusySlots...)
+			}
+			sort.SliceStable(busy, func(i, j int) bool {
+				return busy[i].Start.Before(busy[j].Start)
+			})
+			avail.BusySlots = busy
+		}
+
+		merged = append(merged, avail)
+	}
+
+	return merged
+}
+
+// DiscoverAttendeeCalendars looks for additional calendars owned by attendees in the signed-in
+// user's calendar list. Other users' calendar lists are not readable, so only calendars the
+// signed-in user owns (besides their primary one) can be discovered, and only when they are
+// an attendee themselves.
+func DiscoverAttendeeCalendars(ctx context.Context, service *calendar.Service, attendees []string, retrier *retry.Retrier) (map[string][]string, error) {
+	var entries []*calendar.CalendarListEntry
+	pageToken := ""
+	for {
+		var list *calendar.CalendarList
+		err := retrier.Do(ctx, "calendar.calendar_list", func() error {
+			call := service.CalendarList.List().MinAccessRole("owner").Context(ctx)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+			var callErr error
+			list, callErr = call.Do()
+			return callErr
+		})
 		if err != nil {
-			// If we can't get timezone, assume the default timezone from the query
-			// This might happen for external calendars or permission issues
-			tz = time.UTC
+			return nil, fmt.Errorf("unable to list calendars: %w", err)
+		}
+		entries = append(entries, list.Items...)
+		if list.NextPageToken == "" {
+			break
+		}
+		pageToken = list.NextPageToken
+	}
+
+	owner := ""
+	for _, entry := range entries {
+		if entry.Primary {
+			owner = strings.ToLower(entry.Id)
+			break
+		}
+	}
+
+	discovered := make(map[string][]string)
+	attending := false
+	for _, email := range attendees {
+		if strings.ToLower(email) == owner {
+			attending = true
+			break
+		}
+	}
+	if owner == "" || !attending {
+		return discovered, nil
+	}
+
+	for _, entry := range entries {
+		if entry.Primary || entry.Deleted || entry.Hidden {
+			continue
+		}
+		// Holiday and birthday calendars are generated, not personal commitments
+		if strings.HasSuffix(entry.Id, "@group.v.calendar.google.com") {
+			continue
+		}
+		discovered[owner] = append(discovered[owner], entry.Id)
+	}
+
+	return discovered, nil
+}
+
+// splitTimeRange splits [start, end) into consecutive windows no longer than maxWindow
+func splitTimeRange(start, end time.Time, maxWindow time.Duration) []TimeSlot {
+	if maxWindow <= 0 || !end.After(start) {
+		return []TimeSlot{{Start: start, End: end}}
+	}
+
+	var windows []TimeSlot
+	for windowStart := start; windowStart.Before(end); windowStart = windowStart.Add(maxWindow) {
+		windowEnd := windowStart.Add(maxWindow)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		windows = append(windows, TimeSlot{Start: windowStart, End: windowEnd})
+	}
+	return windows
+}
+
+// mergeFreeBusyResponses combines per-window responses into a single calendar map
+func mergeFreeBusyResponses(responses []*calendar.FreeBusyResponse) *calendar.FreeBusyResponse {
+	if len(responses) == 1 {
+		return responses[0]
+	}
+
+	merged := &calendar.FreeBusyResponse{Calendars: make(map[string]calendar.FreeBusyCalendar)}
+	for _, response := range responses {
+		if response == nil {
+			continue
+		}
+		for id, cal := range response.Calendars {
+			combined := merged.Calendars[id]
+			combined.Busy = append(combined.Busy, cal.Busy...)
+			combined.Errors = append(combined.Errors, cal.Errors...)
+			merged.Calendars[id] = combined
+		}
+	}
+	return merged
+}
+
+// mergeBusySlots sorts busy slots and collapses overlapping or touching ones
+func mergeBusySlots(slots []TimeSlot) []TimeSlot {
+	if len(slots) < 2 {
+		return slots
+	}
+
+	sorted := make([]TimeSlot, len(slots))
+	copy(sorted, slots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	merged := []TimeSlot{sorted[0]}
+	for _, slot := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if !slot.Start.After(last.End) {
+			if slot.End.After(last.End) {
+				last.End = slot.End
+			}
+			continue
+		}
+		merged = append(merged, slot)
+	}
+	return merged
+}
+
+// orderedCalendarIDs returns the response keys following the requested order,
+// with any unexpected extra keys appended in sorted order
+func orderedCalendarIDs(requested []string, calendars map[string]calendar.FreeBusyCalendar) []string {
+	ids := make([]string, 0, len(calendars))
+	seen := make(map[string]bool, len(calendars))
+	for _, email := range requested {
+		if _, ok := calendars[email]; ok && !seen[email] {
+			seen[email] = true
+			ids = append(ids, email)
+		}
+	}
+
+	var extra []string
+	for id := range calendars {
+		if !seen[id] {
+			extra = append(extra, id)
 		}
-		availabilities[i].TimeZone = tz
 	}
+	sort.Strings(extra)
 
-	return availabilities, nil
+	return append(ids, extra...)
 }
 
-// getCalendarTimeZone fetches the timezone for a specific calendar
-func getCalendarTimeZone(service *calendar.Service, email string) (*time.Location, error) {
+// getCalendarTimeZone fetches the timezone for a specific calendar, using the cache when available
+func (f *busyFetcher) getCalendarTimeZone(ctx context.Context, email string) (*time.Location, error) {
+	var name string
+	if hit, err := f.opts.Cache.Get(CacheKindTimeZone, strings.ToLower(email), &name); err == nil && hit {
+		if loc, loadErr := time.LoadLocation(name); loadErr == nil {
+			return loc, nil
+		}
+	}
+	if f.opts.Cache.Offline() {
+		return nil, fmt.Errorf("no cached timezone for %s", email)
+	}
+
 	// Try to get the calendar settings
-	cal, err := service.Calendars.Get(email).Do()
+	var cal *calendar.Calendar
+	_, err := f.call(ctx, "calendar.calendars_get", func() error {
+		var callErr error
+		cal, callErr = f.service.Calendars.Get(email).Context(ctx).Do()
+		return callErr
+	})
 	if err != nil {
 		// If we can't access the calendar (e.g., external user), return error
 		return nil, err
@@ -191,6 +865,10 @@ func getCalendarTimeZone(service *calendar.Service, email string) (*time.Locatio
 		return nil, fmt.Errorf("invalid timezone %s: %v", cal.TimeZone, err)
 	}
 
+	if err := f.opts.Cache.Put(CacheKindTimeZone, strings.ToLower(email), cal.TimeZone); err != nil {
+		log.Warn().Err(err).Str("email", email).Msg("Failed to cache calendar timezone")
+	}
+
 	return loc, nil
 }
 
@@ -324,17 +1002,25 @@ func GetUserWorkingHours(startDate, endDate time.Time, startHour, endHour, lunch
 }
 
 // ValidateCalendarAccess checks which emails have accessible calendars
-func ValidateCalendarAccess(service *calendar.Service, emails []string) []CalendarAccessResult {
+func ValidateCalendarAccess(ctx context.Context, service *calendar.Service, emails []string) []CalendarAccessResult {
 	results := make([]CalendarAccessResult, 0, len(emails))
+	retrier := retry.Default()
 
 	for _, email := range emails {
+		if ctx.Err() != nil {
+			break
+		}
+
 		result := CalendarAccessResult{
 			Email:     email,
 			HasAccess: false,
 		}
 
 		// Try to get the calendar to check access
-		_, err := service.Calendars.Get(email).Do()
+		err := retrier.Do(ctx, "calendar.calendars_get", func() error {
+			_, callErr := service.Calendars.Get(email).Context(ctx).Do()
+			return callErr
+		})
 		if err != nil {
 			result.Error = err
 			result.ErrorReason = categorizeCalendarError(err)
@@ -349,6 +1035,17 @@ func ValidateCalendarAccess(service *calendar.Service, emails []string) []Calend
 	return results
 }
 
+// GetUnknownAvailabilities returns the attendees whose calendars reported FreeBusy errors
+func GetUnknownAvailabilities(availabilities []UserAvailability) []UserAvailability {
+	var unknown []UserAvailability
+	for _, avail := range availabilities {
+		if avail.IsUnknown() {
+			unknown = append(unknown, avail)
+		}
+	}
+	return unknown
+}
+
 // GetMissingCalendars identifies which requested emails don't have calendar data in the response
 func GetMissingCalendars(requestedEmails []string, availabilities []UserAvailability) []string {
 	// Create a map of emails that returned data
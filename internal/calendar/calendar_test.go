@@ -0,0 +1,443 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func jsonResponse(t *testing.T, status int, body interface{}) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(string(data))),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func newTestService(t *testing.T, rt roundTripFunc) *calendar.Service {
+	t.Helper()
+	svc, err := calendar.NewService(context.Background(),
+		option.WithHTTPClient(&http.Client{Transport: rt}),
+		option.WithEndpoint("https://calendar.test/"),
+	)
+	if err != nil {
+		t.Fatalf("create calendar service: %v", err)
+	}
+	return svc
+}
+
+// fakeCalendarAPI answers FreeBusy queries with one busy slot per calendar and
+// Calendars.Get with a fixed timezone, tracking the peak number of concurrent calls.
+type fakeCalendarAPI struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (f *fakeCalendarAPI) roundTrip(t *testing.T) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		f.mu.Lock()
+		f.inFlight++
+		if f.inFlight > f.peak {
+			f.peak = f.inFlight
+		}
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			f.inFlight--
+			f.mu.Unlock()
+		}()
+
+		// Give other goroutines a chance to overlap
+		time.Sleep(5 * time.Millisecond)
+
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/freeBusy"):
+			var fbReq calendar.FreeBusyRequest
+			if err := json.NewDecoder(req.Body).Decode(&fbReq); err != nil {
+				t.Errorf("decode freebusy request: %v", err)
+			}
+			for _, item := range fbReq.Items {
+				if strings.HasPrefix(item.Id, "forbidden") {
+					return jsonResponse(t, http.StatusForbidden, map[string]interface{}{
+						"error": map[string]interface{}{"code": 403, "message": "Forbidden"},
+					}), nil
+				}
+			}
+			calendars := make(map[string]calendar.FreeBusyCalendar)
+			for _, item := range fbReq.Items {
+				if strings.HasPrefix(item.Id, "allday") {
+					// Busy for the whole query window, as the API clips events to it
+					calendars[item.Id] = calendar.FreeBusyCalendar{
+						Busy: []*calendar.TimePeriod{{Start: fbReq.TimeMin, End: fbReq.TimeMax}},
+					}
+					continue
+				}
+				if strings.HasPrefix(item.Id, "missing") {
+					calendars[item.Id] = calendar.FreeBusyCalendar{
+						Errors: []*calendar.Error{{Domain: "global", Reason: "notFound"}},
+					}
+					continue
+				}
+				calendars[item.Id] = calendar.FreeBusyCalendar{
+					Busy: []*calendar.TimePeriod{{
+						Start: "2024-01-15T10:00:00Z",
+						End:   "2024-01-15T11:00:00Z",
+					}},
+				}
+			}
+			return jsonResponse(t, http.StatusOK, calendar.FreeBusyResponse{Calendars: calendars}), nil
+		case strings.Contains(req.URL.Path, "/calendars/"):
+			return jsonResponse(t, http.StatusOK, calendar.Calendar{TimeZone: "Europe/Paris"}), nil
+		}
+
+		t.Errorf("unexpected request to %s", req.URL)
+		return jsonResponse(t, http.StatusNotFound, map[string]string{}), nil
+	}
+}
+
+func TestGetBusyTimesWithOptionsKeepsRequestOrder(t *testing.T) {
+	api := &fakeCalendarAPI{}
+	svc := newTestService(t, api.roundTrip(t))
+
+	var emails []string
+	for i := 0; i < 23; i++ {
+		emails = append(emails, fmt.Sprintf("user%02d@example.com", i))
+	}
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	availabilities, report, err := GetBusyTimesWithOptions(context.Background(), svc, emails, start, end, FetchOptions{
+		BatchSize:   5,
+		Concurrency: 3,
+		Limiter:     rate.NewLimiter(rate.Inf, 1),
+	})
+	if err != nil {
+		t.Fatalf("get busy times: %v", err)
+	}
+
+	if len(availabilities) != len(emails) {
+		t.Fatalf("expected %d availabilities, got %d", len(emails), len(availabilities))
+	}
+
+	for i, avail := range availabilities {
+		if avail.Email != emails[i] {
+			t.Fatalf("position %d: expected %s, got %s", i, emails[i], avail.Email)
+		}
+		if len(avail.BusySlots) != 1 {
+			t.Fatalf("%s: expected 1 busy slot, got %d", avail.Email, len(avail.BusySlots))
+		}
+		if avail.TimeZone == nil || avail.TimeZone.String() != "Europe/Paris" {
+			t.Fatalf("%s: expected Europe/Paris timezone, got %v", avail.Email, avail.TimeZone)
+		}
+	}
+
+	if !report.Complete() || len(report.Batches) != 5 || report.Retrieved != len(emails) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if api.peak > 3 {
+		t.Fatalf("expected at most %d concurrent calls, observed %d", 3, api.peak)
+	}
+	if api.peak < 2 {
+		t.Fatalf("expected calls to run concurrently, observed peak of %d", api.peak)
+	}
+}
+
+func TestGetBusyTimesFlagsCalendarErrors(t *testing.T) {
+	api := &fakeCalendarAPI{}
+	svc := newTestService(t, api.roundTrip(t))
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	emails := []string{"alice@example.com", "missing@example.com"}
+
+	availabilities, report, err := GetBusyTimesWithOptions(context.Background(), svc, emails, start, start.Add(24*time.Hour), FetchOptions{
+		Limiter: rate.NewLimiter(rate.Inf, 1),
+	})
+	if err != nil {
+		t.Fatalf("get busy times: %v", err)
+	}
+
+	if len(availabilities) != 2 {
+		t.Fatalf("expected 2 availabilities, got %d", len(availabilities))
+	}
+
+	if availabilities[0].IsUnknown() {
+		t.Fatalf("expected alice to have known availability")
+	}
+
+	missing := availabilities[1]
+	if !missing.IsUnknown() {
+		t.Fatalf("expected missing@example.com to be flagged as unknown")
+	}
+	if reasons := missing.ErrorReasons(); len(reasons) != 1 || reasons[0] != "notFound" {
+		t.Fatalf("expected notFound reason, got %v", reasons)
+	}
+	if missing.TimeZone != nil {
+		t.Fatalf("expected no timezone lookup for unknown calendar, got %v", missing.TimeZone)
+	}
+
+	unknown := GetUnknownAvailabilities(availabilities)
+	if len(unknown) != 1 || unknown[0].Email != "missing@example.com" {
+		t.Fatalf("unexpected unknown availabilities: %+v", unknown)
+	}
+
+	if len(report.EmailErrors) != 1 || report.EmailErrors[0].Category != FetchErrorCalendarError {
+		t.Fatalf("expected calendar_error for missing@example.com, got %+v", report.EmailErrors)
+	}
+}
+
+func TestGetBusyTimesReportsFailedBatches(t *testing.T) {
+	api := &fakeCalendarAPI{}
+	svc := newTestService(t, api.roundTrip(t))
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	emails := []string{"alice@example.com", "bob@example.com", "forbidden@example.com", "carol@example.com"}
+
+	var events []progress.Event
+	var eventsMu sync.Mutex
+	availabilities, report, err := GetBusyTimesWithOptions(context.Background(), svc, emails, start, start.Add(24*time.Hour), FetchOptions{
+		BatchSize: 2,
+		Limiter:   rate.NewLimiter(rate.Inf, 1),
+		Progress: progress.Func(func(event progress.Event) {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			events = append(events, event)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("expected partial success, got %v", err)
+	}
+
+	// Start, one event per batch, then the final one
+	last := events[len(events)-1]
+	if len(events) != 4 || !last.Finished || last.Stage != progress.StageBatches || last.Done != 2 || last.Failed != 1 || last.Total != 2 {
+		t.Fatalf("unexpected progress events: %+v", events)
+	}
+
+	if len(availabilities) != 2 {
+		t.Fatalf("expected 2 availabilities from the healthy batch, got %d", len(availabilities))
+	}
+
+	failed := report.FailedBatches()
+	if len(failed) != 1 || failed[0].Number != 2 || failed[0].Category != "permission_denied" {
+		t.Fatalf("unexpected failed batches: %+v", failed)
+	}
+
+	missing := report.MissingEmails()
+	if len(missing) != 2 || missing[0] != "forbidden@example.com" || missing[1] != "carol@example.com" {
+		t.Fatalf("unexpected missing emails: %v", missing)
+	}
+	if report.Complete() {
+		t.Fatalf("expected report to be incomplete")
+	}
+}
+
+func TestGetBusyTimesSplitsLongRanges(t *testing.T) {
+	var windows []string
+	var mu sync.Mutex
+	api := &fakeCalendarAPI{}
+	inner := api.roundTrip(t)
+	svc := newTestService(t, func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, "/freeBusy") {
+			body, _ := io.ReadAll(req.Body)
+			var fbReq calendar.FreeBusyRequest
+			_ = json.Unmarshal(body, &fbReq)
+			mu.Lock()
+			windows = append(windows, fbReq.TimeMin)
+			mu.Unlock()
+			req.Body = io.NopCloser(strings.NewReader(string(body)))
+		}
+		return inner(req)
+	})
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(72*time.Hour + 6*time.Hour)
+
+	availabilities, _, err := GetBusyTimesWithOptions(context.Background(), svc, []string{"allday@example.com"}, start, end, FetchOptions{
+		Limiter:   rate.NewLimiter(rate.Inf, 1),
+		MaxWindow: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("get busy times: %v", err)
+	}
+
+	if len(windows) != 4 {
+		t.Fatalf("expected 4 FreeBusy windows, got %d (%v)", len(windows), windows)
+	}
+
+	if len(availabilities) != 1 {
+		t.Fatalf("expected 1 availability, got %d", len(availabilities))
+	}
+
+	busy := availabilities[0].BusySlots
+	if len(busy) != 1 {
+		t.Fatalf("expected window-spanning busy blocks to merge into 1 slot, got %d: %+v", len(busy), busy)
+	}
+	if !busy[0].Start.Equal(start) || !busy[0].End.Equal(end) {
+		t.Fatalf("expected merged slot %s - %s, got %s - %s", start, end, busy[0].Start, busy[0].End)
+	}
+}
+
+func TestGetBusyTimesUsesCache(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	api := &fakeCalendarAPI{}
+	inner := api.roundTrip(t)
+	svc := newTestService(t, func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return inner(req)
+	})
+
+	dir := t.TempDir()
+	store, err := cache.New(dir, time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	emails := []string{"alice@example.com", "missing@example.com"}
+	opts := FetchOptions{Limiter: rate.NewLimiter(rate.Inf, 1), Cache: store}
+
+	if _, _, err := GetBusyTimesWithOptions(context.Background(), svc, emails, start, end, opts); err != nil {
+		t.Fatalf("get busy times: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected a FreeBusy and a timezone call, got %d", calls)
+	}
+
+	// Offline: alice is served from the cache, missing@ was never cached
+	offline, err := cache.New(dir, time.Hour, cache.ModeOffline)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	opts.Cache = offline
+
+	availabilities, report, err := GetBusyTimesWithOptions(context.Background(), nil, emails, start, end, opts)
+	if err != nil {
+		t.Fatalf("get busy times offline: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected no API calls in offline mode, got %d", calls-2)
+	}
+	if len(availabilities) != 1 || availabilities[0].Email != "alice@example.com" || len(availabilities[0].BusySlots) != 1 {
+		t.Fatalf("unexpected cached availabilities: %+v", availabilities)
+	}
+	if availabilities[0].TimeZone == nil || availabilities[0].TimeZone.String() != "Europe/Paris" {
+		t.Fatalf("expected cached Europe/Paris timezone, got %v", availabilities[0].TimeZone)
+	}
+	if report.Cached != 1 || len(report.EmailErrors) != 1 || report.EmailErrors[0].Category != FetchErrorNotCached {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestGetBusyTimesMergesAttendeeCalendars(t *testing.T) {
+	var timezoneLookups []string
+	var mu sync.Mutex
+	api := &fakeCalendarAPI{}
+	inner := api.roundTrip(t)
+	svc := newTestService(t, func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/calendars/") {
+			mu.Lock()
+			timezoneLookups = append(timezoneLookups, req.URL.Path)
+			mu.Unlock()
+		}
+		return inner(req)
+	})
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	emails := []string{"alice@example.com", "bob@example.com"}
+
+	availabilities, report, err := GetBusyTimesWithOptions(context.Background(), svc, emails, start, start.Add(24*time.Hour), FetchOptions{
+		BatchSize: 2,
+		Limiter:   rate.NewLimiter(rate.Inf, 1),
+		AttendeeCalendars: map[string][]string{
+			"alice@example.com": {"oncall@group.calendar.google.com", "missing-personal@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("get busy times: %v", err)
+	}
+
+	if len(availabilities) != 2 || availabilities[0].Email != "alice@example.com" || availabilities[1].Email != "bob@example.com" {
+		t.Fatalf("expected only attendees in request order, got %+v", availabilities)
+	}
+
+	alice := availabilities[0]
+	if alice.IsUnknown() {
+		t.Fatalf("an unreadable additional calendar must not make alice unknown")
+	}
+	if len(alice.BusySlots) != 2 {
+		t.Fatalf("expected busy slots from 2 calendars, got %+v", alice.BusySlots)
+	}
+	sources := map[string]bool{}
+	for _, slot := range alice.BusySlots {
+		sources[slot.Calendar] = true
+	}
+	if !sources["alice@example.com"] || !sources["oncall@group.calendar.google.com"] {
+		t.Fatalf("expected slots attributed to both calendars, got %+v", alice.BusySlots)
+	}
+
+	if len(timezoneLookups) != 2 {
+		t.Fatalf("expected timezone lookups for attendees only, got %v", timezoneLookups)
+	}
+	if !report.Complete() || report.Requested != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestGetBusyTimesStopsWhenCanceled(t *testing.T) {
+	api := &fakeCalendarAPI{}
+	svc := newTestService(t, api.roundTrip(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	emails := []string{"alice@example.com", "bob@example.com"}
+
+	_, report, err := GetBusyTimesWithOptions(ctx, svc, emails, start, start.Add(24*time.Hour), FetchOptions{
+		BatchSize: 1,
+		Limiter:   rate.NewLimiter(rate.Inf, 1),
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if report == nil || len(report.EmailErrors) != len(emails) {
+		t.Fatalf("expected every attendee to be reported, got %+v", report)
+	}
+	for _, emailErr := range report.EmailErrors {
+		if emailErr.Category != FetchErrorCanceled {
+			t.Fatalf("expected %s for %s, got %s", FetchErrorCanceled, emailErr.Email, emailErr.Category)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Per-email fetch error categories reported in a FetchReport
+const (
+	FetchErrorNotReturned   = "not_returned"   // FreeBusy succeeded but did not include the calendar
+	FetchErrorCalendarError = "calendar_error" // FreeBusy reported a per-calendar error (see Detail)
+	FetchErrorRateLimited   = "rate_limited"   // The batch exhausted its retries on 429/quota errors
+	FetchErrorServerError   = "server_error"   // The batch exhausted its retries on 5xx errors
+	FetchErrorNotCached     = "not_cached"     // Offline mode and the calendar has no cached busy data
+	FetchErrorCanceled      = "canceled"       // The fetch was interrupted or timed out before the batch finished
+)
+
+// BatchReport describes the outcome of a single FreeBusy batch
+type BatchReport struct {
+	Number    int
+	Emails    []string
+	Retrieved int
+	Attempts  int
+	Duration  time.Duration
+	Err       error
+	Category  string // Error category when Err is set
+}
+
+// EmailFetchError explains why an attendee has no usable availability data
+type EmailFetchError struct {
+	Email    string
+	Category string
+	Detail   string
+}
+
+// FetchReport summarizes how complete a busy-time fetch was
+type FetchReport struct {
+	Requested   int
+	Retrieved   int // Calendars with known availability
+	Batches     []BatchReport
+	EmailErrors []EmailFetchError // In requested order
+	Retries     int               // Retries across FreeBusy and timezone calls
+	Recovered   int               // Calls that succeeded only after retrying
+	Cached      int               // Calendars served from the on-disk cache
+	Duration    time.Duration
+}
+
+// FailedBatches returns the batches whose FreeBusy request failed
+func (r *FetchReport) FailedBatches() []BatchReport {
+	if r == nil {
+		return nil
+	}
+	var failed []BatchReport
+	for _, batch := range r.Batches {
+		if batch.Err != nil {
+			failed = append(failed, batch)
+		}
+	}
+	return failed
+}
+
+// MissingEmails returns every requested email without usable availability data
+func (r *FetchReport) MissingEmails() []string {
+	if r == nil {
+		return nil
+	}
+	missing := make([]string, 0, len(r.EmailErrors))
+	for _, emailErr := range r.EmailErrors {
+		missing = append(missing, emailErr.Email)
+	}
+	return missing
+}
+
+// Complete reports whether every requested attendee has known availability
+func (r *FetchReport) Complete() bool {
+	return r == nil || len(r.EmailErrors) == 0
+}
+
+// newFetchReport builds a report from the requested emails, merged results and batch outcomes
+func newFetchReport(emails []string, availabilities []UserAvailability, batches []BatchReport) *FetchReport {
+	report := &FetchReport{
+		Requested: len(emails),
+		Batches:   batches,
+	}
+
+	byEmail := make(map[string]UserAvailability, len(availabilities))
+	for _, avail := range availabilities {
+		byEmail[avail.Email] = avail
+		if !avail.IsUnknown() {
+			report.Retrieved++
+		}
+	}
+
+	failedBatchFor := make(map[string]BatchReport)
+	for _, batch := range batches {
+		if batch.Err == nil {
+			continue
+		}
+		for _, email := range batch.Emails {
+			failedBatchFor[email] = batch
+		}
+	}
+
+	seen := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+
+		if avail, ok := byEmail[email]; ok {
+			if avail.IsUnknown() {
+				report.EmailErrors = append(report.EmailErrors, EmailFetchError{
+					Email:    email,
+					Category: FetchErrorCalendarError,
+					Detail:   strings.Join(avail.ErrorReasons(), ", "),
+				})
+			}
+			continue
+		}
+
+		if batch, ok := failedBatchFor[email]; ok {
+			report.EmailErrors = append(report.EmailErrors, EmailFetchError{
+				Email:    email,
+				Category: batch.Category,
+				Detail:   batch.Err.Error(),
+			})
+			continue
+		}
+
+		report.EmailErrors = append(report.EmailErrors, EmailFetchError{
+			Email:    email,
+			Category: FetchErrorNotReturned,
+		})
+	}
+
+	return report
+}
+
+// categorizeFetchError classifies a failed FreeBusy batch
+func categorizeFetchError(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return FetchErrorCanceled
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			return FetchErrorRateLimited
+		case apiErr.Code >= 500:
+			return FetchErrorServerError
+		case apiErr.Code == http.StatusForbidden:
+			for _, item := range apiErr.Errors {
+				if strings.Contains(item.Reason, "RateLimit") || strings.Contains(item.Reason, "rateLimit") || item.Reason == "quotaExceeded" {
+					return FetchErrorRateLimited
+				}
+			}
+		}
+	}
+	return categorizeCalendarError(err)
+}
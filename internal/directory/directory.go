@@ -1,11 +1,18 @@
 package directory
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/retry"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
 	directory "google.golang.org/api/admin/directory/v1"
 )
 
@@ -52,6 +59,8 @@ type ResolutionResult struct {
 	PartialFailure     bool             // True if some nested groups failed to resolve
 	FailedNestedGroups map[string]error // Track which nested groups failed
 	CircularGroups     []string         // List of groups involved in circular references
+	Excluded           []ExcludedMember // Members left out by ResolveOptions.Filter, sorted by email
+	Selector           string           // Selector kind when OriginalEmail is an org selector (see ParseSelector)
 }
 
 // ResolutionSummary contains details about the mailing list resolution process
@@ -65,33 +74,314 @@ type ResolutionSummary struct {
 	MaxDepthReached   int // Maximum nesting depth encountered
 	CircularRefsFound int // Number of circular references detected
 	NestedGroupsTotal int // Total number of nested groups found
+	CachedLists       int // Member lists served from the cache instead of the Directory API
+	ExcludedMembers   int // Distinct members left out by ResolveOptions.Filter and not attending otherwise
 }
 
-// groupResolutionContext tracks state during recursive group resolution
+// groupResolutionContext tracks state while one top-level group is expanded.
+// Sibling groups are expanded concurrently, so fields are guarded by mu until finish
+// derives the scheduling-independent results (depth, circular references).
 type groupResolutionContext struct {
-	visitedGroups     map[string]bool   // Track visited groups (normalized) to detect circular references
-	memberEmails      map[string]string // normalized -> original email for deduplication
-	nestedGroups      map[string]string // normalized -> original nested group email
-	maxDepth          int               // Maximum depth reached
-	currentPath       []string          // Current path for circular reference detection (original casing)
-	failedGroups      map[string]error  // Track groups that failed to resolve
+	mu            sync.Mutex
+	rootEmail     string                    // Top-level group being expanded
+	visitedGroups map[string]bool           // Groups (normalized) already claimed for expansion
+	memberEmails  map[string]string         // normalized -> original email for deduplication
+	nestedGroups  map[string]string         // normalized -> original nested group email
+	notGroups     map[string]bool           // Nested entries (normalized) that turned out not to be groups
+	edges         map[string][]string       // normalized group -> normalized group-like members it lists
+	failedGroups  map[string]error          // Track groups that failed to resolve
+	excluded      map[string]ExcludedMember // normalized email + group -> member left out by the filter
+
+	// Set by finish once expansion is complete
+	maxDepth          int               // Deepest nesting level, counted along the path each group was first expanded from
 	circularRefs      map[string]string // normalized -> original group involved in circular references
 	hasPartialFailure bool              // True if any nested group failed
+	exclusions        []ExcludedMember  // Excluded members not kept through another group, sorted
+}
+
+func newGroupResolutionContext(rootEmail string) *groupResolutionContext {
+	return &groupResolutionContext{
+		rootEmail:     rootEmail,
+		visitedGroups: make(map[string]bool),
+		memberEmails:  make(map[string]string),
+		nestedGroups:  make(map[string]string),
+		notGroups:     make(map[string]bool),
+		edges:         make(map[string][]string),
+		failedGroups:  make(map[string]error),
+		excluded:      make(map[string]ExcludedMember),
+		circularRefs:  make(map[string]string),
+	}
+}
+
+// claim marks a group as visited, returning false when another branch already expands it
+func (c *groupResolutionContext) claim(groupEmail string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeEmail(groupEmail)
+	if c.visitedGroups[key] {
+		return false
+	}
+	c.visitedGroups[key] = true
+	return true
+}
+
+// keepOriginal stores email under its normalized key. When casings differ, the
+// smallest spelling wins so the outcome doesn't depend on which branch came first.
+func keepOriginal(m map[string]string, email string) {
+	key := normalizeEmail(email)
+	if existing, ok := m[key]; !ok || email < existing {
+		m[key] = email
+	}
+}
+
+func (c *groupResolutionContext) addMember(email string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keepOriginal(c.memberEmails, email)
+}
+
+// addGroupMembers records the group-like members listed by parent
+func (c *groupResolutionContext) addGroupMembers(parent string, groups []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	children := make([]string, 0, len(groups))
+	for _, group := range groups {
+		keepOriginal(c.nestedGroups, group)
+		children = append(children, normalizeEmail(group))
+	}
+	c.edges[normalizeEmail(parent)] = children
+}
+
+// addReports records the direct reports of manager, followed like nested groups
+func (c *groupResolutionContext) addReports(manager string, reports []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	children := make([]string, 0, len(reports))
+	for _, report := range reports {
+		children = append(children, normalizeEmail(report))
+	}
+	c.edges[normalizeEmail(manager)] = children
+}
+
+// exclude records a member of group left out by the filter
+func (c *groupResolutionContext) exclude(member ExcludedMember) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeEmail(member.Email) + "\x00" + normalizeEmail(member.Group)
+	if existing, ok := c.excluded[key]; !ok || member.Email < existing.Email {
+		c.excluded[key] = member
+	}
+}
+
+func (c *groupResolutionContext) markNotGroup(email string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notGroups[normalizeEmail(email)] = true
+}
+
+func (c *groupResolutionContext) fail(email string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failedGroups[email] = err
+}
+
+// finish turns the recorded membership graph into the final results. Every reachable
+// group is listed exactly once whatever the scheduling, so the graph, and therefore
+// depth and circular references computed from it, are deterministic.
+func (c *groupResolutionContext) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Entries that aren't groups are plain members
+	for key := range c.notGroups {
+		if original, ok := c.nestedGroups[key]; ok {
+			keepOriginal(c.memberEmails, original)
+			delete(c.nestedGroups, key)
+		}
+	}
+	c.hasPartialFailure = len(c.failedGroups) > 0
+
+	// A member excluded from one group may still be kept through another
+	root := normalizeEmail(c.rootEmail)
+	for _, member := range c.excluded {
+		if _, kept := c.memberEmails[normalizeEmail(member.Email)]; kept {
+			continue
+		}
+		if group := normalizeEmail(member.Group); group == root {
+			member.Group = c.rootEmail
+		} else if original, ok := c.nestedGroups[group]; ok {
+			member.Group = original
+		}
+		c.exclusions = append(c.exclusions, member)
+	}
+	sortExcluded(c.exclusions)
+
+	// Depth is counted as a one-at-a-time expansion in listing order would reach each entry:
+	// a group's nested entries are one level below where the group was first expanded
+	expanded := make(map[string]bool)
+	var expand func(group string, depth int)
+	expand = func(group string, depth int) {
+		if depth > c.maxDepth {
+			c.maxDepth = depth
+		}
+		if expanded[group] {
+			return
+		}
+		expanded[group] = true
+		for _, child := range c.edges[group] {
+			expand(child, depth+1)
+		}
+	}
+	expand(root, 0)
+
+	// A group is part of a cycle when it can reach itself through its nested groups
+	groups := make([]string, 0, len(expanded))
+	for group := range expanded {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if c.reaches(group, group) {
+			original, ok := c.nestedGroups[group]
+			if group == root {
+				original = c.rootEmail
+			} else if !ok {
+				original = group
+			}
+			c.circularRefs[group] = original
+			log.Warn().
+				Str("group", original).
+				Str("root_group", c.rootEmail).
+				Msg("Circular reference detected in nested groups")
+		}
+	}
+}
+
+// reaches reports whether target can be reached from the nested groups of from
+func (c *groupResolutionContext) reaches(from, target string) bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), c.edges[from]...)
+	for len(stack) > 0 {
+		group := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if group == target {
+			return true
+		}
+		if seen[group] || c.notGroups[group] {
+			continue
+		}
+		seen[group] = true
+		stack = append(stack, c.edges[group]...)
+	}
+	return false
+}
+
+// members returns the resolved member emails in sorted order
+func (c *groupResolutionContext) members() []string {
+	return sortedValues(c.memberEmails)
+}
+
+// sortedValues returns the values of m in sorted order
+func sortedValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, value := range m {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// DefaultConcurrency is the default number of Directory API requests allowed in flight at once
+const DefaultConcurrency = 4
+
+// Admin SDK Directory quotas default to 2,400 queries per minute, so the shared limiter
+// stays well below with 20 requests per second and a small burst allowance.
+const (
+	DefaultRequestsPerSecond = 20
+	DefaultRequestBurst      = 10
+)
+
+// NewRateLimiter creates a token-bucket limiter tuned to the default Directory API quotas
+func NewRateLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(DefaultRequestsPerSecond), DefaultRequestBurst)
+}
+
+// ResolveOptions controls how group membership is resolved through the Directory API
+type ResolveOptions struct {
+	Retrier     *retry.Retrier    // Retry policy for transient API errors (429/5xx)
+	Progress    progress.Reporter // Optional; receives one event per group expanded
+	Concurrency int               // Maximum number of member lists fetched in parallel
+	Limiter     *rate.Limiter     // Shared token bucket applied to every Directory API call
+
+	// Filter leaves out members by role, status, delivery setting or domain
+	Filter MemberFilter
+
+	// Cache optionally keeps member lists (fresh for its TTL) and the expanded membership of
+	// each requested group. In offline mode only cached lists are used and Service may be nil.
+	Cache *cache.Store
+}
+
+// withDefaults fills in zero values with the package defaults
+func (o ResolveOptions) withDefaults() ResolveOptions {
+	if o.Retrier == nil {
+		o.Retrier = retry.Default()
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Limiter == nil {
+		o.Limiter = NewRateLimiter()
+	}
+	return o
+}
+
+// groupListing is the member list of one group, fetched once per run
+type groupListing struct {
+	done    chan struct{}
+	members []*directory.Member
+	err     error
+}
+
+// resolver performs Directory API calls for a single resolution run
+type resolver struct {
+	service  *directory.Service
+	opts     ResolveOptions
+	progress *progress.Tracker
+	slots    chan struct{} // Bounds concurrent Members.List calls to opts.Concurrency
+
+	mu       sync.Mutex
+	listings map[string]*groupListing // normalized group -> member list, shared by all top-level groups
+	cached   int                      // Member lists served from the cache
+}
+
+func newResolver(service *directory.Service, opts ResolveOptions) *resolver {
+	opts = opts.withDefaults()
+	return &resolver{
+		service:  service,
+		opts:     opts,
+		slots:    make(chan struct{}, opts.Concurrency),
+		listings: make(map[string]*groupListing),
+	}
 }
 
 // ResolveMemberEmails takes a list of email addresses (which may include group/mailing list addresses)
 // and returns a list of individual member email addresses
-func ResolveMemberEmails(service *directory.Service, emails []string) ([]string, error) {
+func ResolveMemberEmails(ctx context.Context, service *directory.Service, emails []string) ([]string, error) {
+	r := newResolver(service, ResolveOptions{})
 	memberEmails := make(map[string]string) // Use map to avoid duplicates
 
 	for _, email := range emails {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		email = strings.TrimSpace(email)
 		if email == "" {
 			continue
 		}
 
 		// Check if this is a group email by trying to get its members
-		members, err := getGroupMembers(service, email)
+		members, err := r.getGroupMembers(ctx, email)
 		if err != nil {
 			// If we can't get members, assume it's an individual email
 			log.Debug().Err(err).Str("email", email).Msg("Could not get members (might be an individual email)")
@@ -124,7 +414,18 @@ func ResolveMemberEmails(service *directory.Service, emails []string) ([]string,
 }
 
 // ResolveMemberEmailsDetailed provides detailed information about the resolution process
-func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([]string, *ResolutionSummary) {
+func ResolveMemberEmailsDetailed(ctx context.Context, service *directory.Service, emails []string) ([]string, *ResolutionSummary) {
+	return ResolveMemberEmailsDetailedWithOptions(ctx, service, emails, ResolveOptions{})
+}
+
+// ResolveMemberEmailsDetailedWithOptions resolves groups like ResolveMemberEmailsDetailed using the given options.
+// Top-level groups and their nested groups are expanded concurrently, up to opts.Concurrency
+// member lists at a time; results keep the input order and member lists are sorted.
+// When ctx is canceled, resolution stops and the summary covers only the emails processed so far.
+func ResolveMemberEmailsDetailedWithOptions(ctx context.Context, service *directory.Service, emails []string, opts ResolveOptions) ([]string, *ResolutionSummary) {
+	r := newResolver(service, opts)
+	r.progress = progress.NewTracker(r.opts.Progress, progress.StageGroups, len(emails))
+	defer r.progress.Finish()
 	memberEmails := make(map[string]string)
 	summary := &ResolutionSummary{
 		Results:           make([]ResolutionResult, 0),
@@ -133,11 +434,47 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 		NestedGroupsTotal: 0,
 	}
 
-	for _, email := range emails {
+	type resolved struct {
+		done    bool
+		members []string
+		state   *groupResolutionContext
+		err     error
+	}
+	outcomes := make([]resolved, len(emails))
+	var wg sync.WaitGroup
+	for i, email := range emails {
 		email = strings.TrimSpace(email)
 		if email == "" {
+			r.progress.Done(email, nil)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, email string) {
+			defer wg.Done()
+			if ctx.Err() != nil {
+				return
+			}
+			members, state, err := r.resolveEntry(ctx, email)
+			if ctx.Err() != nil {
+				// Canceled mid-way: the expansion is incomplete
+				return
+			}
+			outcomes[i] = resolved{done: true, members: members, state: state, err: err}
+			r.progress.Done(email, nil)
+		}(i, email)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		log.Warn().Err(ctx.Err()).Msg("Mailing list resolution interrupted")
+	}
+
+	for i, email := range emails {
+		email = strings.TrimSpace(email)
+		outcome := outcomes[i]
+		if !outcome.done {
 			continue
 		}
+		members, state, err := outcome.members, outcome.state, outcome.err
 
 		result := ResolutionResult{
 			OriginalEmail:      email,
@@ -145,9 +482,21 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 			FailedNestedGroups: make(map[string]error),
 		}
 
-		// Try to get group members with full details
-		members, ctx, err := getGroupMembersWithDetails(service, email)
-		if err != nil {
+		selector, isSelector := ParseSelector(email)
+		if isSelector {
+			result.Selector = selector.Kind
+		}
+
+		if err != nil && isSelector {
+			// A selector is not an address, so it can't stand for an attendee
+			result.Error = err
+			result.ErrorType = categorizeError(err)
+			var resolutionErr *GroupResolutionError
+			if errors.As(err, &resolutionErr) && resolutionErr.ErrorType != "" {
+				result.ErrorType = resolutionErr.ErrorType
+			}
+			summary.UnresolvedGroups++
+		} else if err != nil {
 			// Analyze the error to determine the type
 			errorType := categorizeError(err)
 			result.Error = err
@@ -155,7 +504,7 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 			result.IsGroup = false
 
 			// Treat as individual email
-			memberEmails[normalizeEmail(email)] = email
+			keepOriginal(memberEmails, email)
 			result.ResolvedTo = []string{email}
 			summary.IndividualEmails++
 
@@ -163,46 +512,37 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 				summary.ExternalGroups++
 				summary.UnresolvedGroups++
 			}
-		} else if len(members) > 0 {
+		} else if isSelector || len(members) > 0 || len(state.exclusions) > 0 {
 			// Successfully resolved group (possibly with partial failures)
 			result.IsGroup = true
 			result.ResolvedTo = members
-			nestedGroups := make([]string, 0, len(ctx.nestedGroups))
-			for _, nested := range ctx.nestedGroups {
-				nestedGroups = append(nestedGroups, nested)
-			}
-			result.NestedGroups = nestedGroups
-			result.ResolutionDepth = ctx.maxDepth
-			result.PartialFailure = ctx.hasPartialFailure
-			result.FailedNestedGroups = ctx.failedGroups
-			circularGroups := make([]string, 0, len(ctx.circularRefs))
-			for _, circ := range ctx.circularRefs {
-				circularGroups = append(circularGroups, circ)
-			}
-			result.CircularGroups = circularGroups
-
-			// Check for circular references
-			for _, circRef := range result.CircularGroups {
-				if strings.EqualFold(circRef, email) {
-					result.CircularRef = true
-					break
-				}
-			}
+			result.NestedGroups = sortedValues(state.nestedGroups)
+			result.ResolutionDepth = state.maxDepth
+			result.PartialFailure = state.hasPartialFailure
+			result.FailedNestedGroups = state.failedGroups
+			result.CircularGroups = sortedValues(state.circularRefs)
+			result.Excluded = state.exclusions
+			_, result.CircularRef = state.circularRefs[normalizeEmail(email)]
 
 			// Update summary stats
 			summary.ResolvedGroups++
-			summary.NestedGroupsTotal += len(ctx.nestedGroups)
-			if ctx.maxDepth > summary.MaxDepthReached {
-				summary.MaxDepthReached = ctx.maxDepth
+			summary.NestedGroupsTotal += len(state.nestedGroups)
+			if state.maxDepth > summary.MaxDepthReached {
+				summary.MaxDepthReached = state.maxDepth
+			}
+			summary.CircularRefsFound += len(state.circularRefs)
+
+			// Only complete expansions are worth comparing against later
+			if !state.hasPartialFailure {
+				r.storeSnapshot(email, members)
 			}
-			summary.CircularRefsFound += len(ctx.circularRefs)
 
 			// Add members to overall set
 			for _, member := range members {
 				if member == "" {
 					continue
 				}
-				memberEmails[normalizeEmail(member)] = member
+				keepOriginal(memberEmails, member)
 			}
 
 			// Log detailed information if there were issues
@@ -210,9 +550,9 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 				log.Info().
 					Str("group", email).
 					Int("members_found", len(members)).
-					Int("nested_groups", len(ctx.nestedGroups)).
-					Int("failed_groups", len(ctx.failedGroups)).
-					Int("max_depth", ctx.maxDepth).
+					Int("nested_groups", len(state.nestedGroups)).
+					Int("failed_groups", len(state.failedGroups)).
+					Int("max_depth", state.maxDepth).
 					Bool("circular_ref", result.CircularRef).
 					Msg("Group resolved with issues")
 			}
@@ -220,7 +560,7 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 			// Empty result - treat as individual email
 			result.IsGroup = false
 			result.ResolvedTo = []string{email}
-			memberEmails[normalizeEmail(email)] = email
+			keepOriginal(memberEmails, email)
 			summary.IndividualEmails++
 		}
 
@@ -228,13 +568,27 @@ func ResolveMemberEmailsDetailed(service *directory.Service, emails []string) ([
 		summary.TotalEmails++
 	}
 
-	// Convert map to slice
-	allEmails := make([]string, 0, len(memberEmails))
-	for _, original := range memberEmails {
-		allEmails = append(allEmails, original)
+	// Count members left out everywhere, not those attending through another group
+	excluded := make(map[string]bool)
+	for _, result := range summary.Results {
+		for _, member := range result.Excluded {
+			if _, kept := memberEmails[normalizeEmail(member.Email)]; !kept {
+				excluded[normalizeEmail(member.Email)] = true
+			}
+		}
 	}
+	summary.ExcludedMembers = len(excluded)
+
+	summary.CachedLists = r.cached
+	return sortedValues(memberEmails), summary
+}
 
-	return allEmails, summary
+// resolveEntry expands a mailing list or an org selector
+func (r *resolver) resolveEntry(ctx context.Context, entry string) ([]string, *groupResolutionContext, error) {
+	if selector, ok := ParseSelector(entry); ok {
+		return r.getSelectorMembers(ctx, selector)
+	}
+	return r.getGroupMembersWithDetails(ctx, entry)
 }
 
 // categorizeError determines the type of error from the API response
@@ -243,6 +597,10 @@ func categorizeError(err error) string {
 		return ""
 	}
 
+	if errors.Is(err, errNotGroup) {
+		return "not_found"
+	}
+
 	errStr := err.Error()
 
 	// Check for common error patterns
@@ -269,193 +627,227 @@ func categorizeError(err error) string {
 }
 
 // getGroupMembers retrieves all member email addresses for a given group
-func getGroupMembers(service *directory.Service, groupEmail string) ([]string, error) {
-	// Create a new context for this resolution
-	ctx := &groupResolutionContext{
-		visitedGroups:     make(map[string]bool),
-		memberEmails:      make(map[string]string),
-		nestedGroups:      make(map[string]string),
-		maxDepth:          0,
-		currentPath:       []string{},
-		failedGroups:      make(map[string]error),
-		circularRefs:      make(map[string]string),
-		hasPartialFailure: false,
-	}
+func (r *resolver) getGroupMembers(ctx context.Context, groupEmail string) ([]string, error) {
+	members, _, err := r.getGroupMembersWithDetails(ctx, groupEmail)
+	return members, err
+}
 
-	// Start recursive resolution
-	err := getGroupMembersRecursive(service, groupEmail, ctx, 0)
-	if err != nil {
-		return nil, err
-	}
+// getGroupMembersWithDetails retrieves group members with full resolution details
+func (r *resolver) getGroupMembersWithDetails(ctx context.Context, groupEmail string) ([]string, *groupResolutionContext, error) {
+	state := newGroupResolutionContext(groupEmail)
+	state.claim(groupEmail)
 
-	// Convert member emails to slice
-	members := make([]string, 0, len(ctx.memberEmails))
-	for _, original := range ctx.memberEmails {
-		members = append(members, original)
+	// Start recursive resolution
+	if err := r.getGroupMembersRecursive(ctx, groupEmail, state); err != nil {
+		return nil, state, err
 	}
+	state.finish()
 
-	return members, nil
+	return state.members(), state, nil
 }
 
-// getGroupMembersRecursive recursively retrieves group members with circular reference detection
-func getGroupMembersRecursive(service *directory.Service, groupEmail string, ctx *groupResolutionContext, depth int) error {
-	normalizedGroup := normalizeEmail(groupEmail)
-
-	// Update max depth
-	if depth > ctx.maxDepth {
-		ctx.maxDepth = depth
-	}
-
-	// Check for circular reference
-	for _, pathEmail := range ctx.currentPath {
-		if normalizeEmail(pathEmail) == normalizedGroup {
-			log.Warn().
-				Str("group", groupEmail).
-				Strs("path", ctx.currentPath).
-				Msg("Circular reference detected in nested groups")
-			ctx.circularRefs[normalizedGroup] = groupEmail
-			return nil // Don't error out, just skip this group
+// getGroupMembersRecursive lists a group's members and expands its nested groups in parallel.
+// The caller must have claimed groupEmail in state; nested groups already claimed by another
+// branch are skipped, which also stops circular references.
+func (r *resolver) getGroupMembersRecursive(ctx context.Context, groupEmail string, state *groupResolutionContext) error {
+	members, err := r.listMembers(ctx, groupEmail)
+	if err != nil {
+		return &GroupResolutionError{
+			Email:     groupEmail,
+			Err:       err,
+			ErrorType: categorizeError(err),
 		}
 	}
 
-	// Check if we've already processed this group
-	if ctx.visitedGroups[normalizedGroup] {
-		log.Debug().
-			Str("group", groupEmail).
-			Int("depth", depth).
-			Msg("Group already processed, skipping")
-		return nil
-	}
-
-	// Mark as visited and add to current path
-	ctx.visitedGroups[normalizedGroup] = true
-	ctx.currentPath = append(ctx.currentPath, groupEmail)
-	defer func() {
-		// Remove from current path when done
-		ctx.currentPath = ctx.currentPath[:len(ctx.currentPath)-1]
-	}()
+	var nested []string
+	for _, member := range members {
+		if member == nil {
+			continue
+		}
 
-	// Fetch group members
-	pageToken := ""
-	for {
-		call := service.Members.
-			List(groupEmail).
-			MaxResults(200).
-			IncludeDerivedMembership(true)
-		if pageToken != "" {
-			call = call.PageToken(pageToken)
+		memberEmail := strings.TrimSpace(member.Email)
+		if memberEmail == "" {
+			continue
 		}
 
-		resp, err := call.Do()
-		if err != nil {
-			return &GroupResolutionError{
-				Email:     groupEmail,
-				Err:       err,
-				ErrorType: categorizeError(err),
+		// Direct user members are added immediately; other group-like entries are expanded
+		memberType := strings.ToUpper(strings.TrimSpace(member.Type))
+		if memberType != "GROUP" && memberType != "CUSTOMER" {
+			if reason, value := r.opts.Filter.exclusion(member); reason != "" {
+				state.exclude(ExcludedMember{Email: memberEmail, Group: groupEmail, Reason: reason, Value: value})
+				continue
 			}
 		}
+		switch memberType {
+		case "USER":
+			state.addMember(memberEmail)
+		case "GROUP", "CUSTOMER", "":
+			nested = append(nested, memberEmail)
+		default:
+			// Fallback: treat as individual email
+			state.addMember(memberEmail)
+		}
+	}
+	state.addGroupMembers(groupEmail, nested)
+
+	var wg sync.WaitGroup
+	for _, memberEmail := range nested {
+		if !state.claim(memberEmail) {
+			log.Debug().
+				Str("group", memberEmail).
+				Str("parent_group", groupEmail).
+				Msg("Group already processed, skipping")
+			continue
+		}
 
-		for _, member := range resp.Members {
-			if member == nil {
-				continue
+		wg.Add(1)
+		r.progress.Add(1)
+		go func(memberEmail string) {
+			defer wg.Done()
+			err := r.getGroupMembersRecursive(ctx, memberEmail, state)
+			r.progress.Done(memberEmail, nestedGroupFailure(err))
+			if err == nil {
+				return
 			}
 
-			memberEmail := strings.TrimSpace(member.Email)
-			if memberEmail == "" {
-				continue
+			if nestedGroupFailure(err) == nil {
+				// Treat as an individual email (likely not a group)
+				state.markNotGroup(memberEmail)
+				log.Debug().
+					Str("email", memberEmail).
+					Str("parent_group", groupEmail).
+					Msg("Nested entry is not a resolvable group; treating as individual")
+				return
 			}
 
-			normalizedMember := normalizeEmail(memberEmail)
-			memberType := strings.ToUpper(strings.TrimSpace(member.Type))
+			log.Warn().
+				Err(err).
+				Str("nested_group", memberEmail).
+				Str("parent_group", groupEmail).
+				Msg("Could not resolve nested group, continuing with other members")
+			state.fail(memberEmail, err)
+		}(memberEmail)
+	}
+	wg.Wait()
 
-			// Direct user members are added immediately
-			if memberType == "USER" {
-				ctx.memberEmails[normalizedMember] = memberEmail
-				continue
+	return nil
+}
+
+// listMembers fetches every member of a group, at most once per run. Concurrent callers
+// for the same group wait for the first fetch instead of repeating it.
+func (r *resolver) listMembers(ctx context.Context, groupEmail string) ([]*directory.Member, error) {
+	return r.list(ctx, groupEmail, func() ([]*directory.Member, error) {
+		var members []*directory.Member
+		pageToken := ""
+		for {
+			call := r.service.Members.
+				List(groupEmail).
+				MaxResults(200).
+				IncludeDerivedMembership(true).
+				Context(ctx)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
 			}
 
-			// Determine if we should attempt to resolve this member as a nested group
-			shouldAttemptGroup := memberType == "GROUP" || memberType == "CUSTOMER" || memberType == ""
-
-			if shouldAttemptGroup {
-				ctx.nestedGroups[normalizedMember] = memberEmail
-
-				err := getGroupMembersRecursive(service, memberEmail, ctx, depth+1)
-				if err != nil {
-					var groupErr *GroupResolutionError
-					if errors.As(err, &groupErr) {
-						switch groupErr.ErrorType {
-						case "not_found", "bad_request":
-							// Treat as an individual email (likely not a group)
-							delete(ctx.nestedGroups, normalizedMember)
-							ctx.memberEmails[normalizedMember] = memberEmail
-							log.Debug().
-								Str("email", memberEmail).
-								Str("parent_group", groupEmail).
-								Msg("Nested entry is not a resolvable group; treating as individual")
-							continue
-						}
-					}
-
-					log.Warn().
-						Err(err).
-						Str("nested_group", memberEmail).
-						Str("parent_group", groupEmail).
-						Int("depth", depth+1).
-						Msg("Could not resolve nested group, continuing with other members")
-					ctx.failedGroups[memberEmail] = err
-					ctx.hasPartialFailure = true
-					continue
+			var resp *directory.Members
+			err := r.call(ctx, "directory.members_list", func() error {
+				var callErr error
+				resp, callErr = call.Do()
+				return callErr
+			})
+			if err != nil {
+				if isNotGroupError(categorizeError(err)) {
+					r.storeNotGroup(groupEmail)
 				}
-
-				continue
+				return nil, err
 			}
+			members = append(members, resp.Members...)
 
-			// Fallback: treat as individual email
-			ctx.memberEmails[normalizedMember] = memberEmail
+			pageToken = resp.NextPageToken
+			if pageToken == "" {
+				return members, nil
+			}
 		}
+	})
+}
 
-		pageToken = resp.NextPageToken
-		if pageToken == "" {
-			break
+// call runs a rate-limited Directory API call through the retrier
+func (r *resolver) call(ctx context.Context, operation string, fn func() error) error {
+	return r.opts.Retrier.Do(ctx, operation, func() error {
+		if err := r.opts.Limiter.Wait(ctx); err != nil {
+			return err
 		}
+		return fn()
+	})
+}
+
+// list returns the member list cached under key, or fetches it once per run and caches it.
+// Concurrent callers for the same key wait for the first fetch instead of repeating it.
+func (r *resolver) list(ctx context.Context, key string, fetch func() ([]*directory.Member, error)) ([]*directory.Member, error) {
+	r.mu.Lock()
+	listing, fetched := r.listings[listingKey(key)]
+	if !fetched {
+		listing = &groupListing{done: make(chan struct{})}
+		r.listings[listingKey(key)] = listing
 	}
+	r.mu.Unlock()
 
-	return nil
-}
+	if fetched {
+		<-listing.done
+		return listing.members, listing.err
+	}
+	defer close(listing.done)
+
+	if cached, hit := r.cachedMembers(key); hit {
+		r.mu.Lock()
+		r.cached++
+		r.mu.Unlock()
+		if cached.NotGroup {
+			listing.err = errNotGroup
+			return nil, listing.err
+		}
+		listing.members = cached.Members
+		return cached.Members, nil
+	}
+	if r.service == nil || r.opts.Cache.Offline() {
+		listing.err = notCached(key)
+		return nil, listing.err
+	}
 
-// getGroupMembersWithDetails retrieves group members with full resolution details
-func getGroupMembersWithDetails(service *directory.Service, groupEmail string) ([]string, *groupResolutionContext, error) {
-	// Create a new context for this resolution
-	ctx := &groupResolutionContext{
-		visitedGroups:     make(map[string]bool),
-		memberEmails:      make(map[string]string),
-		nestedGroups:      make(map[string]string),
-		maxDepth:          0,
-		currentPath:       []string{},
-		failedGroups:      make(map[string]error),
-		circularRefs:      make(map[string]string),
-		hasPartialFailure: false,
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		listing.err = ctx.Err()
+		return nil, listing.err
 	}
 
-	// Start recursive resolution
-	err := getGroupMembersRecursive(service, groupEmail, ctx, 0)
-	if err != nil {
-		return nil, ctx, err
+	listing.members, listing.err = fetch()
+	if listing.err == nil {
+		r.storeMembers(key, listing.members)
 	}
+	return listing.members, listing.err
+}
 
-	// Convert member emails to slice
-	members := make([]string, 0, len(ctx.memberEmails))
-	for _, original := range ctx.memberEmails {
-		members = append(members, original)
+// nestedGroupFailure returns err unless it only means the entry is not a group,
+// in which case the member is kept as an individual rather than counted as failed
+func nestedGroupFailure(err error) error {
+	var groupErr *GroupResolutionError
+	if errors.As(err, &groupErr) && isNotGroupError(groupErr.ErrorType) {
+		return nil
 	}
+	return err
+}
 
-	return members, ctx, nil
+// isNotGroupError reports whether an error type means the address is not a group
+func isNotGroupError(errorType string) bool {
+	return errorType == "not_found" || errorType == "bad_request"
 }
 
 // CheckGroupAccess performs a lightweight permission probe for each mailing list domain.
 // It returns a warning error if the service account appears to lack the required scope.
-func CheckGroupAccess(service *directory.Service, groupEmails []string) error {
+// Probes go through retrier, or retry.Default() when it is nil.
+func CheckGroupAccess(ctx context.Context, service *directory.Service, groupEmails []string, retrier *retry.Retrier) error {
 	domainSet := make(map[string]struct{})
 	for _, email := range groupEmails {
 		parts := strings.Split(email, "@")
@@ -472,9 +864,18 @@ func CheckGroupAccess(service *directory.Service, groupEmails []string) error {
 		return nil
 	}
 
+	if retrier == nil {
+		retrier = retry.Default()
+	}
 	for domain := range domainSet {
 		testGroup := fmt.Sprintf("btm-access-check-nonexistent@%s", domain)
-		_, err := service.Members.List(testGroup).MaxResults(1).Do()
+		err := retrier.Do(ctx, "directory.members_list", func() error {
+			_, callErr := service.Members.List(testGroup).MaxResults(1).Context(ctx).Do()
+			return callErr
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
 			if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
 				return fmt.Errorf("insufficient permissions to read group members in domain %s. Make sure the service account has 'Groups Reader' role in Google Workspace Admin", domain)
@@ -0,0 +1,565 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	directory "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func jsonResponse(t *testing.T, status int, body interface{}) *http.Response {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(string(data))),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+// fakeDirectoryAPI answers Members.List from a static membership table with a random
+// delay, tracking calls per group and the peak number of concurrent calls.
+type fakeDirectoryAPI struct {
+	groups    map[string][]*directory.Member
+	forbidden map[string]bool
+	users     map[string]string            // Any address of a user -> primary address
+	noScope   bool                         // Users.Get fails for lack of the user scope
+	queries   map[string][]*directory.User // Users.List search query -> matching users
+
+	mu       sync.Mutex
+	calls    map[string]int
+	inFlight int
+	peak     int
+}
+
+func member(email, kind string) *directory.Member {
+	return &directory.Member{Email: email, Type: kind}
+}
+
+func (f *fakeDirectoryAPI) service(t *testing.T) *directory.Service {
+	t.Helper()
+	rt := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// Path: /admin/directory/v1/groups/{group}/members, /admin/directory/v1/users/{user} or /admin/directory/v1/users
+		parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		if parts[len(parts)-1] == "users" {
+			return f.listUsers(t, req.URL.Query().Get("query")), nil
+		}
+		if parts[len(parts)-2] == "users" {
+			return f.getUser(t, parts[len(parts)-1]), nil
+		}
+		group := parts[len(parts)-2]
+
+		f.mu.Lock()
+		if f.calls == nil {
+			f.calls = make(map[string]int)
+		}
+		f.calls[group]++
+		f.inFlight++
+		if f.inFlight > f.peak {
+			f.peak = f.inFlight
+		}
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			f.inFlight--
+			f.mu.Unlock()
+		}()
+
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+		if f.forbidden[group] {
+			return jsonResponse(t, http.StatusForbidden, map[string]interface{}{"error": map[string]interface{}{"code": 403, "message": "Forbidden"}}), nil
+		}
+		members, ok := f.groups[group]
+		if !ok {
+			return jsonResponse(t, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Resource Not Found: groupKey"}}), nil
+		}
+		return jsonResponse(t, http.StatusOK, map[string]interface{}{"members": members}), nil
+	})
+
+	svc, err := directory.NewService(context.Background(),
+		option.WithHTTPClient(&http.Client{Transport: rt}),
+		option.WithEndpoint("https://directory.test/"),
+	)
+	if err != nil {
+		t.Fatalf("create directory service: %v", err)
+	}
+	return svc
+}
+
+func (f *fakeDirectoryAPI) getUser(t *testing.T, email string) *http.Response {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[email]++
+	f.mu.Unlock()
+
+	if f.noScope {
+		return jsonResponse(t, http.StatusForbidden, map[string]interface{}{"error": map[string]interface{}{
+			"code": 403, "message": "Request had insufficient authentication scopes.",
+			"errors": []map[string]interface{}{{"reason": "insufficientPermissions", "message": "Insufficient Permission"}},
+		}})
+	}
+	primary, ok := f.users[strings.ToLower(email)]
+	if !ok {
+		return jsonResponse(t, http.StatusNotFound, map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Resource Not Found: userKey"}})
+	}
+	return jsonResponse(t, http.StatusOK, map[string]interface{}{"primaryEmail": primary})
+}
+
+func (f *fakeDirectoryAPI) listUsers(t *testing.T, query string) *http.Response {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[query]++
+	f.mu.Unlock()
+
+	if f.noScope {
+		return jsonResponse(t, http.StatusForbidden, map[string]interface{}{"error": map[string]interface{}{"code": 403, "message": "Not Authorized to access this resource/api"}})
+	}
+	return jsonResponse(t, http.StatusOK, map[string]interface{}{"users": f.queries[query]})
+}
+
+// nestedTeams builds eng -> {frontend, backend, qa}, where backend also contains
+// frontend and frontend points back at eng
+func nestedTeams() *fakeDirectoryAPI {
+	return &fakeDirectoryAPI{
+		groups: map[string][]*directory.Member{
+			"eng@example.com": {
+				member("cto@example.com", "USER"),
+				member("frontend@example.com", "GROUP"),
+				member("backend@example.com", "GROUP"),
+				member("qa@example.com", "GROUP"),
+			},
+			"frontend@example.com": {
+				member("ana@example.com", "USER"),
+				member("eng@example.com", "GROUP"),
+			},
+			"backend@example.com": {
+				member("bob@example.com", "USER"),
+				member("frontend@example.com", "GROUP"),
+				member("db@example.com", "GROUP"),
+			},
+			"qa@example.com": {
+				member("Ana@example.com", "USER"),
+				member("quinn@example.com", "USER"),
+				member("contractor@example.com", ""),
+			},
+			"db@example.com": {
+				member("dora@example.com", "USER"),
+			},
+		},
+		forbidden: map[string]bool{"db@example.com": true},
+	}
+}
+
+func TestResolveExpandsNestedGroupsConcurrently(t *testing.T) {
+	api := nestedTeams()
+	members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t),
+		[]string{"eng@example.com", "alice@example.com"}, ResolveOptions{Concurrency: 2})
+
+	want := []string{"Ana@example.com", "alice@example.com", "bob@example.com", "contractor@example.com", "cto@example.com", "quinn@example.com"}
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("unexpected members %v", members)
+	}
+	if api.peak > 2 {
+		t.Fatalf("expected at most 2 concurrent calls, got %d", api.peak)
+	}
+	for group, calls := range api.calls {
+		if calls != 1 {
+			t.Fatalf("expected %s to be listed once, got %d calls", group, calls)
+		}
+	}
+
+	if len(summary.Results) != 2 || summary.Results[0].OriginalEmail != "eng@example.com" || summary.Results[1].OriginalEmail != "alice@example.com" {
+		t.Fatalf("results should keep the input order: %+v", summary.Results)
+	}
+	eng := summary.Results[0]
+	if !reflect.DeepEqual(eng.NestedGroups, []string{"backend@example.com", "db@example.com", "eng@example.com", "frontend@example.com", "qa@example.com"}) {
+		t.Fatalf("unexpected nested groups %v", eng.NestedGroups)
+	}
+	// eng -> frontend -> eng and eng -> backend -> frontend -> eng
+	if !eng.CircularRef || !reflect.DeepEqual(eng.CircularGroups, []string{"backend@example.com", "eng@example.com", "frontend@example.com"}) {
+		t.Fatalf("unexpected circular groups %v", eng.CircularGroups)
+	}
+	if !eng.PartialFailure || eng.FailedNestedGroups["db@example.com"] == nil || eng.ResolutionDepth != 2 {
+		t.Fatalf("unexpected failure details %+v", eng)
+	}
+	if summary.ResolvedGroups != 1 || summary.IndividualEmails != 1 || summary.MaxDepthReached != 2 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestResolveCountsDepthWhereGroupsAreFirstReached(t *testing.T) {
+	// all lists a before b, and a also contains b, so b is first expanded two levels down
+	api := &fakeDirectoryAPI{groups: map[string][]*directory.Member{
+		"all@example.com": {member("a@example.com", "GROUP"), member("b@example.com", "GROUP")},
+		"a@example.com":   {member("ana@example.com", "USER"), member("b@example.com", "GROUP")},
+		"b@example.com":   {member("c@example.com", "GROUP")},
+		"c@example.com":   {member("cy@example.com", "USER")},
+	}}
+	for i := 0; i < 5; i++ {
+		_, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t),
+			[]string{"all@example.com"}, ResolveOptions{Concurrency: 1 + i%3})
+		if depth := summary.Results[0].ResolutionDepth; depth != 3 || summary.MaxDepthReached != 3 {
+			t.Fatalf("expected depth 3 (all > a > b > c), got %d and %d", depth, summary.MaxDepthReached)
+		}
+	}
+}
+
+func TestResolveSummaryIsDeterministic(t *testing.T) {
+	describe := func(members []string, summary *ResolutionSummary) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%v %d/%d/%d/%d/%d/%d\n", members, summary.TotalEmails, summary.ResolvedGroups,
+			summary.IndividualEmails, summary.MaxDepthReached, summary.CircularRefsFound, summary.NestedGroupsTotal)
+		for _, result := range summary.Results {
+			fmt.Fprintf(&b, "%s %v %v %d %t %t %v %d\n", result.OriginalEmail, result.ResolvedTo, result.NestedGroups,
+				result.ResolutionDepth, result.CircularRef, result.PartialFailure, result.CircularGroups, len(result.FailedNestedGroups))
+		}
+		return b.String()
+	}
+
+	groups := []string{"backend@example.com", "eng@example.com", "qa@example.com"}
+	var first string
+	for i := 0; i < 20; i++ {
+		members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), nestedTeams().service(t), groups, ResolveOptions{Concurrency: 1 + i%4})
+		got := describe(members, summary)
+		if i == 0 {
+			first = got
+		} else if got != first {
+			t.Fatalf("run %d differs:\n%s\nfirst run:\n%s", i, got, first)
+		}
+	}
+}
+
+func TestResolveServesMemberListsFromCache(t *testing.T) {
+	dir := t.TempDir()
+	store, err := cache.New(dir, time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+
+	first := nestedTeams()
+	want, _ := ResolveMemberEmailsDetailedWithOptions(context.Background(), first.service(t),
+		[]string{"eng@example.com"}, ResolveOptions{Cache: store})
+
+	second := nestedTeams()
+	members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), second.service(t),
+		[]string{"eng@example.com"}, ResolveOptions{Cache: store})
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("cached resolution returned %v, want %v", members, want)
+	}
+	// db is forbidden, so it is never cached and is asked for again
+	if len(second.calls) != 1 || second.calls["db@example.com"] != 1 {
+		t.Fatalf("expected only the uncached group to be listed, got %v", second.calls)
+	}
+	// contractor is remembered as not being a group
+	if summary.CachedLists != 5 {
+		t.Fatalf("expected 5 cached lists, got %d", summary.CachedLists)
+	}
+
+	offline, err := cache.New(dir, time.Hour, cache.ModeOffline)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	members, summary = ResolveMemberEmailsDetailedWithOptions(context.Background(), nil,
+		[]string{"eng@example.com", "sales@example.com"}, ResolveOptions{Cache: offline})
+	if len(members) != len(want)+1 {
+		t.Fatalf("expected the cached members plus the unresolved group, got %v", members)
+	}
+	if eng := summary.Results[0]; !eng.IsGroup || !reflect.DeepEqual(eng.ResolvedTo, want) {
+		t.Fatalf("expected eng to resolve offline, got %+v", eng)
+	}
+	if sales := summary.Results[1]; sales.IsGroup || !errors.Is(sales.Error, ErrNotCached) {
+		t.Fatalf("expected sales to miss the cache, got %+v", sales)
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	store, err := cache.New(t.TempDir(), time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+
+	api := &fakeDirectoryAPI{groups: map[string][]*directory.Member{
+		"team@example.com": {member("ana@example.com", "USER"), member("bob@example.com", "USER")},
+	}}
+	ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t), []string{"team@example.com"}, ResolveOptions{Cache: store})
+
+	snapshot, found, err := LoadSnapshot(store, "Team@example.com")
+	if err != nil || !found {
+		t.Fatalf("expected a snapshot, got found=%v err=%v", found, err)
+	}
+	if !reflect.DeepEqual(snapshot.Members, []string{"ana@example.com", "bob@example.com"}) || snapshot.ResolvedAt.IsZero() {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	diff, err := snapshot.Diff([]string{"ANA@example.com", "carol@example.com"}, MemberFilter{})
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Joined, []string{"carol@example.com"}) || !reflect.DeepEqual(diff.Left, []string{"bob@example.com"}) {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+}
+
+func TestSnapshotDiffNeedsTheSameFilter(t *testing.T) {
+	store, err := cache.New(t.TempDir(), time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	suspended := member("eve@example.com", "USER")
+	suspended.Status = "SUSPENDED"
+	api := &fakeDirectoryAPI{groups: map[string][]*directory.Member{
+		"team@example.com": {member("ana@example.com", "USER"), suspended},
+	}}
+	filter := MemberFilter{Statuses: []string{"ACTIVE"}}
+	ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t), []string{"team@example.com"}, ResolveOptions{Cache: store, Filter: filter})
+
+	snapshot, found, err := LoadSnapshot(store, "team@example.com")
+	if err != nil || !found {
+		t.Fatalf("expected a snapshot, got found=%v err=%v", found, err)
+	}
+	if _, err := snapshot.Diff([]string{"ana@example.com", "eve@example.com"}, MemberFilter{}); !errors.Is(err, ErrFilterChanged) {
+		t.Fatalf("expected a filter mismatch without a filter, got %v", err)
+	}
+	diff, err := snapshot.Diff([]string{"ana@example.com"}, MemberFilter{Statuses: []string{"active", "Active"}})
+	if err != nil || len(diff.Joined) != 0 || len(diff.Left) != 0 {
+		t.Fatalf("expected no change with an equivalent filter, got %+v (%v)", diff, err)
+	}
+}
+
+func TestResolveAppliesMemberFilter(t *testing.T) {
+	withDetails := func(email, role, status, delivery string) *directory.Member {
+		return &directory.Member{Email: email, Type: "USER", Role: role, Status: status, DeliverySettings: delivery}
+	}
+	api := &fakeDirectoryAPI{groups: map[string][]*directory.Member{
+		"all@example.com": {
+			withDetails("owner@example.com", "OWNER", "ACTIVE", "ALL_MAIL"),
+			withDetails("away@example.com", "MEMBER", "SUSPENDED", "ALL_MAIL"),
+			withDetails("muted@example.com", "MEMBER", "ACTIVE", "NONE"),
+			withDetails("partner@partner.com", "MEMBER", "ACTIVE", "ALL_MAIL"),
+			withDetails("guest@example.com", "MEMBER", "", ""),
+			withDetails("both@example.com", "MEMBER", "SUSPENDED", "ALL_MAIL"),
+			{Email: "sub@example.com", Type: "GROUP", Role: "MEMBER", Status: "SUSPENDED"},
+		},
+		"sub@example.com": {
+			withDetails("both@example.com", "MEMBER", "ACTIVE", "ALL_MAIL"),
+		},
+		"owners@example.com": {
+			withDetails("away@example.com", "MEMBER", "SUSPENDED", "ALL_MAIL"),
+		},
+	}}
+
+	filter := MemberFilter{Statuses: []string{"active"}, DeliverySettings: []string{"ALL_MAIL", "DIGEST"}, DenyDomains: []string{"@partner.com"}}
+	members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t),
+		[]string{"all@example.com", "owners@example.com"}, ResolveOptions{Filter: filter})
+
+	// Nested groups are expanded whatever their own status; unknown statuses are kept
+	want := []string{"both@example.com", "guest@example.com", "owner@example.com"}
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("unexpected members %v", members)
+	}
+
+	all := summary.Results[0]
+	wantExcluded := []ExcludedMember{
+		{Email: "away@example.com", Group: "all@example.com", Reason: ExcludedByStatus, Value: "SUSPENDED"},
+		{Email: "muted@example.com", Group: "all@example.com", Reason: ExcludedByDelivery, Value: "NONE"},
+		{Email: "partner@partner.com", Group: "all@example.com", Reason: ExcludedByDeniedDomain, Value: "partner.com"},
+	}
+	if !reflect.DeepEqual(all.Excluded, wantExcluded) {
+		t.Fatalf("unexpected exclusions %+v", all.Excluded)
+	}
+
+	// A group whose members are all filtered out is still a group, not an attendee
+	owners := summary.Results[1]
+	if !owners.IsGroup || len(owners.ResolvedTo) != 0 || len(owners.Excluded) != 1 {
+		t.Fatalf("expected an empty group with one exclusion, got %+v", owners)
+	}
+	if summary.ExcludedMembers != 3 {
+		t.Fatalf("expected 3 distinct excluded members, got %d", summary.ExcludedMembers)
+	}
+}
+
+func TestMemberFilterValidate(t *testing.T) {
+	if err := (MemberFilter{Roles: []string{"owner", "Manager"}, DeliverySettings: []string{"digest"}}).Validate(); err != nil {
+		t.Fatalf("expected valid filter, got %v", err)
+	}
+	if err := (MemberFilter{Roles: []string{"ADMIN"}}).Validate(); err == nil {
+		t.Fatalf("expected unknown role to be rejected")
+	}
+	allow := MemberFilter{AllowDomains: []string{"example.com"}}
+	if reason, _ := allow.exclusion(member("a@Example.COM", "USER")); reason != "" {
+		t.Fatalf("expected allowed domain to be kept, got %q", reason)
+	}
+	if reason, value := allow.exclusion(member("b@other.com", "USER")); reason != ExcludedByDomain || value != "other.com" {
+		t.Fatalf("expected other domain to be excluded, got %q %q", reason, value)
+	}
+}
+
+func TestPrimaryEmailsResolvesAliases(t *testing.T) {
+	store, err := cache.New(t.TempDir(), time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	api := &fakeDirectoryAPI{users: map[string]string{
+		"bob@example.com":          "robert.smith@example.com",
+		"robert.smith@example.com": "robert.smith@example.com",
+	}}
+
+	emails := []string{"Bob@example.com", "robert.smith@example.com", "partner@other.com", "bob@example.com"}
+	primaries, err := PrimaryEmails(context.Background(), api.service(t), emails, ResolveOptions{Cache: store})
+	if err != nil {
+		t.Fatalf("primary emails: %v", err)
+	}
+	want := map[string]string{
+		"bob@example.com":          "robert.smith@example.com",
+		"robert.smith@example.com": "robert.smith@example.com",
+		"partner@other.com":        "partner@other.com",
+	}
+	if !reflect.DeepEqual(primaries, want) {
+		t.Fatalf("unexpected primaries %v", primaries)
+	}
+	if len(api.calls) != 3 {
+		t.Fatalf("expected one lookup per distinct address, got %v", api.calls)
+	}
+
+	// Answers, including addresses that are not users, come from the cache next time
+	again := &fakeDirectoryAPI{}
+	primaries, err = PrimaryEmails(context.Background(), again.service(t), emails, ResolveOptions{Cache: store})
+	if err != nil || !reflect.DeepEqual(primaries, want) || len(again.calls) != 0 {
+		t.Fatalf("expected cached primaries, got %v (%v) after %v", primaries, err, again.calls)
+	}
+}
+
+func TestPrimaryEmailsReportsMissingScope(t *testing.T) {
+	api := &fakeDirectoryAPI{noScope: true}
+	_, err := PrimaryEmails(context.Background(), api.service(t), []string{"bob@example.com"}, ResolveOptions{})
+	if !errors.Is(err, ErrUserScopeMissing) {
+		t.Fatalf("expected missing scope error, got %v", err)
+	}
+}
+
+func TestResolveExpandsSelectors(t *testing.T) {
+	user := func(email string) *directory.User {
+		return &directory.User{PrimaryEmail: email}
+	}
+	api := &fakeDirectoryAPI{
+		groups: map[string][]*directory.Member{
+			"leads@example.com": {member("cara@example.com", "USER")},
+		},
+		queries: map[string][]*directory.User{
+			"directManager='alice@example.com'":    {user("bob@example.com"), user("cara@example.com")},
+			"directManager='bob@example.com'":      {user("dan@example.com"), {PrimaryEmail: "eve@example.com", Suspended: true}},
+			"directManager='eve@example.com'":      {user("finn@example.com")},
+			"orgUnitPath='/Engineering/O\\'Brien'": {user("gus@example.com")},
+			"orgTitle='Designer'":                  {user("hana@example.com")},
+		},
+	}
+
+	filter := MemberFilter{Statuses: []string{"ACTIVE"}}
+	entries := []string{
+		"Reports-Of:alice@example.com",
+		"orgunit:/Engineering/O'Brien",
+		"query:orgTitle='Designer'",
+		"leads@example.com",
+		"reports-of:alice",
+		"orgunit:/Nobody",
+	}
+	members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t), entries, ResolveOptions{Filter: filter})
+
+	// Reports of a filtered-out manager are still followed; the manager at the root is not an attendee
+	want := []string{"bob@example.com", "cara@example.com", "dan@example.com", "finn@example.com", "gus@example.com", "hana@example.com"}
+	if !reflect.DeepEqual(members, want) {
+		t.Fatalf("unexpected members %v", members)
+	}
+
+	reports := summary.Results[0]
+	if !reports.IsGroup || reports.Selector != SelectorReportsOf || reports.ResolutionDepth != 3 {
+		t.Fatalf("unexpected reports-of result %+v", reports)
+	}
+	wantExcluded := []ExcludedMember{{Email: "eve@example.com", Group: "bob@example.com", Reason: ExcludedByStatus, Value: "SUSPENDED"}}
+	if !reflect.DeepEqual(reports.Excluded, wantExcluded) {
+		t.Fatalf("unexpected exclusions %+v", reports.Excluded)
+	}
+	if got := summary.Results[1].ResolvedTo; !reflect.DeepEqual(got, []string{"gus@example.com"}) {
+		t.Fatalf("unexpected org unit members %v", got)
+	}
+
+	// An invalid selector is an error, never an attendee; one matching nobody resolves to no one
+	invalid := summary.Results[4]
+	if invalid.Error == nil || invalid.ErrorType != "invalid_selector" || len(invalid.ResolvedTo) != 0 {
+		t.Fatalf("expected an invalid selector error, got %+v", invalid)
+	}
+	if empty := summary.Results[5]; empty.Error != nil || !empty.IsGroup || len(empty.ResolvedTo) != 0 {
+		t.Fatalf("expected an empty selector, got %+v", empty)
+	}
+	if summary.ResolvedGroups != 5 || summary.UnresolvedGroups != 1 || summary.IndividualEmails != 0 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestSelectorQueriesKeepTheirCase(t *testing.T) {
+	store, err := cache.New(t.TempDir(), time.Hour, cache.ModeDefault)
+	if err != nil {
+		t.Fatalf("open cache: %v", err)
+	}
+	newAPI := func() *fakeDirectoryAPI {
+		return &fakeDirectoryAPI{queries: map[string][]*directory.User{
+			"orgTitle='VP'": {{PrimaryEmail: "vera@example.com"}},
+			"orgTitle='vp'": {{PrimaryEmail: "victor@example.com"}},
+		}}
+	}
+	entries := []string{"query:orgTitle='VP'", "query:orgTitle='vp'"}
+
+	for _, api := range []*fakeDirectoryAPI{newAPI(), newAPI()} {
+		_, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t), entries, ResolveOptions{Cache: store})
+		if got := summary.Results[0].ResolvedTo; !reflect.DeepEqual(got, []string{"vera@example.com"}) {
+			t.Fatalf("unexpected members for orgTitle='VP': %v", got)
+		}
+		if got := summary.Results[1].ResolvedTo; !reflect.DeepEqual(got, []string{"victor@example.com"}) {
+			t.Fatalf("unexpected members for orgTitle='vp': %v", got)
+		}
+	}
+	for query, want := range map[string]string{"Query:orgTitle='VP'": "vera@example.com", "query:orgTitle='vp'": "victor@example.com"} {
+		snapshot, found, err := LoadSnapshot(store, query)
+		if err != nil || !found || !reflect.DeepEqual(snapshot.Members, []string{want}) {
+			t.Fatalf("unexpected snapshot for %s: %+v (found=%v, err=%v)", query, snapshot, found, err)
+		}
+	}
+}
+
+func TestResolveSelectorWithoutUserScope(t *testing.T) {
+	api := &fakeDirectoryAPI{noScope: true}
+	members, summary := ResolveMemberEmailsDetailedWithOptions(context.Background(), api.service(t),
+		[]string{"orgunit:/Engineering", "ann@example.com"}, ResolveOptions{})
+
+	if !reflect.DeepEqual(members, []string{"ann@example.com"}) {
+		t.Fatalf("expected only the plain address, got %v", members)
+	}
+	if result := summary.Results[0]; result.Error == nil || result.ErrorType != "permission_denied" {
+		t.Fatalf("expected a permission error, got %+v", result)
+	}
+}
@@ -0,0 +1,159 @@
+package directory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	directory "google.golang.org/api/admin/directory/v1"
+)
+
+// Reasons reported in ExcludedMember.Reason
+const (
+	ExcludedByRole         = "role"          // Role not in MemberFilter.Roles
+	ExcludedByStatus       = "status"        // Status not in MemberFilter.Statuses
+	ExcludedByDelivery     = "delivery"      // Delivery setting not in MemberFilter.DeliverySettings
+	ExcludedByDomain       = "domain"        // Domain not in MemberFilter.AllowDomains
+	ExcludedByDeniedDomain = "denied_domain" // Domain in MemberFilter.DenyDomains
+)
+
+// Values accepted by the Directory API for member roles and delivery settings
+var (
+	memberRoles      = []string{"OWNER", "MANAGER", "MEMBER"}
+	deliverySettings = []string{"ALL_MAIL", "DAILY", "DIGEST", "DISABLED", "NONE"}
+)
+
+// MemberFilter selects which members of a group count as attendees. Empty lists keep
+// everyone, and values are compared case-insensitively. Nested groups are always
+// expanded; the filter applies to the members they list. A member whose role, status or
+// delivery setting the API doesn't report is kept.
+type MemberFilter struct {
+	Roles            []string `json:"roles,omitempty"`             // OWNER, MANAGER or MEMBER
+	Statuses         []string `json:"statuses,omitempty"`          // e.g. ACTIVE or SUSPENDED
+	DeliverySettings []string `json:"delivery_settings,omitempty"` // ALL_MAIL, DAILY, DIGEST, DISABLED or NONE
+	AllowDomains     []string `json:"allow_domains,omitempty"`     // When set, only members of these domains are kept
+	DenyDomains      []string `json:"deny_domains,omitempty"`      // Members of these domains are dropped
+}
+
+// ExcludedMember is a group member left out by the MemberFilter
+type ExcludedMember struct {
+	Email  string
+	Group  string // Group that lists the member
+	Reason string // One of the ExcludedBy constants
+	Value  string // The role, status, delivery setting or domain that was rejected
+}
+
+// IsZero reports whether the filter keeps every member
+func (f MemberFilter) IsZero() bool {
+	return len(f.Roles) == 0 && len(f.Statuses) == 0 && len(f.DeliverySettings) == 0 &&
+		len(f.AllowDomains) == 0 && len(f.DenyDomains) == 0
+}
+
+// Equal reports whether both filters keep the same members, ignoring order, case and duplicates
+func (f MemberFilter) Equal(other MemberFilter) bool {
+	return sameValues(f.Roles, other.Roles, strings.ToUpper) &&
+		sameValues(f.Statuses, other.Statuses, strings.ToUpper) &&
+		sameValues(f.DeliverySettings, other.DeliverySettings, strings.ToUpper) &&
+		sameValues(f.AllowDomains, other.AllowDomains, normalizeDomain) &&
+		sameValues(f.DenyDomains, other.DenyDomains, normalizeDomain)
+}
+
+// Validate checks roles and delivery settings against the values the Directory API uses
+func (f MemberFilter) Validate() error {
+	for _, role := range f.Roles {
+		if !containsFold(memberRoles, role) {
+			return fmt.Errorf("unknown member role %q (expected %s)", role, strings.Join(memberRoles, ", "))
+		}
+	}
+	for _, setting := range f.DeliverySettings {
+		if !containsFold(deliverySettings, setting) {
+			return fmt.Errorf("unknown delivery setting %q (expected %s)", setting, strings.Join(deliverySettings, ", "))
+		}
+	}
+	return nil
+}
+
+// exclusion returns why member is filtered out and the rejected value, or an empty reason to keep it
+func (f MemberFilter) exclusion(member *directory.Member) (reason, value string) {
+	domain := emailDomain(member.Email)
+	if len(f.DenyDomains) > 0 && containsDomain(f.DenyDomains, domain) {
+		return ExcludedByDeniedDomain, domain
+	}
+	if len(f.AllowDomains) > 0 && !containsDomain(f.AllowDomains, domain) {
+		return ExcludedByDomain, domain
+	}
+	if member.Role != "" && len(f.Roles) > 0 && !containsFold(f.Roles, member.Role) {
+		return ExcludedByRole, member.Role
+	}
+	if member.Status != "" && len(f.Statuses) > 0 && !containsFold(f.Statuses, member.Status) {
+		return ExcludedByStatus, member.Status
+	}
+	if member.DeliverySettings != "" && len(f.DeliverySettings) > 0 && !containsFold(f.DeliverySettings, member.DeliverySettings) {
+		return ExcludedByDelivery, member.DeliverySettings
+	}
+	return "", ""
+}
+
+// sortExcluded orders exclusions by email, then group
+func sortExcluded(excluded []ExcludedMember) {
+	sort.Slice(excluded, func(i, j int) bool {
+		if a, b := normalizeEmail(excluded[i].Email), normalizeEmail(excluded[j].Email); a != b {
+			return a < b
+		}
+		return normalizeEmail(excluded[i].Group) < normalizeEmail(excluded[j].Group)
+	})
+}
+
+// emailDomain returns the lowercase domain of an address
+func emailDomain(email string) string {
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		return normalizeEmail(email[at+1:])
+	}
+	return ""
+}
+
+// normalizeDomain lowercases a configured domain and drops a leading @
+func normalizeDomain(domain string) string {
+	return normalizeEmail(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
+
+func containsDomain(domains []string, domain string) bool {
+	for _, candidate := range domains {
+		if normalizeDomain(candidate) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(strings.TrimSpace(candidate), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValues compares two lists as sets of normalized, non-blank values
+func sameValues(a, b []string, normalize func(string) string) bool {
+	set := func(values []string) map[string]bool {
+		normalized := make(map[string]bool, len(values))
+		for _, value := range values {
+			if value = normalize(strings.TrimSpace(value)); value != "" {
+				normalized[value] = true
+			}
+		}
+		return normalized
+	}
+	first, second := set(a), set(b)
+	if len(first) != len(second) {
+		return false
+	}
+	for value := range first {
+		if !second[value] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	directory "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// CacheKindUsers holds the primary address of each looked-up address
+const CacheKindUsers = "users"
+
+// ErrUserScopeMissing is returned when the credentials can't read users from the Directory API
+var ErrUserScopeMissing = errors.New("the credentials are not authorized to read users (admin.directory.user.readonly)")
+
+// cachedUser is the cache entry for one Users.Get lookup. Addresses that are not users
+// of the domain (external people, groups) are cached with their own address as primary.
+type cachedUser struct {
+	Primary string `json:"primary"`
+}
+
+// PrimaryEmails maps each address to the primary address of its Directory account, so
+// aliases of the same person can be merged. Keys are normalized; addresses that are not
+// users of the domain map to themselves, as they do when the lookup fails. Lookups use
+// opts.Cache when set, run up to opts.Concurrency at a time and share opts.Limiter and
+// opts.Retrier with group resolution.
+// An error is returned only when the credentials can't read users at all.
+func PrimaryEmails(ctx context.Context, service *directory.Service, emails []string, opts ResolveOptions) (map[string]string, error) {
+	r := newResolver(service, opts)
+	// Look each distinct address up once
+	primaries := make(map[string]string, len(emails))
+	var unique []string
+	for _, email := range emails {
+		key := normalizeEmail(email)
+		if _, seen := primaries[key]; key == "" || seen {
+			continue
+		}
+		primaries[key] = strings.TrimSpace(email)
+		unique = append(unique, primaries[key])
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		scopeErr error
+	)
+	for _, email := range unique {
+		wg.Add(1)
+		go func(email string) {
+			defer wg.Done()
+			primary, err := r.primaryEmail(ctx, email)
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, ErrUserScopeMissing) {
+				scopeErr = err
+				return
+			}
+			if err != nil {
+				log.Debug().Err(err).Str("email", email).Msg("Could not look up primary address, keeping it as is")
+				return
+			}
+			primaries[normalizeEmail(email)] = primary
+		}(email)
+	}
+	wg.Wait()
+
+	if scopeErr != nil {
+		return nil, scopeErr
+	}
+	if r.cached > 0 {
+		log.Debug().Int("cached_users", r.cached).Msg("Primary addresses served from the cache")
+	}
+	return primaries, nil
+}
+
+// primaryEmail returns the primary address of the account email belongs to
+func (r *resolver) primaryEmail(ctx context.Context, email string) (string, error) {
+	key := normalizeEmail(email)
+
+	var cached cachedUser
+	if hit, err := r.opts.Cache.Get(CacheKindUsers, key, &cached); err == nil && hit && cached.Primary != "" {
+		r.mu.Lock()
+		r.cached++
+		r.mu.Unlock()
+		return cached.Primary, nil
+	}
+	if r.service == nil || r.opts.Cache.Offline() {
+		return email, nil
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	var user *directory.User
+	err := r.call(ctx, "directory.users_get", func() error {
+		var callErr error
+		user, callErr = r.service.Users.Get(email).Fields("primaryEmail").Context(ctx).Do()
+		return callErr
+	})
+
+	primary := email
+	switch {
+	case err == nil && user.PrimaryEmail != "":
+		primary = user.PrimaryEmail
+	case err == nil:
+	case isScopeError(err):
+		return "", fmt.Errorf("%w: %v", ErrUserScopeMissing, err)
+	case !isNotUserError(err):
+		return "", err
+	}
+
+	if r.opts.Cache != nil {
+		if err := r.opts.Cache.Put(CacheKindUsers, key, cachedUser{Primary: primary}); err != nil {
+			log.Warn().Err(err).Str("email", email).Msg("Failed to cache primary address")
+		}
+	}
+	if !strings.EqualFold(primary, email) {
+		log.Debug().Str("email", email).Str("primary", primary).Msg("Address is an alias")
+	}
+	return primary, nil
+}
+
+// isScopeError reports whether err means the token lacks the user read scope
+func isScopeError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(apiErr.Message, "insufficient authentication scopes")
+}
+
+// isNotUserError reports whether err means the address is not a user the domain can read:
+// unknown users and groups are not found, and users of other domains are forbidden
+func isNotUserError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusForbidden:
+		return true
+	}
+	return false
+}
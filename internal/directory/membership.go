@@ -0,0 +1,175 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/cache"
+	"github.com/rs/zerolog/log"
+	directory "google.golang.org/api/admin/directory/v1"
+)
+
+// Cache entry kinds used by the directory package
+const (
+	CacheKindMembers   = "groupmembers" // Direct members of one group, as listed by Members.List
+	CacheKindSnapshots = "groups"       // Fully expanded membership of a requested group
+)
+
+// DefaultCacheTTL is how long cached member lists stay fresh; large lists rarely change
+const DefaultCacheTTL = 24 * time.Hour
+
+// ErrNotCached is returned in offline mode for groups whose members are not cached
+var ErrNotCached = errors.New("group membership is not cached")
+
+// ErrFilterChanged is returned when comparing memberships resolved with different member filters
+var ErrFilterChanged = errors.New("the previous membership was resolved with different member filters")
+
+// errNotGroup is returned for addresses the cache remembers are not groups
+var errNotGroup = errors.New("not a group (cached)")
+
+// cachedListing is the cache entry for one Members.List result. Addresses that turned
+// out not to be groups are cached too, so they are not probed again on every run.
+type cachedListing struct {
+	Members  []*directory.Member `json:"members,omitempty"`
+	NotGroup bool                `json:"not_group,omitempty"`
+}
+
+// MembershipSnapshot is the expanded membership of a group at the time it was resolved.
+// Members are those kept by Filter, so only resolutions with the same filter compare.
+type MembershipSnapshot struct {
+	Group      string       `json:"group"`
+	Members    []string     `json:"members"`
+	Filter     MemberFilter `json:"filter"`
+	ResolvedAt time.Time    `json:"resolved_at"`
+}
+
+// MembershipDiff lists who joined or left a group between two resolutions
+type MembershipDiff struct {
+	Group  string
+	Since  time.Time // When the previous snapshot was taken
+	Joined []string
+	Left   []string
+}
+
+// LoadSnapshot returns the last cached membership of group, whatever its age
+func LoadSnapshot(store *cache.Store, group string) (*MembershipSnapshot, bool, error) {
+	if store == nil {
+		return nil, false, nil
+	}
+	snapshot := &MembershipSnapshot{}
+	found, err := store.Peek(CacheKindSnapshots, listingKey(group), snapshot)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return snapshot, true, nil
+}
+
+// DiffMembers compares two member lists case-insensitively. Both results are sorted.
+func DiffMembers(previous, current []string) (joined, left []string) {
+	before := make(map[string]string, len(previous))
+	for _, email := range previous {
+		keepOriginal(before, email)
+	}
+	after := make(map[string]string, len(current))
+	for _, email := range current {
+		keepOriginal(after, email)
+	}
+
+	joinedSet := make(map[string]string)
+	for key, email := range after {
+		if _, ok := before[key]; !ok {
+			joinedSet[key] = email
+		}
+	}
+	leftSet := make(map[string]string)
+	for key, email := range before {
+		if _, ok := after[key]; !ok {
+			leftSet[key] = email
+		}
+	}
+	return sortedValues(joinedSet), sortedValues(leftSet)
+}
+
+// Diff compares the snapshot with the current member list, resolved with filter. It returns
+// ErrFilterChanged when the snapshot used another filter, since members left out by one
+// filter but not the other would show up as joining or leaving.
+func (s *MembershipSnapshot) Diff(current []string, filter MemberFilter) (MembershipDiff, error) {
+	if !s.Filter.Equal(filter) {
+		return MembershipDiff{}, ErrFilterChanged
+	}
+	joined, left := DiffMembers(s.Members, current)
+	return MembershipDiff{Group: s.Group, Since: s.ResolvedAt, Joined: joined, Left: left}, nil
+}
+
+// listingKey identifies a member list or membership snapshot in the run and in the cache.
+// Group addresses are case-insensitive, but Directory search query values are not, so
+// queries keep their case.
+func listingKey(key string) string {
+	if selector, ok := ParseSelector(key); ok && selector.Kind == SelectorQuery {
+		return selector.String()
+	}
+	return normalizeEmail(key)
+}
+
+// cachedMembers loads the direct members of a group from the cache
+func (r *resolver) cachedMembers(groupEmail string) (*cachedListing, bool) {
+	listing := &cachedListing{}
+	hit, err := r.opts.Cache.Get(CacheKindMembers, listingKey(groupEmail), listing)
+	if err != nil {
+		log.Debug().Err(err).Str("group", groupEmail).Msg("Ignoring unreadable group cache entry")
+		return nil, false
+	}
+	return listing, hit
+}
+
+// storeMembers caches the fields of a member list that resolution uses
+func (r *resolver) storeMembers(groupEmail string, members []*directory.Member) {
+	if r.opts.Cache == nil {
+		return
+	}
+	trimmed := make([]*directory.Member, 0, len(members))
+	for _, member := range members {
+		if member == nil {
+			continue
+		}
+		trimmed = append(trimmed, &directory.Member{
+			Email:            member.Email,
+			Type:             member.Type,
+			Role:             member.Role,
+			Status:           member.Status,
+			DeliverySettings: member.DeliverySettings,
+		})
+	}
+	r.putListing(groupEmail, cachedListing{Members: trimmed})
+}
+
+// storeNotGroup remembers that an address is not a group the Directory API can list
+func (r *resolver) storeNotGroup(groupEmail string) {
+	if r.opts.Cache == nil {
+		return
+	}
+	r.putListing(groupEmail, cachedListing{NotGroup: true})
+}
+
+func (r *resolver) putListing(groupEmail string, listing cachedListing) {
+	if err := r.opts.Cache.Put(CacheKindMembers, listingKey(groupEmail), listing); err != nil {
+		log.Warn().Err(err).Str("group", groupEmail).Msg("Failed to cache group members")
+	}
+}
+
+// storeSnapshot records the expanded membership of a requested group for later diffs
+func (r *resolver) storeSnapshot(groupEmail string, members []string) {
+	if r.opts.Cache == nil {
+		return
+	}
+	snapshot := MembershipSnapshot{Group: groupEmail, Members: members, Filter: r.opts.Filter, ResolvedAt: time.Now().UTC()}
+	if err := r.opts.Cache.Put(CacheKindSnapshots, listingKey(groupEmail), snapshot); err != nil {
+		log.Warn().Err(err).Str("group", groupEmail).Msg("Failed to cache group membership")
+	}
+}
+
+// notCached is the error for a group missing from the cache when no API calls are allowed
+func notCached(groupEmail string) error {
+	return fmt.Errorf("%s: %w (run once without --offline)", groupEmail, ErrNotCached)
+}
@@ -0,0 +1,206 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	directory "google.golang.org/api/admin/directory/v1"
+)
+
+// Selector kinds accepted in place of a mailing list address, written kind:value
+const (
+	SelectorReportsOf = "reports-of" // Everyone reporting to a manager, directly or not: reports-of:alice@example.com
+	SelectorOrgUnit   = "orgunit"    // Users of an org unit and its sub-units: orgunit:/Engineering/Platform
+	SelectorQuery     = "query"      // Users matching a Directory search query: query:orgTitle='Engineer'
+)
+
+// customerID selects the domain of the authenticated account in Users.List
+const customerID = "my_customer"
+
+// Selector picks attendees from the organization structure rather than a mailing list
+type Selector struct {
+	Kind  string
+	Value string
+}
+
+func (s Selector) String() string {
+	return s.Kind + ":" + s.Value
+}
+
+// ParseSelector recognizes kind:value selectors. It reports false for plain addresses.
+func ParseSelector(entry string) (Selector, bool) {
+	kind, value, found := strings.Cut(strings.TrimSpace(entry), ":")
+	if !found {
+		return Selector{}, false
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	switch kind {
+	case SelectorReportsOf, SelectorOrgUnit, SelectorQuery:
+		return Selector{Kind: kind, Value: strings.TrimSpace(value)}, true
+	}
+	return Selector{}, false
+}
+
+// validate checks the selector value before any API call
+func (s Selector) validate() error {
+	switch {
+	case s.Value == "":
+		return fmt.Errorf("selector %s needs a value", s.Kind)
+	case s.Kind == SelectorReportsOf && !strings.Contains(s.Value, "@"):
+		return fmt.Errorf("reports-of needs the manager's email address, got %q", s.Value)
+	case s.Kind == SelectorOrgUnit && !strings.HasPrefix(s.Value, "/"):
+		return fmt.Errorf("orgunit needs a path starting with /, got %q", s.Value)
+	}
+	return nil
+}
+
+// quoteQueryValue quotes a value for a Directory search query
+func quoteQueryValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// getSelectorMembers resolves a selector into the users it designates
+func (r *resolver) getSelectorMembers(ctx context.Context, selector Selector) ([]string, *groupResolutionContext, error) {
+	// A manager chain is rooted at the manager, so depth counts levels of reports
+	root := selector.String()
+	if selector.Kind == SelectorReportsOf {
+		root = selector.Value
+	}
+	state := newGroupResolutionContext(root)
+	if err := selector.validate(); err != nil {
+		return nil, state, &GroupResolutionError{Email: selector.String(), Err: err, ErrorType: "invalid_selector"}
+	}
+
+	var err error
+	switch selector.Kind {
+	case SelectorReportsOf:
+		state.claim(selector.Value)
+		err = r.getReportsRecursive(ctx, selector.Value, state)
+	case SelectorOrgUnit:
+		err = r.addQueryMembers(ctx, selector.String(), "orgUnitPath="+quoteQueryValue(selector.Value), state)
+	case SelectorQuery:
+		err = r.addQueryMembers(ctx, selector.String(), selector.Value, state)
+	}
+	if err != nil {
+		return nil, state, &GroupResolutionError{Email: selector.String(), Err: err, ErrorType: categorizeError(err)}
+	}
+	state.finish()
+
+	return state.members(), state, nil
+}
+
+// addQueryMembers adds the users matching a search query, listed under parent in exclusions
+func (r *resolver) addQueryMembers(ctx context.Context, parent, query string, state *groupResolutionContext) error {
+	users, err := r.listUsers(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		r.addUser(parent, user, state)
+	}
+	return nil
+}
+
+// getReportsRecursive adds the direct reports of manager and, in parallel, their own reports.
+// The caller must have claimed manager in state. Reports left out by the filter are still
+// followed, since people reporting to them belong to the same organization.
+func (r *resolver) getReportsRecursive(ctx context.Context, manager string, state *groupResolutionContext) error {
+	reports, err := r.listUsers(ctx, "directManager="+quoteQueryValue(manager))
+	if err != nil {
+		return err
+	}
+
+	var next []string
+	for _, report := range reports {
+		if report == nil || strings.TrimSpace(report.Email) == "" {
+			continue
+		}
+		r.addUser(manager, report, state)
+		next = append(next, strings.TrimSpace(report.Email))
+	}
+	state.addReports(manager, next)
+
+	var wg sync.WaitGroup
+	for _, report := range next {
+		if !state.claim(report) {
+			continue
+		}
+		wg.Add(1)
+		go func(report string) {
+			defer wg.Done()
+			if err := r.getReportsRecursive(ctx, report, state); err != nil {
+				log.Warn().
+					Err(err).
+					Str("manager", report).
+					Str("root", state.rootEmail).
+					Msg("Could not list reports, continuing with the rest of the organization")
+				state.fail(report, err)
+			}
+		}(report)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// addUser adds a user found by a selector, unless the member filter leaves them out
+func (r *resolver) addUser(parent string, user *directory.Member, state *groupResolutionContext) {
+	email := strings.TrimSpace(user.Email)
+	if email == "" {
+		return
+	}
+	if reason, value := r.opts.Filter.exclusion(user); reason != "" {
+		state.exclude(ExcludedMember{Email: email, Group: parent, Reason: reason, Value: value})
+		return
+	}
+	state.addMember(email)
+}
+
+// listUsers returns the users matching a Directory search query, at most once per run.
+// Users are returned as members so they share the member list cache and filters.
+func (r *resolver) listUsers(ctx context.Context, query string) ([]*directory.Member, error) {
+	return r.list(ctx, SelectorQuery+":"+query, func() ([]*directory.Member, error) {
+		var users []*directory.Member
+		pageToken := ""
+		for {
+			call := r.service.Users.
+				List().
+				Customer(customerID).
+				Query(query).
+				MaxResults(500).
+				Fields("users(primaryEmail,suspended,archived)", "nextPageToken").
+				Context(ctx)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+
+			var resp *directory.Users
+			err := r.call(ctx, "directory.users_list", func() error {
+				var callErr error
+				resp, callErr = call.Do()
+				return callErr
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, user := range resp.Users {
+				status := "ACTIVE"
+				switch {
+				case user.Archived:
+					status = "ARCHIVED"
+				case user.Suspended:
+					status = "SUSPENDED"
+				}
+				users = append(users, &directory.Member{Email: user.PrimaryEmail, Type: "USER", Status: status})
+			}
+
+			pageToken = resp.NextPageToken
+			if pageToken == "" {
+				return users, nil
+			}
+		}
+	})
+}
@@ -1,55 +1,77 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
 	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Log formats accepted by Options.Format
+const (
+	FormatConsole = "console" // Human-readable lines, colored on a terminal
+	FormatJSON    = "json"    // One JSON object per line
+)
+
 var Logger zerolog.Logger
 
+// Options configures the logger
+type Options struct {
+	Debug  bool
+	Format string // FormatConsole when empty
+	File   string // Write logs to this file instead of stderr; warnings and errors still reach stderr
+}
+
+// output is where user-facing notices go. Logs, progress and warnings share stderr so
+// stdout carries only the selected result format; the console keeps them off the progress bar line.
+var output io.Writer = progress.NewConsole(os.Stderr)
+
+// logFile is the file opened for Options.File, closed by Close
+var logFile *os.File
+
 // Init initializes the logger with appropriate settings
-func Init(debug bool) {
+func Init(opts Options) error {
 	zerolog.TimeFieldFormat = time.RFC3339
 
-	// Detect if we're running in a terminal
-	isTerminal := isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
-	
-	// Allow forcing console output via environment variable for testing
-	if os.Getenv("FORCE_COLOR") == "1" || os.Getenv("FORCE_PRETTY") == "1" {
-		isTerminal = true
-	}
-
-	var output io.Writer = os.Stdout
-	
-	if isTerminal && !debug {
-		// Pretty print for terminal with colors
-		output = zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: "15:04:05",
-			NoColor:    false,
-		}
-	} else if isTerminal && debug {
-		// Pretty print for terminal in debug mode with more details
-		output = zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: "2006-01-02 15:04:05",
-			NoColor:    false,
-		}
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	switch format {
+	case "":
+		format = FormatConsole
+	case FormatConsole, FormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %q (expected %s or %s)", opts.Format, FormatConsole, FormatJSON)
 	}
-	// For non-terminal (e.g., piped output), use JSON format
 
 	// Set global log level
 	level := zerolog.InfoLevel
-	if debug {
+	if opts.Debug {
 		level = zerolog.DebugLevel
 	}
 
-	Logger = zerolog.New(output).
+	var writer io.Writer = newWriter(output, format, isTerminal(os.Stderr), opts.Debug)
+
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		Close()
+		logFile = file
+
+		// The file gets every log line; stderr keeps warnings and errors so failures stay visible
+		writer = zerolog.MultiLevelWriter(
+			newWriter(file, format, false, opts.Debug),
+			minLevelWriter{Writer: writer, level: zerolog.WarnLevel},
+		)
+	}
+
+	Logger = zerolog.New(writer).
 		Level(level).
 		With().
 		Timestamp().
@@ -57,4 +79,70 @@ func Init(debug bool) {
 
 	// Set global logger
 	log.Logger = Logger
+	return nil
+}
+
+// Close closes the log file opened by Init, if any
+func Close() error {
+	if logFile == nil {
+		return nil
+	}
+	err := logFile.Close()
+	logFile = nil
+	return err
+}
+
+// Writer returns the stderr writer used for user-facing notices
+func Writer() io.Writer {
+	return output
+}
+
+// Printf writes a user-facing notice (warning banners, prompts) to stderr
+func Printf(format string, args ...interface{}) {
+	fmt.Fprintf(output, format, args...)
+}
+
+// Println writes a user-facing notice line to stderr
+func Println(args ...interface{}) {
+	fmt.Fprintln(output, args...)
+}
+
+// isTerminal reports whether f is a terminal, honoring FORCE_COLOR and FORCE_PRETTY
+func isTerminal(f *os.File) bool {
+	// Allow forcing console output via environment variable for testing
+	if os.Getenv("FORCE_COLOR") == "1" || os.Getenv("FORCE_PRETTY") == "1" {
+		return true
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// newWriter formats log lines for out. Colors are only used on terminals.
+func newWriter(out io.Writer, format string, terminal, debug bool) io.Writer {
+	if format == FormatJSON {
+		return out
+	}
+
+	timeFormat := "15:04:05"
+	if debug {
+		// More details in debug mode
+		timeFormat = "2006-01-02 15:04:05"
+	}
+	return zerolog.ConsoleWriter{
+		Out:        out,
+		TimeFormat: timeFormat,
+		NoColor:    !terminal,
+	}
+}
+
+// minLevelWriter drops log lines below level
+type minLevelWriter struct {
+	io.Writer
+	level zerolog.Level
+}
+
+func (w minLevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.level {
+		return len(p), nil
+	}
+	return w.Writer.Write(p)
 }
@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestInitWritesLogsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.log")
+	if err := Init(Options{Debug: true, Format: FormatJSON, File: path}); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	log.Debug().Msg("debug line")
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"message":"debug line"`) {
+		t.Fatalf("expected JSON debug line in log file, got %q", data)
+	}
+}
+
+func TestInitDefaultsToConsoleFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.log")
+	if err := Init(Options{File: path}); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	log.Info().Msg("info line")
+	if err := Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	if !strings.Contains(string(data), "INF info line") || strings.Contains(string(data), `"message"`) {
+		t.Fatalf("expected a console line without JSON or colors, got %q", data)
+	}
+}
+
+func TestInitRejectsUnknownFormat(t *testing.T) {
+	if err := Init(Options{Format: "xml"}); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func TestMinLevelWriterDropsLowerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	writer := minLevelWriter{Writer: &buf, level: zerolog.WarnLevel}
+
+	writer.WriteLevel(zerolog.InfoLevel, []byte("info\n"))
+	writer.WriteLevel(zerolog.ErrorLevel, []byte("error\n"))
+
+	if buf.String() != "error\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
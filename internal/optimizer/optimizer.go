@@ -1,6 +1,7 @@
 package optimizer
 
 import (
+	"context"
 	"sort"
 	"time"
 
@@ -18,6 +19,8 @@ type MeetingSlot struct {
 	OutsideWorkingHours map[string]bool     // Email -> true if outside their working hours
 	ConflictsByType     map[string][]string // Type -> list of emails (types: "calendar", "working_hours", "holiday")
 	HolidayConflicts    map[string]string   // Email -> holiday name
+	UnknownEmails       []string            // Attendees whose availability could not be read (excluded from conflict counts)
+	ConflictCalendars   map[string][]string // Email -> calendar IDs with a busy block overlapping the slot
 }
 
 // FindOptimalMeetingSlots finds the best meeting times based on availability (legacy version)
@@ -41,6 +44,10 @@ func findOptimalMeetingSlotsLegacy(
 			available := []string{}
 
 			for _, userAvail := range availabilities {
+				if userAvail.IsUnknown() {
+					continue
+				}
+
 				hasConflict := false
 				for _, busySlot := range userAvail.BusySlots {
 					// Check if the meeting overlaps with this busy slot
@@ -57,7 +64,7 @@ func findOptimalMeetingSlotsLegacy(
 				}
 			}
 
-			totalUsers := len(availabilities)
+			totalUsers := len(unavailable) + len(available)
 			conflictPercentage := 0.0
 			if totalUsers > 0 {
 				conflictPercentage = float64(len(unavailable)) / float64(totalUsers) * 100
@@ -98,18 +105,24 @@ func findOptimalMeetingSlotsLegacy(
 	return meetingSlots
 }
 
-// FindOptimalMeetingSlots finds the best meeting times considering timezones
+// FindOptimalMeetingSlots finds the best meeting times considering timezones.
+// It stops early and returns ctx.Err() when ctx is canceled.
 func FindOptimalMeetingSlots(
+	ctx context.Context,
 	availabilities []calendar.UserAvailability,
 	potentialSlots []calendar.TimeSlot,
 	meetingDuration time.Duration,
 	maxSlots int,
 	workingHours WorkingHoursConfig,
-) []MeetingSlot {
+) ([]MeetingSlot, error) {
 	var meetingSlots []MeetingSlot
 
 	// For each potential time slot
 	for _, slot := range potentialSlots {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Generate meeting slots of the requested duration within this slot
 		currentStart := slot.Start
 		for currentStart.Add(meetingDuration).Before(slot.End) || currentStart.Add(meetingDuration).Equal(slot.End) {
@@ -125,8 +138,16 @@ func FindOptimalMeetingSlots(
 				"holiday":       {},
 			}
 			holidayConflicts := make(map[string]string)
+			conflictCalendars := make(map[string][]string)
+			unknown := []string{}
 
 			for _, userAvail := range availabilities {
+				// Attendees with unreadable calendars are flagged rather than counted as free
+				if userAvail.IsUnknown() {
+					unknown = append(unknown, userAvail.Email)
+					continue
+				}
+
 				isUnavailable := false
 				conflictType := ""
 				var conflictHolidayName string
@@ -151,7 +172,7 @@ func FindOptimalMeetingSlots(
 							if overlaps(currentStart, meetingEnd, busySlot.Start, busySlot.End) {
 								isUnavailable = true
 								conflictType = "calendar"
-								break
+								conflictCalendars[userAvail.Email] = appendCalendar(conflictCalendars[userAvail.Email], busySlot.Calendar, userAvail.Email)
 							}
 						}
 					}
@@ -168,7 +189,7 @@ func FindOptimalMeetingSlots(
 				}
 			}
 
-			totalUsers := len(availabilities)
+			totalUsers := len(unavailable) + len(available)
 			conflictPercentage := 0.0
 			if totalUsers > 0 {
 				conflictPercentage = float64(len(unavailable)) / float64(totalUsers) * 100
@@ -195,6 +216,8 @@ func FindOptimalMeetingSlots(
 				OutsideWorkingHours: outsideWorkingHours,
 				ConflictsByType:     conflictsByType,
 				HolidayConflicts:    holidayConflicts,
+				UnknownEmails:       unknown,
+				ConflictCalendars:   conflictCalendars,
 			})
 
 			// Move to next slot (30-minute increments)
@@ -218,9 +241,23 @@ func FindOptimalMeetingSlots(
 
 	// Return only the top N slots
 	if len(meetingSlots) > maxSlots {
-		return meetingSlots[:maxSlots]
+		return meetingSlots[:maxSlots], nil
 	}
-	return meetingSlots
+	return meetingSlots, nil
+}
+
+// appendCalendar adds a calendar ID to the list if not already present.
+// Slots without a source calendar are attributed to the attendee's own calendar.
+func appendCalendar(calendars []string, calendarID, email string) []string {
+	if calendarID == "" {
+		calendarID = email
+	}
+	for _, existing := range calendars {
+		if existing == calendarID {
+			return calendars
+		}
+	}
+	return append(calendars, calendarID)
 }
 
 // WorkingHoursConfig holds working hours configuration
@@ -0,0 +1,152 @@
+package optimizer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+)
+
+var day = time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+func at(hour, minute int) time.Time {
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func busy(startHour, startMinute, endHour, endMinute int, calendarID string) calendar.TimeSlot {
+	return calendar.TimeSlot{Start: at(startHour, startMinute), End: at(endHour, endMinute), Calendar: calendarID}
+}
+
+func known(email string, slots ...calendar.TimeSlot) calendar.UserAvailability {
+	return calendar.UserAvailability{Email: email, BusySlots: slots, Status: calendar.AvailabilityKnown}
+}
+
+func unknown(email string) calendar.UserAvailability {
+	return calendar.UserAvailability{Email: email, Status: calendar.AvailabilityUnknown}
+}
+
+func TestFindOptimalMeetingSlotsCountsConflicts(t *testing.T) {
+	tests := []struct {
+		name           string
+		availabilities []calendar.UserAvailability
+		unavailable    []string
+		available      []string
+		unknown        []string
+		percentage     float64
+		calendars      map[string][]string
+	}{
+		{
+			name:           "unknown attendees are left out of the percentage",
+			availabilities: []calendar.UserAvailability{known("ana@example.com", busy(9, 0, 10, 0, "ana@example.com")), known("bob@example.com"), unknown("cy@example.com")},
+			unavailable:    []string{"ana@example.com"},
+			available:      []string{"bob@example.com"},
+			unknown:        []string{"cy@example.com"},
+			percentage:     50,
+			calendars:      map[string][]string{"ana@example.com": {"ana@example.com"}},
+		},
+		{
+			name:           "nobody known means no conflict",
+			availabilities: []calendar.UserAvailability{unknown("ana@example.com"), unknown("bob@example.com")},
+			unavailable:    []string{},
+			available:      []string{},
+			unknown:        []string{"ana@example.com", "bob@example.com"},
+			percentage:     0,
+			calendars:      map[string][]string{},
+		},
+		{
+			name: "conflicts are attributed to each overlapping calendar once",
+			availabilities: []calendar.UserAvailability{
+				known("ana@example.com",
+					busy(9, 0, 9, 15, "ana-oncall"),
+					busy(9, 15, 9, 30, ""),
+					busy(9, 30, 9, 45, "ana-oncall"),
+					busy(11, 0, 12, 0, "ana-personal"),
+				),
+				known("bob@example.com"),
+				known("cy@example.com"),
+				known("dee@example.com", busy(8, 0, 9, 30, "dee@example.com")),
+			},
+			unavailable: []string{"ana@example.com", "dee@example.com"},
+			available:   []string{"bob@example.com", "cy@example.com"},
+			unknown:     []string{},
+			percentage:  50,
+			calendars: map[string][]string{
+				"ana@example.com": {"ana-oncall", "ana@example.com"},
+				"dee@example.com": {"dee@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots, err := FindOptimalMeetingSlots(context.Background(), tt.availabilities,
+				[]calendar.TimeSlot{{Start: at(9, 0), End: at(10, 0)}}, time.Hour, 10, WorkingHoursConfig{})
+			if err != nil {
+				t.Fatalf("find slots: %v", err)
+			}
+			if len(slots) != 1 {
+				t.Fatalf("expected 1 slot, got %d", len(slots))
+			}
+			slot := slots[0]
+			if !reflect.DeepEqual(slot.UnavailableEmails, tt.unavailable) || !reflect.DeepEqual(slot.AvailableEmails, tt.available) {
+				t.Fatalf("unexpected attendees: unavailable %v, available %v", slot.UnavailableEmails, slot.AvailableEmails)
+			}
+			if !reflect.DeepEqual(slot.UnknownEmails, tt.unknown) {
+				t.Fatalf("unexpected unknown attendees %v", slot.UnknownEmails)
+			}
+			if slot.UnavailableCount != len(tt.unavailable) || slot.ConflictPercentage != tt.percentage {
+				t.Fatalf("expected %d conflicts (%.0f%%), got %d (%.2f%%)",
+					len(tt.unavailable), tt.percentage, slot.UnavailableCount, slot.ConflictPercentage)
+			}
+			if !reflect.DeepEqual(slot.ConflictCalendars, tt.calendars) {
+				t.Fatalf("unexpected conflict calendars %v", slot.ConflictCalendars)
+			}
+		})
+	}
+}
+
+func TestFindOptimalMeetingSlotsRanksByConflictPercentage(t *testing.T) {
+	// 9:30 is free for everyone who could be read. 9:00 and 10:00 keep one of the two known
+	// attendees busy (50%, not 33%: the unknown attendee is not counted), and the earlier wins.
+	availabilities := []calendar.UserAvailability{
+		known("ana@example.com", busy(9, 0, 9, 30, ""), busy(10, 0, 10, 30, "")),
+		known("bob@example.com"),
+		unknown("cy@example.com"),
+	}
+	slots, err := FindOptimalMeetingSlots(context.Background(), availabilities,
+		[]calendar.TimeSlot{{Start: at(9, 0), End: at(10, 30)}}, 30*time.Minute, 2, WorkingHoursConfig{})
+	if err != nil {
+		t.Fatalf("find slots: %v", err)
+	}
+
+	var starts []time.Time
+	var percentages []float64
+	for _, slot := range slots {
+		starts = append(starts, slot.TimeSlot.Start)
+		percentages = append(percentages, slot.ConflictPercentage)
+	}
+	if !reflect.DeepEqual(starts, []time.Time{at(9, 30), at(9, 0)}) || !reflect.DeepEqual(percentages, []float64{0, 50}) {
+		t.Fatalf("unexpected ranking %v with %v", starts, percentages)
+	}
+}
+
+func TestAppendCalendar(t *testing.T) {
+	tests := []struct {
+		calendars []string
+		id        string
+		want      []string
+	}{
+		{nil, "", []string{"ana@example.com"}},
+		{nil, "ana-oncall", []string{"ana-oncall"}},
+		{[]string{"ana-oncall"}, "ana-oncall", []string{"ana-oncall"}},
+		{[]string{"ana@example.com"}, "", []string{"ana@example.com"}},
+		{[]string{"ana-oncall"}, "ana-personal", []string{"ana-oncall", "ana-personal"}},
+	}
+	for _, tt := range tests {
+		if got := appendCalendar(tt.calendars, tt.id, "ana@example.com"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("appendCalendar(%v, %q) = %v, want %v", tt.calendars, tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Stages reported by the directory and calendar packages
+const (
+	StageGroups  = "groups"  // Mailing lists expanded (the total grows as nested groups are found)
+	StageBatches = "batches" // FreeBusy batches fetched
+)
+
+// Event describes the progress of a long-running stage
+type Event struct {
+	Stage    string        // One of the Stage constants
+	Item     string        // Group email or batch label that just completed (empty for start events)
+	Done     int           // Items completed so far
+	Failed   int           // Items that completed with an error
+	Total    int           // Items known so far
+	Elapsed  time.Duration // Time since the stage started
+	ETA      time.Duration // Estimated time remaining (0 when unknown)
+	Finished bool          // Set on the last event of the stage
+}
+
+// Reporter receives progress events. Implementations must be safe for concurrent use.
+type Reporter interface {
+	Report(Event)
+}
+
+// Func adapts a function to the Reporter interface
+type Func func(Event)
+
+// Report calls f(event)
+func (f Func) Report(event Event) {
+	f(event)
+}
+
+// Tracker counts completed items for one stage and reports each change.
+// A nil *Tracker is valid and reports nothing, so callers need no checks.
+type Tracker struct {
+	reporter Reporter
+	stage    string
+	started  time.Time
+
+	mutex  sync.Mutex
+	done   int
+	failed int
+	total  int
+}
+
+// NewTracker starts a stage with total items; it returns nil when reporter is nil
+func NewTracker(reporter Reporter, stage string, total int) *Tracker {
+	if reporter == nil {
+		return nil
+	}
+	t := &Tracker{reporter: reporter, stage: stage, started: time.Now(), total: total}
+	t.report("", false)
+	return t
+}
+
+// Add grows the total, e.g. when a nested group is discovered
+func (t *Tracker) Add(n int) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.total += n
+}
+
+// Done marks one item as completed; a non-nil err counts it as failed
+func (t *Tracker) Done(item string, err error) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.done++
+	if err != nil {
+		t.failed++
+	}
+	t.report(item, false)
+}
+
+// Finish reports the final state of the stage
+func (t *Tracker) Finish() {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.report("", true)
+}
+
+// report sends the current state; callers hold the mutex (or own t exclusively)
+func (t *Tracker) report(item string, finished bool) {
+	event := Event{
+		Stage:    t.stage,
+		Item:     item,
+		Done:     t.done,
+		Failed:   t.failed,
+		Total:    t.total,
+		Elapsed:  time.Since(t.started),
+		Finished: finished,
+	}
+	if t.done > 0 && t.total > t.done && !finished {
+		event.ETA = event.Elapsed / time.Duration(t.done) * time.Duration(t.total-t.done)
+	}
+	t.reporter.Report(event)
+}
+
+// Auto returns a progress bar on out when terminal is a terminal and nil (silent) otherwise
+func Auto(terminal *os.File, out io.Writer) Reporter {
+	if !isatty.IsTerminal(terminal.Fd()) && !isatty.IsCygwinTerminal(terminal.Fd()) {
+		return nil
+	}
+	return NewBar(out)
+}
+
+// Console is a writer shared by the progress bar and the log lines written to the same
+// terminal. Writes clear the bar line first and redraw the bar below complete lines, so
+// log lines never end up appended to the bar.
+type Console struct {
+	mutex sync.Mutex
+	out   io.Writer
+	line  string // Bar line currently drawn, empty when none is
+}
+
+// NewConsole creates a console writing to out
+func NewConsole(out io.Writer) *Console {
+	return &Console{out: out}
+}
+
+// Write clears the bar, writes p and redraws the bar if p ends a line
+func (c *Console) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.line == "" {
+		return c.out.Write(p)
+	}
+	io.WriteString(c.out, "\r\033[K")
+	n, err := c.out.Write(p)
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		io.WriteString(c.out, c.line)
+	} else {
+		// Partial text (e.g. a prompt) now owns the line
+		c.line = ""
+	}
+	return n, err
+}
+
+// draw replaces the bar line; finished ends it so later writes start below
+func (c *Console) draw(line string, finished bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Clear the line first so shorter redraws leave no residue
+	fmt.Fprintf(c.out, "\r\033[K%s", line)
+	c.line = line
+	if finished {
+		fmt.Fprintln(c.out)
+		c.line = ""
+	}
+}
+
+// Bar draws a single-line progress bar per stage, meant for terminals
+type Bar struct {
+	console *Console
+	width   int
+}
+
+// NewBar creates a progress bar writing to out. Log lines should be written through the
+// same *Console when out is one, so they don't mix with the bar.
+func NewBar(out io.Writer) *Bar {
+	console, ok := out.(*Console)
+	if !ok {
+		console = NewConsole(out)
+	}
+	return &Bar{console: console, width: 30}
+}
+
+var stageLabels = map[string]string{
+	StageGroups:  "Expanding groups",
+	StageBatches: "Fetching calendars",
+}
+
+// Report redraws the bar for the event's stage
+func (b *Bar) Report(event Event) {
+	label := stageLabels[event.Stage]
+	if label == "" {
+		label = event.Stage
+	}
+
+	filled := 0
+	if event.Total > 0 {
+		filled = b.width * event.Done / event.Total
+		if filled > b.width {
+			filled = b.width
+		}
+	}
+
+	line := fmt.Sprintf("%-18s [%s%s] %d/%d", label,
+		strings.Repeat("=", filled), strings.Repeat(" ", b.width-filled), event.Done, event.Total)
+	if event.Failed > 0 {
+		line += fmt.Sprintf(" (%d failed)", event.Failed)
+	}
+	if event.Finished {
+		line += fmt.Sprintf(" in %s", event.Elapsed.Round(100*time.Millisecond))
+	} else if event.ETA > 0 {
+		line += fmt.Sprintf(" ETA %s", event.ETA.Round(time.Second))
+	}
+
+	b.console.draw(line, event.Finished)
+}
+
+// Stream writes each event as a JSON line, for callers that are not terminals
+type Stream struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+// NewStream creates an event stream writing to out
+func NewStream(out io.Writer) *Stream {
+	return &Stream{out: out}
+}
+
+// streamEvent is the JSON form of an Event
+type streamEvent struct {
+	Type      string `json:"type"`
+	Stage     string `json:"stage"`
+	Item      string `json:"item,omitempty"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+	Total     int    `json:"total"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	ETAMS     int64  `json:"eta_ms,omitempty"`
+	Finished  bool   `json:"finished,omitempty"`
+}
+
+// Report writes the event as one line of JSON
+func (s *Stream) Report(event Event) {
+	data, err := json.Marshal(streamEvent{
+		Type:      "progress",
+		Stage:     event.Stage,
+		Item:      event.Item,
+		Done:      event.Done,
+		Failed:    event.Failed,
+		Total:     event.Total,
+		ElapsedMS: event.Elapsed.Milliseconds(),
+		ETAMS:     event.ETA.Milliseconds(),
+		Finished:  event.Finished,
+	})
+	if err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.out.Write(append(data, '\n'))
+}
@@ -0,0 +1,99 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTrackerReportsCountsAndGrowingTotal(t *testing.T) {
+	var events []Event
+	tracker := NewTracker(Func(func(event Event) { events = append(events, event) }), StageGroups, 1)
+
+	tracker.Add(2)
+	tracker.Done("team@example.com", nil)
+	tracker.Done("nested@example.com", errors.New("forbidden"))
+	tracker.Finish()
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+	if events[0].Done != 0 || events[0].Total != 1 {
+		t.Fatalf("unexpected start event: %+v", events[0])
+	}
+	if events[1].Item != "team@example.com" || events[1].Total != 3 {
+		t.Fatalf("unexpected done event: %+v", events[1])
+	}
+	last := events[3]
+	if !last.Finished || last.Done != 2 || last.Failed != 1 || last.ETA != 0 {
+		t.Fatalf("unexpected final event: %+v", last)
+	}
+}
+
+func TestNilTrackerIsSilent(t *testing.T) {
+	tracker := NewTracker(nil, StageBatches, 3)
+	if tracker != nil {
+		t.Fatalf("expected a nil tracker without a reporter")
+	}
+	tracker.Add(1)
+	tracker.Done("batch 1", nil)
+	tracker.Finish()
+}
+
+func TestStreamWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := NewTracker(NewStream(&buf), StageBatches, 2)
+	tracker.Done("batch 1", nil)
+	tracker.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", buf.String())
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event["type"] != "progress" || event["stage"] != StageBatches || event["item"] != "batch 1" || event["done"] != float64(1) || event["total"] != float64(2) {
+		t.Fatalf("unexpected event: %v", event)
+	}
+}
+
+func TestBarDrawsCountsAndEndsLine(t *testing.T) {
+	var buf bytes.Buffer
+	bar := NewBar(&buf)
+	bar.Report(Event{Stage: StageBatches, Done: 1, Total: 4})
+	bar.Report(Event{Stage: StageBatches, Done: 4, Total: 4, Finished: true})
+
+	output := buf.String()
+	if !strings.Contains(output, "Fetching calendars") || !strings.Contains(output, "1/4") || !strings.HasSuffix(output, "\n") {
+		t.Fatalf("unexpected bar output %q", output)
+	}
+}
+
+func TestConsoleKeepsLogLinesOffTheBar(t *testing.T) {
+	var buf bytes.Buffer
+	console := NewConsole(&buf)
+	bar := NewBar(console)
+	bar.Report(Event{Stage: StageBatches, Done: 1, Total: 4})
+	console.Write([]byte("WRN quota exceeded\n"))
+	bar.Report(Event{Stage: StageBatches, Done: 4, Total: 4, Finished: true})
+	console.Write([]byte("INF done\n"))
+
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 4 || lines[3] != "" {
+		t.Fatalf("unexpected console output %q", buf.String())
+	}
+	// The log line starts on a cleared line, then the bar is redrawn below it
+	if !strings.HasSuffix(lines[0], "1/4\r\033[KWRN quota exceeded") {
+		t.Fatalf("log line was not written on a cleared line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "1/4") || !strings.Contains(lines[1], "4/4") {
+		t.Fatalf("bar was not redrawn after the log line: %q", lines[1])
+	}
+	if lines[2] != "INF done" {
+		t.Fatalf("log line after a finished bar should be written as is: %q", lines[2])
+	}
+}
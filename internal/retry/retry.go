@@ -0,0 +1,320 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/googleapi"
+)
+
+// Policy configures exponential backoff for Google API calls
+type Policy struct {
+	MaxAttempts    int           // Maximum number of attempts including the first call
+	InitialBackoff time.Duration // Backoff before the first retry
+	MaxBackoff     time.Duration // Upper bound for a single backoff
+	Multiplier     float64       // Growth factor applied after each retry
+	MaxElapsed     time.Duration // Total time budget across all attempts
+}
+
+// DefaultPolicy returns the backoff policy recommended for Calendar and Directory API quotas
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    6,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     16 * time.Second,
+		Multiplier:     2,
+		MaxElapsed:     60 * time.Second,
+	}
+}
+
+// OperationStats summarizes retries for a single kind of API call
+type OperationStats struct {
+	Calls     int `json:"calls"`
+	Retries   int `json:"retries"`
+	Recovered int `json:"recovered"` // Calls that succeeded after at least one retry
+	Failures  int `json:"failures"`  // Calls that still failed after retrying
+}
+
+// Stats aggregates retry counts per operation. It is safe for concurrent use.
+type Stats struct {
+	mutex      sync.Mutex
+	operations map[string]*OperationStats
+}
+
+// NewStats creates an empty retry statistics collector
+func NewStats() *Stats {
+	return &Stats{operations: make(map[string]*OperationStats)}
+}
+
+func (s *Stats) record(operation string, attempts int, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	op, ok := s.operations[operation]
+	if !ok {
+		op = &OperationStats{}
+		s.operations[operation] = op
+	}
+	op.Calls++
+	op.Retries += attempts - 1
+	if err != nil {
+		if attempts > 1 {
+			op.Failures++
+		}
+	} else if attempts > 1 {
+		op.Recovered++
+	}
+}
+
+// Snapshot returns a copy of the per-operation statistics
+func (s *Stats) Snapshot() map[string]OperationStats {
+	result := make(map[string]OperationStats)
+	if s == nil {
+		return result
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for name, op := range s.operations {
+		result[name] = *op
+	}
+	return result
+}
+
+// TotalRetries returns the number of retries across all operations
+func (s *Stats) TotalRetries() int {
+	total := 0
+	for _, op := range s.Snapshot() {
+		total += op.Retries
+	}
+	return total
+}
+
+// Operations returns the recorded operation names in sorted order
+func (s *Stats) Operations() []string {
+	snapshot := s.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Retrier executes API calls according to a policy and records their retry counts
+type Retrier struct {
+	Policy Policy
+	Stats  *Stats
+}
+
+// New creates a retrier with the given policy and statistics collector (which may be nil)
+func New(policy Policy, stats *Stats) *Retrier {
+	return &Retrier{Policy: policy, Stats: stats}
+}
+
+// Default creates a retrier using DefaultPolicy without collecting statistics
+func Default() *Retrier {
+	return New(DefaultPolicy(), nil)
+}
+
+// Do runs fn until it succeeds, returns a non-retryable error, or the policy budget is exhausted.
+// The operation name identifies the call in logs and statistics.
+func (r *Retrier) Do(ctx context.Context, operation string, fn func() error) error {
+	_, err := r.DoCounted(ctx, operation, fn)
+	return err
+}
+
+// DoCounted behaves like Do and also returns the number of attempts made
+func (r *Retrier) DoCounted(ctx context.Context, operation string, fn func() error) (int, error) {
+	if r == nil {
+		return 1, fn()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	policy := r.Policy
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+
+	started := time.Now()
+	attempt := 0
+	var err error
+
+	for {
+		attempt++
+		err = fn()
+		if err == nil || !IsRetryable(err) || attempt >= policy.MaxAttempts {
+			break
+		}
+
+		wait := policy.backoff(attempt)
+		if retryAfter, ok := RetryAfter(err); ok {
+			wait = retryAfter
+		}
+
+		if policy.MaxElapsed > 0 && time.Since(started)+wait > policy.MaxElapsed {
+			log.Debug().
+				Str("operation", operation).
+				Int("attempt", attempt).
+				Dur("wait", wait).
+				Msg("Retry budget exhausted")
+			break
+		}
+
+		log.Debug().
+			Err(err).
+			Str("operation", operation).
+			Int("attempt", attempt).
+			Dur("wait", wait).
+			Msg("Retrying API call")
+
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			err = errors.Join(err, sleepErr)
+			break
+		}
+	}
+
+	r.Stats.record(operation, attempt, err)
+
+	if attempt > 1 {
+		event := log.Debug().
+			Str("operation", operation).
+			Int("attempts", attempt).
+			Int("retries", attempt-1)
+		if err != nil {
+			event.Err(err).Msg("API call failed after retries")
+		} else {
+			event.Msg("API call succeeded after retries")
+		}
+	}
+
+	if err != nil && attempt > 1 {
+		return attempt, fmt.Errorf("%w (after %d attempts)", err, attempt)
+	}
+	return attempt, err
+}
+
+// backoff returns the jittered delay before the given retry (1-based)
+func (p Policy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			backoff = float64(p.MaxBackoff)
+			break
+		}
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	// Equal jitter: keep half the backoff and randomize the other half
+	half := backoff / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// IsRetryable reports whether an API error is transient and worth retrying
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.Code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		return IsQuotaError(err)
+	}
+
+	return false
+}
+
+// IsQuotaError reports whether err is a 403 quota or rate limit error rather than a refusal
+func IsQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter extracts the server-requested delay from a Retry-After header, if present
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0, false
+	}
+
+	value := apiErr.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, convErr := strconv.Atoi(value); convErr == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if when, parseErr := http.ParseTime(value); parseErr == nil {
+		wait := time.Until(when)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func fastPolicy() Policy {
+	return Policy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+		MaxElapsed:     time.Second,
+	}
+}
+
+func TestDoRetriesTransientErrors(t *testing.T) {
+	stats := NewStats()
+	retrier := New(fastPolicy(), stats)
+
+	calls := 0
+	err := retrier.Do(context.Background(), "calendar.freebusy", func() error {
+		calls++
+		if calls < 3 {
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+
+	op := stats.Snapshot()["calendar.freebusy"]
+	if op.Calls != 1 || op.Retries != 2 || op.Recovered != 1 || op.Failures != 0 {
+		t.Fatalf("unexpected stats: %+v", op)
+	}
+}
+
+func TestDoStopsOnPermanentErrors(t *testing.T) {
+	stats := NewStats()
+	retrier := New(fastPolicy(), stats)
+
+	calls := 0
+	notFound := &googleapi.Error{Code: http.StatusNotFound}
+	err := retrier.Do(context.Background(), "directory.members_list", func() error {
+		calls++
+		return notFound
+	})
+	if !errors.Is(err, notFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call, got %d", calls)
+	}
+	if stats.TotalRetries() != 0 {
+		t.Fatalf("expected no retries, got %d", stats.TotalRetries())
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	stats := NewStats()
+	retrier := New(fastPolicy(), stats)
+
+	calls := 0
+	err := retrier.Do(context.Background(), "calendar.freebusy", func() error {
+		calls++
+		return &googleapi.Error{Code: http.StatusTooManyRequests}
+	})
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected wrapped 429 error, got %v", err)
+	}
+	if calls != 4 {
+		t.Fatalf("expected 4 attempts, got %d", calls)
+	}
+	if op := stats.Snapshot()["calendar.freebusy"]; op.Failures != 1 || op.Retries != 3 {
+		t.Fatalf("unexpected stats: %+v", op)
+	}
+}
+
+func TestIsRetryableRecognizesQuotaReasons(t *testing.T) {
+	quota := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}},
+	}
+	if !IsRetryable(quota) {
+		t.Fatalf("expected 403 rate limit error to be retryable")
+	}
+
+	forbidden := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "forbidden"}},
+	}
+	if IsRetryable(forbidden) {
+		t.Fatalf("expected plain 403 to be permanent")
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	err := &googleapi.Error{
+		Code:   http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": []string{"7"}},
+	}
+
+	wait, ok := RetryAfter(err)
+	if !ok || wait != 7*time.Second {
+		t.Fatalf("expected 7s Retry-After, got %v (ok=%v)", wait, ok)
+	}
+
+	// A Retry-After longer than the elapsed budget stops retrying immediately
+	retrier := New(Policy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxElapsed: time.Second}, nil)
+	calls := 0
+	_ = retrier.Do(context.Background(), "calendar.freebusy", func() error {
+		calls++
+		return err
+	})
+	if calls != 1 {
+		t.Fatalf("expected Retry-After beyond budget to stop after 1 call, got %d", calls)
+	}
+}
@@ -0,0 +1,303 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+)
+
+// Version is the snapshot format version written by Save
+const Version = 1
+
+// Snapshot captures everything the optimizer needs to reproduce a recommendation offline
+type Snapshot struct {
+	Version        int            `json:"version"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Attendees      []string       `json:"attendees"`
+	Parameters     Parameters     `json:"parameters"`
+	Availabilities []Availability `json:"availabilities"`
+	FetchReport    *FetchReport   `json:"fetch_report,omitempty"`
+}
+
+// Parameters are the search parameters in effect when the snapshot was taken
+type Parameters struct {
+	Start           string  `json:"start"` // YYYY-MM-DD
+	End             string  `json:"end"`   // YYYY-MM-DD
+	Timezone        string  `json:"timezone"`
+	Duration        int     `json:"duration_minutes"`
+	StartHour       int     `json:"start_hour"`
+	EndHour         int     `json:"end_hour"`
+	LunchStartHour  int     `json:"lunch_start_hour"`
+	LunchEndHour    int     `json:"lunch_end_hour"`
+	ExcludeWeekends bool    `json:"exclude_weekends"`
+	MaxSlots        int     `json:"max_slots"`
+	MaxConflicts    float64 `json:"max_conflicts"`
+}
+
+// Availability is the serialized form of calendar.UserAvailability
+type Availability struct {
+	Email     string          `json:"email"`
+	Status    string          `json:"status"`
+	TimeZone  string          `json:"timezone,omitempty"`
+	BusySlots []Slot          `json:"busy_slots"`
+	Holidays  []Holiday       `json:"holidays,omitempty"`
+	Errors    []CalendarError `json:"errors,omitempty"`
+}
+
+// Slot is a serialized time range
+type Slot struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Calendar string    `json:"calendar,omitempty"`
+}
+
+// Holiday is a serialized bank holiday window
+type Holiday struct {
+	Name   string    `json:"name"`
+	Region string    `json:"region"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// CalendarError is a serialized per-calendar FreeBusy error
+type CalendarError struct {
+	Domain string `json:"domain,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// FetchReport is the serialized form of calendar.FetchReport
+type FetchReport struct {
+	Requested   int          `json:"requested"`
+	Retrieved   int          `json:"retrieved"`
+	Cached      int          `json:"cached"`
+	Retries     int          `json:"retries"`
+	Recovered   int          `json:"recovered"`
+	DurationMs  int64        `json:"duration_ms"`
+	Batches     []Batch      `json:"batches"`
+	EmailErrors []EmailError `json:"email_errors"`
+}
+
+// Batch is a serialized FreeBusy batch outcome
+type Batch struct {
+	Number     int      `json:"number"`
+	Emails     []string `json:"emails"`
+	Retrieved  int      `json:"retrieved"`
+	Attempts   int      `json:"attempts"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+	Category   string   `json:"category,omitempty"`
+}
+
+// EmailError is a serialized per-attendee fetch error
+type EmailError struct {
+	Email    string `json:"email"`
+	Category string `json:"category"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// New builds a snapshot from resolved attendees, fetched availabilities and search parameters
+func New(attendees []string, params Parameters, availabilities []calendar.UserAvailability, report *calendar.FetchReport) *Snapshot {
+	snap := &Snapshot{
+		Version:        Version,
+		CreatedAt:      time.Now().UTC(),
+		Attendees:      attendees,
+		Parameters:     params,
+		Availabilities: make([]Availability, 0, len(availabilities)),
+	}
+
+	for _, avail := range availabilities {
+		entry := Availability{
+			Email:     avail.Email,
+			Status:    string(avail.Status),
+			BusySlots: make([]Slot, 0, len(avail.BusySlots)),
+		}
+		if avail.TimeZone != nil {
+			entry.TimeZone = avail.TimeZone.String()
+		}
+		for _, slot := range avail.BusySlots {
+			entry.BusySlots = append(entry.BusySlots, Slot{Start: slot.Start, End: slot.End, Calendar: slot.Calendar})
+		}
+		for _, holiday := range avail.Holidays {
+			entry.Holidays = append(entry.Holidays, Holiday{
+				Name:   holiday.Name,
+				Region: holiday.Region,
+				Start:  holiday.TimeSlot.Start,
+				End:    holiday.TimeSlot.End,
+			})
+		}
+		for _, calErr := range avail.Errors {
+			entry.Errors = append(entry.Errors, CalendarError{Domain: calErr.Domain, Reason: calErr.Reason})
+		}
+		snap.Availabilities = append(snap.Availabilities, entry)
+	}
+
+	if report != nil {
+		snap.FetchReport = &FetchReport{
+			Requested:   report.Requested,
+			Retrieved:   report.Retrieved,
+			Cached:      report.Cached,
+			Retries:     report.Retries,
+			Recovered:   report.Recovered,
+			DurationMs:  report.Duration.Milliseconds(),
+			Batches:     make([]Batch, 0, len(report.Batches)),
+			EmailErrors: make([]EmailError, 0, len(report.EmailErrors)),
+		}
+		for _, batch := range report.Batches {
+			entry := Batch{
+				Number:     batch.Number,
+				Emails:     batch.Emails,
+				Retrieved:  batch.Retrieved,
+				Attempts:   batch.Attempts,
+				DurationMs: batch.Duration.Milliseconds(),
+				Category:   batch.Category,
+			}
+			if batch.Err != nil {
+				entry.Error = batch.Err.Error()
+			}
+			snap.FetchReport.Batches = append(snap.FetchReport.Batches, entry)
+		}
+		for _, emailErr := range report.EmailErrors {
+			snap.FetchReport.EmailErrors = append(snap.FetchReport.EmailErrors, EmailError{
+				Email:    emailErr.Email,
+				Category: emailErr.Category,
+				Detail:   emailErr.Detail,
+			})
+		}
+	}
+
+	return snap
+}
+
+// Save writes the snapshot as indented JSON
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("unable to write snapshot %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write snapshot %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write snapshot %s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a snapshot written by Save
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot %s: %w", path, err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot %s: %w", path, err)
+	}
+	if snap.Version != Version {
+		return nil, fmt.Errorf("unsupported snapshot version %d (expected %d)", snap.Version, Version)
+	}
+	if len(snap.Attendees) == 0 {
+		return nil, errors.New("snapshot has no attendees")
+	}
+	if snap.Parameters.Start == "" || snap.Parameters.End == "" {
+		return nil, errors.New("snapshot has no search range")
+	}
+
+	return &snap, nil
+}
+
+// UserAvailabilities converts the snapshot back into calendar availabilities
+func (s *Snapshot) UserAvailabilities() ([]calendar.UserAvailability, error) {
+	availabilities := make([]calendar.UserAvailability, 0, len(s.Availabilities))
+	for _, entry := range s.Availabilities {
+		avail := calendar.UserAvailability{
+			Email:     entry.Email,
+			Status:    calendar.AvailabilityStatus(entry.Status),
+			BusySlots: make([]calendar.TimeSlot, 0, len(entry.BusySlots)),
+		}
+		if avail.Status == "" {
+			avail.Status = calendar.AvailabilityKnown
+		}
+		if entry.TimeZone != "" {
+			loc, err := time.LoadLocation(entry.TimeZone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone %s for %s: %w", entry.TimeZone, entry.Email, err)
+			}
+			avail.TimeZone = loc
+		}
+		for _, slot := range entry.BusySlots {
+			avail.BusySlots = append(avail.BusySlots, calendar.TimeSlot{Start: slot.Start, End: slot.End, Calendar: slot.Calendar})
+		}
+		for _, holiday := range entry.Holidays {
+			avail.Holidays = append(avail.Holidays, calendar.Holiday{
+				Name:     holiday.Name,
+				Region:   holiday.Region,
+				TimeSlot: calendar.TimeSlot{Start: holiday.Start, End: holiday.End},
+			})
+		}
+		for _, calErr := range entry.Errors {
+			avail.Errors = append(avail.Errors, calendar.CalendarError{Domain: calErr.Domain, Reason: calErr.Reason})
+		}
+		availabilities = append(availabilities, avail)
+	}
+	return availabilities, nil
+}
+
+// Report converts the saved fetch report back into a calendar.FetchReport.
+// Snapshots without one get a minimal report derived from their availabilities.
+func (s *Snapshot) Report() *calendar.FetchReport {
+	if s.FetchReport == nil {
+		report := &calendar.FetchReport{Requested: len(s.Attendees)}
+		for _, entry := range s.Availabilities {
+			if calendar.AvailabilityStatus(entry.Status) != calendar.AvailabilityUnknown {
+				report.Retrieved++
+			}
+		}
+		return report
+	}
+
+	report := &calendar.FetchReport{
+		Requested: s.FetchReport.Requested,
+		Retrieved: s.FetchReport.Retrieved,
+		Cached:    s.FetchReport.Cached,
+		Retries:   s.FetchReport.Retries,
+		Recovered: s.FetchReport.Recovered,
+		Duration:  time.Duration(s.FetchReport.DurationMs) * time.Millisecond,
+	}
+	for _, batch := range s.FetchReport.Batches {
+		entry := calendar.BatchReport{
+			Number:    batch.Number,
+			Emails:    batch.Emails,
+			Retrieved: batch.Retrieved,
+			Attempts:  batch.Attempts,
+			Duration:  time.Duration(batch.DurationMs) * time.Millisecond,
+			Category:  batch.Category,
+		}
+		if batch.Error != "" {
+			entry.Err = errors.New(batch.Error)
+		}
+		report.Batches = append(report.Batches, entry)
+	}
+	for _, emailErr := range s.FetchReport.EmailErrors {
+		report.EmailErrors = append(report.EmailErrors, calendar.EmailFetchError{
+			Email:    emailErr.Email,
+			Category: emailErr.Category,
+			Detail:   emailErr.Detail,
+		})
+	}
+	return report
+}
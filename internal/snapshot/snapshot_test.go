@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	availabilities := []calendar.UserAvailability{
+		{
+			Email:     "alice@example.com",
+			Status:    calendar.AvailabilityKnown,
+			TimeZone:  paris,
+			BusySlots: []calendar.TimeSlot{{Start: start, End: start.Add(time.Hour)}},
+			Holidays: []calendar.Holiday{{
+				Name:     "Bastille Day",
+				Region:   "FR",
+				TimeSlot: calendar.TimeSlot{Start: start, End: start.Add(24 * time.Hour)},
+			}},
+		},
+		{
+			Email:     "missing@example.com",
+			Status:    calendar.AvailabilityUnknown,
+			BusySlots: []calendar.TimeSlot{},
+			Errors:    []calendar.CalendarError{{Domain: "global", Reason: "notFound"}},
+		},
+	}
+	report := &calendar.FetchReport{
+		Requested: 3,
+		Retrieved: 1,
+		Batches:   []calendar.BatchReport{{Number: 1, Emails: []string{"bob@example.com"}, Err: errors.New("boom"), Category: "server_error"}},
+		EmailErrors: []calendar.EmailFetchError{
+			{Email: "missing@example.com", Category: calendar.FetchErrorCalendarError, Detail: "notFound"},
+			{Email: "bob@example.com", Category: "server_error", Detail: "boom"},
+		},
+	}
+	params := Parameters{Start: "2024-01-15", End: "2024-01-19", Timezone: "Europe/Paris", Duration: 30, StartHour: 9, EndHour: 17}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := New([]string{"alice@example.com", "missing@example.com", "bob@example.com"}, params, availabilities, report).Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.Parameters != params || len(loaded.Attendees) != 3 {
+		t.Fatalf("unexpected parameters or attendees: %+v %v", loaded.Parameters, loaded.Attendees)
+	}
+
+	restored, err := loaded.UserAvailabilities()
+	if err != nil {
+		t.Fatalf("restore availabilities: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("expected 2 availabilities, got %d", len(restored))
+	}
+
+	alice := restored[0]
+	if alice.TimeZone == nil || alice.TimeZone.String() != "Europe/Paris" {
+		t.Fatalf("expected Europe/Paris, got %v", alice.TimeZone)
+	}
+	if len(alice.BusySlots) != 1 || !alice.BusySlots[0].Start.Equal(start) {
+		t.Fatalf("unexpected busy slots: %+v", alice.BusySlots)
+	}
+	if len(alice.Holidays) != 1 || alice.Holidays[0].Name != "Bastille Day" {
+		t.Fatalf("unexpected holidays: %+v", alice.Holidays)
+	}
+
+	missing := restored[1]
+	if !missing.IsUnknown() || missing.TimeZone != nil || missing.ErrorReasons()[0] != "notFound" {
+		t.Fatalf("unexpected unknown attendee: %+v", missing)
+	}
+
+	restoredReport := loaded.Report()
+	if restoredReport.Complete() || len(restoredReport.FailedBatches()) != 1 || restoredReport.FailedBatches()[0].Err.Error() != "boom" {
+		t.Fatalf("unexpected report: %+v", restoredReport)
+	}
+}
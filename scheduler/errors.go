@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/retry"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Exit codes for command-line callers. They are part of the documented CLI interface,
+// so scripts can tell the outcomes apart; don't renumber existing values.
+const (
+	ExitOK           = 0   // At least one suitable slot was found
+	ExitFailure      = 1   // Unexpected error (I/O, marshalling, API failures not covered below)
+	ExitInvalidInput = 2   // Bad flags, dates, timezone, snapshot or attendee list
+	ExitAuthFailure  = 3   // Credentials could not be loaded or Google rejected them
+	ExitNoCalendars  = 4   // No calendar data could be retrieved for any attendee
+	ExitNoSlots      = 5   // Calendars were read but no slot matched the constraints
+	ExitPartialData  = 6   // Strict mode and availability is missing for some attendees
+	ExitTimeout      = 124 // The run's deadline elapsed before it finished
+	ExitInterrupted  = 130 // The run was canceled (Ctrl-C or SIGTERM)
+)
+
+// ErrorKind classifies a failed search
+type ErrorKind string
+
+// Error kinds, reported as error.code in JSON output
+const (
+	KindFailure      ErrorKind = "failure"
+	KindInvalidInput ErrorKind = "invalid_input"
+	KindAuthFailure  ErrorKind = "auth_failure"
+	KindNoCalendars  ErrorKind = "no_calendars"
+	KindNoSlots      ErrorKind = "no_slots"
+	KindPartialData  ErrorKind = "partial_data"
+	KindTimeout      ErrorKind = "timeout"
+	KindInterrupted  ErrorKind = "interrupted"
+)
+
+var exitCodes = map[ErrorKind]int{
+	KindFailure:      ExitFailure,
+	KindInvalidInput: ExitInvalidInput,
+	KindAuthFailure:  ExitAuthFailure,
+	KindNoCalendars:  ExitNoCalendars,
+	KindNoSlots:      ExitNoSlots,
+	KindPartialData:  ExitPartialData,
+	KindTimeout:      ExitTimeout,
+	KindInterrupted:  ExitInterrupted,
+}
+
+// Error is a classified search failure
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Err     error
+	Details map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code for the error kind
+func (e *Error) ExitCode() int {
+	if code, ok := exitCodes[e.Kind]; ok {
+		return code
+	}
+	return ExitFailure
+}
+
+// WithDetail attaches a machine-readable detail to the error
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// NewError creates a classified error with a formatted message
+func NewError(kind ErrorKind, err error, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// AsError returns err as a classified error; unclassified errors become KindFailure
+func AsError(err error) *Error {
+	var schedErr *Error
+	if errors.As(err, &schedErr) {
+		return schedErr
+	}
+	return NewError(KindFailure, err, "unexpected error")
+}
+
+// IsKind reports whether err is a classified error of the given kind
+func IsKind(err error, kind ErrorKind) bool {
+	var schedErr *Error
+	return errors.As(err, &schedErr) && schedErr.Kind == kind
+}
+
+// ExitCode returns the process exit code for err (ExitOK for nil)
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	return AsError(err).ExitCode()
+}
+
+// InterruptionError returns a classified error when ctx was canceled or ran past its deadline
+func InterruptionError(ctx context.Context, stage string) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return NewError(KindTimeout, ctx.Err(), "timed out during %s", stage).WithDetail("stage", stage)
+	default:
+		return NewError(KindInterrupted, ctx.Err(), "interrupted during %s", stage).WithDetail("stage", stage)
+	}
+}
+
+// IsAuthError reports whether err means Google rejected our credentials. A 403 caused by
+// exhausted quota is not an auth failure, even once retries have run out.
+func IsAuthError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized:
+			return true
+		case http.StatusForbidden:
+			return !retry.IsQuotaError(err)
+		}
+	}
+	return false
+}
@@ -0,0 +1,475 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/optimizer"
+)
+
+// JSONOutput represents the complete output in JSON format
+type JSONOutput struct {
+	Metadata         OutputMetadata      `json:"metadata"`
+	Summary          Summary             `json:"summary"`
+	TimezoneInfo     TimezoneInfo        `json:"timezone_info"`
+	BestOptions      BestOptions         `json:"best_options"`
+	DailySummary     []DailySummary      `json:"daily_summary"`
+	DetailedSlots    []DetailedTimeSlot  `json:"detailed_slots"`
+	Recommendation   *RecommendationSlot `json:"recommendation"`
+	Error            *ErrorOutput        `json:"error,omitempty"`
+	UnknownAttendees []UnknownAttendee   `json:"unknown_attendees"`
+	DataQuality      DataQuality         `json:"data_quality"`
+}
+
+// DataQuality describes how complete the fetched availability data is
+type DataQuality struct {
+	Complete           bool            `json:"complete"`
+	RequestedAttendees int             `json:"requested_attendees"`
+	RetrievedCalendars int             `json:"retrieved_calendars"`
+	FailedBatches      []FailedBatch   `json:"failed_batches"`
+	AttendeeErrors     []AttendeeError `json:"attendee_errors"`
+	Retries            int             `json:"retries"`
+	Recovered          int             `json:"recovered"`
+	CachedCalendars    int             `json:"cached_calendars"`
+	FetchDurationMs    int64           `json:"fetch_duration_ms"`
+}
+
+// FailedBatch describes a FreeBusy batch that could not be retrieved
+type FailedBatch struct {
+	Batch      int    `json:"batch"`
+	Size       int    `json:"size"`
+	Attempts   int    `json:"attempts"`
+	Category   string `json:"category"`
+	Error      string `json:"error"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// AttendeeError explains why an attendee has no usable availability data
+type AttendeeError struct {
+	Email    string `json:"email"`
+	Category string `json:"category"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// UnknownAttendee describes an attendee whose calendar could not be read
+type UnknownAttendee struct {
+	Email   string   `json:"email"`
+	Reasons []string `json:"reasons"`
+}
+
+// OutputMetadata contains metadata about the search
+type OutputMetadata struct {
+	SearchStartDate     string              `json:"search_start_date"`
+	SearchEndDate       string              `json:"search_end_date"`
+	MeetingDuration     int                 `json:"meeting_duration_minutes"`
+	TotalAttendees      int                 `json:"total_attendees"`
+	ExcludedAttendees   int                 `json:"excluded_attendees"`
+	Exclusions          []ExclusionOutput   `json:"exclusions"`
+	Aliases             map[string][]string `json:"aliases"`
+	AccessibleCalendars int                 `json:"accessible_calendars"`
+	UnknownCalendars    int                 `json:"unknown_calendars"`
+	WorkingHours        string              `json:"working_hours"`
+	LunchHours          string              `json:"lunch_hours"`
+	ExcludeWeekends     bool                `json:"exclude_weekends"`
+	MaxConflicts        float64             `json:"max_conflicts_percentage"`
+	Timezone            string              `json:"timezone"`
+	APIRetries          RetrySummary        `json:"api_retries"`
+}
+
+// ExclusionOutput describes an excluded person or mailing list and the attendees it removed
+type ExclusionOutput struct {
+	Entry   string   `json:"entry"`
+	IsGroup bool     `json:"is_group"`
+	Removed []string `json:"removed"`
+}
+
+// RetrySummary reports how many Google API calls had to be retried
+type RetrySummary struct {
+	TotalRetries int                       `json:"total_retries"`
+	Operations   map[string]OperationStats `json:"operations"`
+}
+
+// Summary contains high-level statistics
+type Summary struct {
+	TotalSlotsFound     int `json:"total_slots_found"`
+	PerfectSlots        int `json:"perfect_slots"`
+	LowConflictSlots    int `json:"low_conflict_slots"`
+	MediumConflictSlots int `json:"medium_conflict_slots"`
+}
+
+// TimezoneInfo contains timezone information for attendees
+type TimezoneInfo struct {
+	AttendeesByTimezone map[string][]string `json:"attendees_by_timezone"`
+	WorkingHoursNote    string              `json:"working_hours_note"`
+}
+
+// BestOptions contains categorized best meeting options
+type BestOptions struct {
+	PerfectSlots []TimeSlotSummary `json:"perfect_slots"`
+	GoodOptions  []TimeSlotSummary `json:"good_options"`
+}
+
+// TimeSlotSummary is a simplified view of a time slot
+type TimeSlotSummary struct {
+	StartTime          string  `json:"start_time"`
+	EndTime            string  `json:"end_time"`
+	ConflictPercentage float64 `json:"conflict_percentage"`
+	ConflictCount      int     `json:"conflict_count"`
+}
+
+// DailySummary contains summary statistics for a day
+type DailySummary struct {
+	Date             string  `json:"date"`
+	TotalSlots       int     `json:"total_slots"`
+	PerfectSlots     int     `json:"perfect_slots"`
+	BestConflict     float64 `json:"best_conflict_percentage"`
+	AverageConflict  float64 `json:"average_conflict_percentage"`
+	EarliestSlotTime string  `json:"earliest_slot_time"`
+	LatestSlotTime   string  `json:"latest_slot_time"`
+}
+
+// DetailedTimeSlot contains detailed information about a time slot
+type DetailedTimeSlot struct {
+	StartTime          string              `json:"start_time"`
+	EndTime            string              `json:"end_time"`
+	ConflictPercentage float64             `json:"conflict_percentage"`
+	UnavailableCount   int                 `json:"unavailable_count"`
+	UnavailableEmails  []string            `json:"unavailable_emails"`
+	AvailableEmails    []string            `json:"available_emails"`
+	TimeZoneScore      float64             `json:"timezone_score"`
+	ConflictsByType    map[string][]string `json:"conflicts_by_type"`
+	HolidayConflicts   map[string]string   `json:"holiday_conflicts,omitempty"`
+	UnknownEmails      []string            `json:"unknown_emails,omitempty"`
+	ConflictCalendars  map[string][]string `json:"conflict_calendars,omitempty"`
+}
+
+// RecommendationSlot contains the recommended meeting slot
+type RecommendationSlot struct {
+	StartTime             string  `json:"start_time"`
+	EndTime               string  `json:"end_time"`
+	ConflictPercentage    float64 `json:"conflict_percentage"`
+	UnavailableCount      int     `json:"unavailable_count"`
+	CalendarConflicts     int     `json:"calendar_conflicts"`
+	WorkingHoursConflicts int     `json:"working_hours_conflicts"`
+	HolidayConflicts      int     `json:"holiday_conflicts"`
+	Reason                string  `json:"reason"`
+}
+
+// ErrorOutput is the machine-readable error object in JSON output
+type ErrorOutput struct {
+	Code     ErrorKind              `json:"code"`
+	ExitCode int                    `json:"exit_code"`
+	Message  string                 `json:"message"`
+	Cause    string                 `json:"cause,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewErrorOutput converts an error into its JSON representation
+func NewErrorOutput(err error) *ErrorOutput {
+	schedErr := AsError(err)
+	output := &ErrorOutput{
+		Code:     schedErr.Kind,
+		ExitCode: schedErr.ExitCode(),
+		Message:  schedErr.Message,
+		Details:  schedErr.Details,
+	}
+	if schedErr.Err != nil {
+		output.Cause = schedErr.Err.Error()
+	}
+	return output
+}
+
+// JSONRenderer writes results as indented JSON
+type JSONRenderer struct{}
+
+// Render writes the full JSON output for a successful search
+func (JSONRenderer) Render(w io.Writer, result *Result) error {
+	return writeJSON(w, NewJSONOutput(result))
+}
+
+// RenderError writes a JSON error object. When no slot matched, the error is added
+// to the full output so the metadata and data quality are still available.
+func (JSONRenderer) RenderError(w io.Writer, result *Result, err error) (bool, error) {
+	if result != nil && IsKind(err, KindNoSlots) {
+		output := NewJSONOutput(result)
+		output.Error = NewErrorOutput(err)
+		return true, writeJSON(w, output)
+	}
+
+	return true, writeJSON(w, struct {
+		Error *ErrorOutput `json:"error"`
+	}{NewErrorOutput(err)})
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON output: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// NewJSONOutput converts a search result into its JSON representation
+func NewJSONOutput(result *Result) JSONOutput {
+	unknownAvailabilities := result.Unknown()
+	req := result.Request
+	availabilities := result.Availabilities
+	filteredSlots := result.Slots
+
+	output := JSONOutput{
+		Metadata: OutputMetadata{
+			SearchStartDate:     req.Start.Format("2006-01-02"),
+			SearchEndDate:       req.End.Format("2006-01-02"),
+			MeetingDuration:     int(req.Duration.Minutes()),
+			TotalAttendees:      len(result.Attendees),
+			ExcludedAttendees:   result.ExcludedAttendees(),
+			Exclusions:          newExclusions(result.Exclusions),
+			Aliases:             newAliases(result.Aliases),
+			AccessibleCalendars: len(availabilities) - len(unknownAvailabilities),
+			UnknownCalendars:    len(unknownAvailabilities),
+			WorkingHours:        fmt.Sprintf("%d:00 - %d:00", req.WorkingHours.StartHour, req.WorkingHours.EndHour),
+			LunchHours:          fmt.Sprintf("%d:00 - %d:00", req.WorkingHours.LunchStartHour, req.WorkingHours.LunchEndHour),
+			ExcludeWeekends:     req.WorkingHours.ExcludeWeekends,
+			MaxConflicts:        req.MaxConflicts,
+			Timezone:            req.Location.String(),
+			APIRetries:          newRetrySummary(result),
+		},
+		UnknownAttendees: newUnknownAttendees(unknownAvailabilities),
+		DataQuality:      newDataQuality(result.FetchReport),
+	}
+
+	// Prepare timezone info
+	tzMap := make(map[string][]string)
+	for _, avail := range availabilities {
+		if avail.IsUnknown() {
+			continue
+		}
+		tzName := "Unknown"
+		if avail.TimeZone != nil {
+			tzName = avail.TimeZone.String()
+		}
+		tzMap[tzName] = append(tzMap[tzName], avail.Email)
+	}
+
+	output.TimezoneInfo = TimezoneInfo{
+		AttendeesByTimezone: tzMap,
+		WorkingHoursNote: fmt.Sprintf("%d:00 - %d:00 (in each attendee's local time)",
+			req.WorkingHours.StartHour, req.WorkingHours.EndHour),
+	}
+
+	// Group slots by conflict level
+	conflictGroups := optimizer.GroupSlotsByConflictLevel(filteredSlots)
+
+	// Prepare summary
+	output.Summary = Summary{
+		TotalSlotsFound:     len(filteredSlots),
+		PerfectSlots:        len(conflictGroups["no-conflicts"]),
+		LowConflictSlots:    len(conflictGroups["low-conflicts"]),
+		MediumConflictSlots: len(conflictGroups["med-conflicts"]),
+	}
+
+	// Prepare best options
+	output.BestOptions = BestOptions{
+		PerfectSlots: []TimeSlotSummary{},
+		GoodOptions:  []TimeSlotSummary{},
+	}
+
+	// Add perfect slots (up to 5)
+	maxPerfect := 5
+	if len(conflictGroups["no-conflicts"]) < maxPerfect {
+		maxPerfect = len(conflictGroups["no-conflicts"])
+	}
+	for i := 0; i < maxPerfect; i++ {
+		slot := conflictGroups["no-conflicts"][i]
+		output.BestOptions.PerfectSlots = append(output.BestOptions.PerfectSlots, TimeSlotSummary{
+			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
+			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
+			ConflictPercentage: slot.ConflictPercentage,
+			ConflictCount:      slot.UnavailableCount,
+		})
+	}
+
+	// Add good options (up to 5)
+	maxGood := 5
+	if len(conflictGroups["low-conflicts"]) < maxGood {
+		maxGood = len(conflictGroups["low-conflicts"])
+	}
+	for i := 0; i < maxGood; i++ {
+		slot := conflictGroups["low-conflicts"][i]
+		output.BestOptions.GoodOptions = append(output.BestOptions.GoodOptions, TimeSlotSummary{
+			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
+			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
+			ConflictPercentage: slot.ConflictPercentage,
+			ConflictCount:      slot.UnavailableCount,
+		})
+	}
+
+	// Prepare daily summary
+	grouped := optimizer.GroupSlotsByDay(filteredSlots)
+	var days []string
+	for day := range grouped {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		slots := grouped[day]
+		bestConflict, avgConflict, perfectCount, _ := optimizer.GetDaySummaryStats(slots)
+
+		// Find earliest and latest slots
+		earliest := slots[0].TimeSlot.Start
+		latest := slots[0].TimeSlot.End
+		for _, s := range slots {
+			if s.TimeSlot.Start.Before(earliest) {
+				earliest = s.TimeSlot.Start
+			}
+			if s.TimeSlot.End.After(latest) {
+				latest = s.TimeSlot.End
+			}
+		}
+
+		output.DailySummary = append(output.DailySummary, DailySummary{
+			Date:             day,
+			TotalSlots:       len(slots),
+			PerfectSlots:     perfectCount,
+			BestConflict:     bestConflict,
+			AverageConflict:  avgConflict,
+			EarliestSlotTime: earliest.Format("15:04"),
+			LatestSlotTime:   latest.Format("15:04"),
+		})
+	}
+
+	// Prepare detailed slots
+	for _, slot := range filteredSlots {
+		output.DetailedSlots = append(output.DetailedSlots, DetailedTimeSlot{
+			StartTime:          slot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
+			EndTime:            slot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
+			ConflictPercentage: slot.ConflictPercentage,
+			UnavailableCount:   slot.UnavailableCount,
+			UnavailableEmails:  slot.UnavailableEmails,
+			AvailableEmails:    slot.AvailableEmails,
+			TimeZoneScore:      slot.TimeZoneScore,
+			ConflictsByType:    slot.ConflictsByType,
+			HolidayConflicts:   slot.HolidayConflicts,
+			ConflictCalendars:  slot.ConflictCalendars,
+			UnknownEmails:      slot.UnknownEmails,
+		})
+	}
+
+	// Find the best recommendation
+	if len(filteredSlots) > 0 {
+		bestSlot := RecommendedSlot(filteredSlots)
+
+		reason := "Best overall slot with lowest conflicts"
+		if bestSlot.UnavailableCount == 0 {
+			reason = "Perfect slot with all attendees available"
+		} else if bestSlot.ConflictPercentage <= 25 {
+			reason = "Good slot with minimal conflicts"
+		}
+
+		output.Recommendation = &RecommendationSlot{
+			StartTime:             bestSlot.TimeSlot.Start.Format("2006-01-02T15:04:05Z07:00"),
+			EndTime:               bestSlot.TimeSlot.End.Format("2006-01-02T15:04:05Z07:00"),
+			ConflictPercentage:    bestSlot.ConflictPercentage,
+			UnavailableCount:      bestSlot.UnavailableCount,
+			CalendarConflicts:     len(bestSlot.ConflictsByType["calendar"]),
+			WorkingHoursConflicts: len(bestSlot.ConflictsByType["working_hours"]),
+			HolidayConflicts:      len(bestSlot.ConflictsByType["holiday"]),
+			Reason:                reason,
+		}
+	}
+
+	return output
+}
+
+// newRetrySummary converts collected retry statistics into their JSON representation
+func newRetrySummary(result *Result) RetrySummary {
+	operations := result.APIRetries
+	if operations == nil {
+		operations = map[string]OperationStats{}
+	}
+	return RetrySummary{
+		TotalRetries: result.TotalRetries(),
+		Operations:   operations,
+	}
+}
+
+// newExclusions converts the applied exclusions into their JSON representation
+func newExclusions(exclusions []Exclusion) []ExclusionOutput {
+	outputs := make([]ExclusionOutput, 0, len(exclusions))
+	for _, exclusion := range exclusions {
+		removed := exclusion.Removed
+		if removed == nil {
+			removed = []string{}
+		}
+		outputs = append(outputs, ExclusionOutput{
+			Entry:   exclusion.Entry,
+			IsGroup: exclusion.IsGroup,
+			Removed: removed,
+		})
+	}
+	return outputs
+}
+
+// newAliases returns the merged alias addresses, never nil
+func newAliases(aliases map[string][]string) map[string][]string {
+	if aliases == nil {
+		return map[string][]string{}
+	}
+	return aliases
+}
+
+// newUnknownAttendees converts attendees with FreeBusy errors into their JSON representation
+func newUnknownAttendees(availabilities []Availability) []UnknownAttendee {
+	attendees := make([]UnknownAttendee, 0, len(availabilities))
+	for _, avail := range availabilities {
+		attendees = append(attendees, UnknownAttendee{
+			Email:   avail.Email,
+			Reasons: avail.ErrorReasons(),
+		})
+	}
+	return attendees
+}
+
+// newDataQuality converts a fetch report into its JSON representation
+func newDataQuality(report *FetchReport) DataQuality {
+	quality := DataQuality{
+		Complete:       report.Complete(),
+		FailedBatches:  []FailedBatch{},
+		AttendeeErrors: []AttendeeError{},
+	}
+	if report == nil {
+		return quality
+	}
+
+	quality.RequestedAttendees = report.Requested
+	quality.RetrievedCalendars = report.Retrieved
+	quality.Retries = report.Retries
+	quality.Recovered = report.Recovered
+	quality.CachedCalendars = report.Cached
+	quality.FetchDurationMs = report.Duration.Milliseconds()
+
+	for _, batch := range report.FailedBatches() {
+		quality.FailedBatches = append(quality.FailedBatches, FailedBatch{
+			Batch:      batch.Number,
+			Size:       len(batch.Emails),
+			Attempts:   batch.Attempts,
+			Category:   batch.Category,
+			Error:      batch.Err.Error(),
+			DurationMs: batch.Duration.Milliseconds(),
+		})
+	}
+
+	for _, emailErr := range report.EmailErrors {
+		quality.AttendeeErrors = append(quality.AttendeeErrors, AttendeeError{
+			Email:    emailErr.Email,
+			Category: emailErr.Category,
+			Detail:   emailErr.Detail,
+		})
+	}
+
+	return quality
+}
@@ -0,0 +1,304 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/holidays"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/snapshot"
+	"github.com/rs/zerolog/log"
+	admin "google.golang.org/api/admin/directory/v1"
+	googlecalendar "google.golang.org/api/calendar/v3"
+)
+
+// DirectoryResolver expands mailing lists and resolves aliases with the Google Admin Directory API
+type DirectoryResolver struct {
+	Service *admin.Service // May be nil when Options.Cache is offline
+	Options ResolveOptions
+}
+
+// ResolveGroups expands groups (including nested groups) into member emails.
+// Resolution is best effort: unresolved groups are kept as individual emails and
+// described in the summary rather than reported as an error.
+func (d *DirectoryResolver) ResolveGroups(ctx context.Context, groups []string) ([]string, *ResolutionSummary, error) {
+	// Check if we have proper access (not needed when serving from the cache only)
+	if d.Service != nil && !d.Options.Cache.Offline() {
+		if err := directory.CheckGroupAccess(ctx, d.Service, groups, d.Options.Retrier); err != nil {
+			log.Warn().Err(err).Msg("Group access check failed; attempting best-effort resolution anyway")
+		}
+	}
+
+	// Resolve mailing list members with detailed information
+	log.Info().Msg("Resolving mailing lists...")
+	members, summary := directory.ResolveMemberEmailsDetailedWithOptions(ctx, d.Service, groups, d.Options)
+	logResolutionSummary(groups, members, summary)
+
+	return members, summary, nil
+}
+
+// PrimaryEmails looks up the primary address of each email with Directory Users.Get,
+// reusing the member list cache for the results
+func (d *DirectoryResolver) PrimaryEmails(ctx context.Context, emails []string) (map[string]string, error) {
+	return directory.PrimaryEmails(ctx, d.Service, emails, d.Options)
+}
+
+// logResolutionSummary reports how mailing list resolution went
+func logResolutionSummary(groups, members []string, summary *ResolutionSummary) {
+	// Provide overall debug summary
+	log.Debug().
+		Int("requested_groups", len(groups)).
+		Int("groups_processed", len(summary.Results)).
+		Int("groups_resolved", summary.ResolvedGroups).
+		Int("groups_unresolved", summary.UnresolvedGroups).
+		Int("individual_fallbacks", summary.IndividualEmails).
+		Int("cached_lists", summary.CachedLists).
+		Int("excluded_members", summary.ExcludedMembers).
+		Int("unique_members", len(members)).
+		Msg("Mailing list resolution summary")
+
+	// Report on resolution results
+	if summary.ResolvedGroups > 0 {
+		log.Info().
+			Int("resolved_groups", summary.ResolvedGroups).
+			Int("total_members", len(members)).
+			Int("max_nesting_depth", summary.MaxDepthReached).
+			Int("nested_groups_total", summary.NestedGroupsTotal).
+			Msg("Successfully resolved mailing lists")
+	} else {
+		log.Debug().
+			Int("groups_processed", len(summary.Results)).
+			Int("unique_members", len(members)).
+			Msg("Mailing list resolution produced no group expansions")
+	}
+
+	// Report on nested group complexity
+	if summary.NestedGroupsTotal > 0 {
+		log.Info().
+			Int("nested_groups", summary.NestedGroupsTotal).
+			Int("max_depth", summary.MaxDepthReached).
+			Msg("Found nested mailing lists")
+	}
+
+	// Report members left out by the member filters
+	if summary.ExcludedMembers > 0 {
+		log.Info().
+			Int("excluded_members", summary.ExcludedMembers).
+			Msg("Some group members were excluded by the member filters")
+
+		for _, result := range summary.Results {
+			for _, member := range result.Excluded {
+				log.Debug().
+					Str("email", member.Email).
+					Str("group", member.Group).
+					Str("reason", member.Reason).
+					Str("value", member.Value).
+					Msg("Excluded group member")
+			}
+		}
+	}
+
+	// Warn about circular references
+	if summary.CircularRefsFound > 0 {
+		log.Warn().
+			Int("circular_refs", summary.CircularRefsFound).
+			Msg("Circular references detected and handled")
+
+		// Show which groups had circular references
+		for _, result := range summary.Results {
+			if result.CircularRef {
+				log.Warn().
+					Str("group", result.OriginalEmail).
+					Msg("⚠️  Group involved in circular reference")
+			}
+		}
+	}
+
+	// Provide per-group debug details when debug logging is enabled
+	for _, result := range summary.Results {
+		if result.IsGroup {
+			log.Debug().
+				Str("group", result.OriginalEmail).
+				Int("members_resolved", len(result.ResolvedTo)).
+				Int("nested_groups", len(result.NestedGroups)).
+				Int("failed_nested_groups", len(result.FailedNestedGroups)).
+				Bool("partial_failure", result.PartialFailure).
+				Bool("circular_ref", result.CircularRef).
+				Msg("Mailing list resolved")
+		} else if result.Error != nil {
+			log.Debug().
+				Str("email", result.OriginalEmail).
+				Str("error_type", result.ErrorType).
+				Int("members_resolved", len(result.ResolvedTo)).
+				Err(result.Error).
+				Msg("Mailing list resolution failed")
+		}
+	}
+
+	// Report on partial failures
+	for _, result := range summary.Results {
+		if result.PartialFailure && result.IsGroup {
+			log.Warn().
+				Str("group", result.OriginalEmail).
+				Int("failed_nested_groups", len(result.FailedNestedGroups)).
+				Int("resolved_members", len(result.ResolvedTo)).
+				Msg("⚠️  Group partially resolved - some nested groups failed")
+
+			// Show which nested groups failed
+			for failedGroup, failErr := range result.FailedNestedGroups {
+				log.Warn().
+					Str("nested_group", failedGroup).
+					Str("parent_group", result.OriginalEmail).
+					Err(failErr).
+					Msg("   Failed to resolve nested group")
+			}
+		}
+	}
+
+	// Warn about unresolved groups
+	if summary.UnresolvedGroups > 0 {
+		log.Warn().
+			Int("unresolved_groups", summary.UnresolvedGroups).
+			Msg("Some mailing lists could not be resolved")
+
+		for _, result := range summary.Results {
+			if result.Error != nil && (result.ErrorType == "external_domain" || result.ErrorType == "not_found") {
+				log.Warn().
+					Str("email", result.OriginalEmail).
+					Str("reason", "external domain or not found").
+					Msg("❌ Could not resolve mailing list - may be external domain")
+			}
+		}
+	}
+}
+
+// CalendarProvider fetches busy times with the Google Calendar FreeBusy API
+type CalendarProvider struct {
+	// Service may be nil when Options.Cache is in offline mode
+	Service *googlecalendar.Service
+	Options FetchOptions
+
+	// DiscoverCalendars adds other calendars the authenticated user owns when they are an attendee
+	DiscoverCalendars bool
+}
+
+// Availability fetches busy times for all attendees
+func (p *CalendarProvider) Availability(ctx context.Context, attendees []string, start, end time.Time) ([]Availability, *FetchReport, error) {
+	opts := p.Options
+	if p.DiscoverCalendars {
+		opts.AttendeeCalendars = p.withDiscoveredCalendars(ctx, attendees)
+	}
+
+	availabilities, report, err := calendar.GetBusyTimesWithOptions(ctx, p.Service, attendees, start, end, opts)
+	if err != nil {
+		if ctx.Err() != nil && report != nil {
+			// Cached batches stay on disk, so a rerun picks up where this one stopped
+			log.Warn().
+				Int("requested", report.Requested).
+				Int("retrieved", report.Retrieved).
+				Msg("Busy time fetch stopped before completion")
+		}
+		return availabilities, report, err
+	}
+
+	log.Debug().
+		Int("requested", report.Requested).
+		Int("retrieved", report.Retrieved).
+		Int("failed_batches", len(report.FailedBatches())).
+		Int("retries", report.Retries).
+		Int("recovered", report.Recovered).
+		Int("cached", report.Cached).
+		Dur("duration", report.Duration).
+		Msg("Fetch report")
+
+	return availabilities, report, nil
+}
+
+// withDiscoveredCalendars returns the configured attendee calendars plus the ones found in
+// the user's calendar list. The configured map is copied rather than modified.
+func (p *CalendarProvider) withDiscoveredCalendars(ctx context.Context, attendees []string) map[string][]string {
+	merged := make(map[string][]string, len(p.Options.AttendeeCalendars))
+	for email, ids := range p.Options.AttendeeCalendars {
+		merged[email] = append([]string(nil), ids...)
+	}
+
+	if p.Service == nil {
+		log.Warn().Msg("Skipping calendar discovery in offline mode")
+		return merged
+	}
+
+	discovered, err := calendar.DiscoverAttendeeCalendars(ctx, p.Service, attendees, p.Options.Retrier)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not discover additional calendars")
+		return merged
+	}
+
+	for email, ids := range discovered {
+		log.Info().Str("email", email).Strs("calendars", ids).Msg("Discovered additional calendars")
+		for _, id := range ids {
+			known := false
+			for _, existing := range merged[email] {
+				if existing == id {
+					known = true
+					break
+				}
+			}
+			if !known {
+				merged[email] = append(merged[email], id)
+			}
+		}
+	}
+	return merged
+}
+
+// SnapshotProvider replays the availability saved in a snapshot file
+type SnapshotProvider struct {
+	Snapshot *snapshot.Snapshot
+}
+
+// Availability returns the snapshot's availabilities and fetch report for the requested
+// attendees, so exclusions apply on replay; the requested range is ignored since a
+// snapshot covers a single search
+func (p *SnapshotProvider) Availability(ctx context.Context, attendees []string, start, end time.Time) ([]Availability, *FetchReport, error) {
+	saved, err := p.Snapshot.UserAvailabilities()
+	if err != nil {
+		return nil, nil, NewError(KindInvalidInput, err, "failed to load snapshot availabilities")
+	}
+
+	requested := make(map[string]bool, len(attendees))
+	for _, email := range attendees {
+		requested[strings.ToLower(email)] = true
+	}
+
+	availabilities := make([]Availability, 0, len(attendees))
+	report := p.Snapshot.Report()
+	report.Retrieved = 0
+	for _, avail := range saved {
+		if !requested[strings.ToLower(avail.Email)] {
+			continue
+		}
+		availabilities = append(availabilities, avail)
+		if !avail.IsUnknown() {
+			report.Retrieved++
+		}
+	}
+
+	report.Requested = len(attendees)
+	emailErrors := report.EmailErrors[:0]
+	for _, emailErr := range report.EmailErrors {
+		if requested[strings.ToLower(emailErr.Email)] {
+			emailErrors = append(emailErrors, emailErr)
+		}
+	}
+	report.EmailErrors = emailErrors
+	return availabilities, report, nil
+}
+
+// NewHolidayProvider looks up regional bank holidays for each attendee's timezone.
+// Overrides map a lowercase email to an ISO-3166 region code. A nil client uses a default one.
+func NewHolidayProvider(client *http.Client, overrides map[string]string) HolidayProvider {
+	return holidays.NewService(client, overrides)
+}
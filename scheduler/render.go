@@ -0,0 +1,361 @@
+package scheduler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/optimizer"
+)
+
+// Renderer writes a search result, or the error that ended the search, for people or programs
+type Renderer interface {
+	Render(w io.Writer, result *Result) error
+	// RenderError writes err; result may be nil when the search never started.
+	// It reports whether anything was written.
+	RenderError(w io.Writer, result *Result, err error) (bool, error)
+}
+
+// TextRenderer writes the human-readable report
+type TextRenderer struct{}
+
+// RenderError writes a message when no slot matched; other errors are left to the caller's logs
+func (TextRenderer) RenderError(w io.Writer, result *Result, err error) (bool, error) {
+	if !IsKind(err, KindNoSlots) {
+		return false, nil
+	}
+	_, writeErr := fmt.Fprintln(w, "No suitable meeting times found within the specified constraints.")
+	return true, writeErr
+}
+
+// Render writes the timezone summary, data quality, best options and detailed slots
+func (TextRenderer) Render(w io.Writer, result *Result) error {
+	report := result.FetchReport
+	if report == nil {
+		report = &FetchReport{}
+	}
+	unknown := result.Unknown()
+	slots := result.Slots
+
+	// === TIMEZONE SUMMARY ===
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintln(w, "🌍 TIMEZONE INFORMATION")
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+
+	// Collect timezone information
+	tzMap := make(map[string][]string) // timezone -> list of emails
+	for _, avail := range result.Availabilities {
+		if avail.IsUnknown() {
+			continue
+		}
+		tzName := "Unknown"
+		if avail.TimeZone != nil {
+			tzName = avail.TimeZone.String()
+		}
+		tzMap[tzName] = append(tzMap[tzName], avail.Email)
+	}
+
+	fmt.Fprintf(w, "\nAttendees by timezone:\n")
+	for tz, emails := range tzMap {
+		fmt.Fprintf(w, "  • %s: %d attendee(s)\n", tz, len(emails))
+		for _, email := range emails {
+			if aliases := result.Aliases[email]; len(aliases) > 0 {
+				fmt.Fprintf(w, "    - %s (also listed as %s)\n", email, strings.Join(aliases, ", "))
+				continue
+			}
+			fmt.Fprintf(w, "    - %s\n", email)
+		}
+	}
+	fmt.Fprintf(w, "\nWorking hours: %d:00 - %d:00 (in each attendee's local time)\n",
+		result.Request.WorkingHours.StartHour, result.Request.WorkingHours.EndHour)
+
+	if len(result.Exclusions) > 0 {
+		fmt.Fprintf(w, "\nExcluded attendees: %d\n", result.ExcludedAttendees())
+		for _, exclusion := range result.Exclusions {
+			kind := ""
+			if exclusion.IsGroup {
+				kind = " (mailing list)"
+			}
+			if len(exclusion.Removed) == 0 {
+				fmt.Fprintf(w, "  • %s%s: no attendees removed\n", exclusion.Entry, kind)
+				continue
+			}
+			fmt.Fprintf(w, "  • %s%s: %s\n", exclusion.Entry, kind, strings.Join(exclusion.Removed, ", "))
+		}
+	}
+
+	// === DATA QUALITY ===
+	fmt.Fprintf(w, "\nCalendars retrieved: %d/%d in %s (%d retries, %d recovered, %d from cache)\n",
+		report.Retrieved, report.Requested, report.Duration.Round(time.Millisecond),
+		report.Retries, report.Recovered, report.Cached)
+	for _, batch := range report.FailedBatches() {
+		fmt.Fprintf(w, "  ❌ Batch %d (%d attendee(s)) failed after %d attempt(s): %s\n",
+			batch.Number, len(batch.Emails), batch.Attempts, batch.Category)
+	}
+	for _, emailErr := range report.EmailErrors {
+		if emailErr.Category == calendar.FetchErrorCalendarError {
+			continue // Listed below with the unknown attendees
+		}
+		fmt.Fprintf(w, "    - %s: %s\n", emailErr.Email, emailErr.Category)
+	}
+
+	// === UNKNOWN AVAILABILITY ===
+	if len(unknown) > 0 {
+		fmt.Fprintf(w, "\n❓ Unknown availability (%d attendee(s), excluded from conflict counts):\n", len(unknown))
+		for _, avail := range unknown {
+			fmt.Fprintf(w, "    - %s: %s\n", avail.Email, strings.Join(avail.ErrorReasons(), ", "))
+		}
+	}
+
+	// === BEST OPTIONS SUMMARY ===
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintln(w, "📅 BEST MEETING TIME OPTIONS")
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+
+	// Group slots by conflict level
+	conflictGroups := optimizer.GroupSlotsByConflictLevel(slots)
+
+	// Show best options first
+	if len(conflictGroups["no-conflicts"]) > 0 {
+		fmt.Fprintf(w, "\n🏆 PERFECT SLOTS (All attendees available):\n")
+		fmt.Fprintf(w, "   Found %d perfect slot(s)\n\n", len(conflictGroups["no-conflicts"]))
+
+		// Show up to 3 best no-conflict slots
+		maxShow := 3
+		if len(conflictGroups["no-conflicts"]) < maxShow {
+			maxShow = len(conflictGroups["no-conflicts"])
+		}
+
+		for i := 0; i < maxShow; i++ {
+			slot := conflictGroups["no-conflicts"][i]
+			fmt.Fprintf(w, "   ⭐ %s - %s\n",
+				slot.TimeSlot.Start.Format("Mon, Jan 2 at 15:04"),
+				slot.TimeSlot.End.Format("15:04"),
+			)
+		}
+		if len(conflictGroups["no-conflicts"]) > 3 {
+			fmt.Fprintf(w, "   ... and %d more perfect slots\n", len(conflictGroups["no-conflicts"])-3)
+		}
+	}
+
+	// Show slots with minimal conflicts
+	if len(conflictGroups["low-conflicts"]) > 0 {
+		fmt.Fprintf(w, "\n✅ GOOD OPTIONS (1-25%% conflicts):\n")
+		fmt.Fprintf(w, "   Found %d slot(s) with minimal conflicts\n", len(conflictGroups["low-conflicts"]))
+
+		// Show best one from this group
+		bestLowConflict := conflictGroups["low-conflicts"][0]
+		for _, slot := range conflictGroups["low-conflicts"] {
+			if slot.ConflictPercentage < bestLowConflict.ConflictPercentage {
+				bestLowConflict = slot
+			}
+		}
+		fmt.Fprintf(w, "   Best: %s - %s (%.0f%% conflict)\n",
+			bestLowConflict.TimeSlot.Start.Format("Mon, Jan 2 at 15:04"),
+			bestLowConflict.TimeSlot.End.Format("15:04"),
+			bestLowConflict.ConflictPercentage,
+		)
+	}
+
+	// === SUMMARY BY DAY ===
+	fmt.Fprintln(w, "\n"+strings.Repeat("-", 80))
+	fmt.Fprintf(w, "\n📊 AVAILABILITY SUMMARY BY DAY:\n\n")
+
+	// Group by day for summary
+	grouped := optimizer.GroupSlotsByDay(slots)
+
+	// Sort days chronologically
+	var days []string
+	for day := range grouped {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		daySlots := grouped[day]
+		dayTime, _ := time.Parse("2006-01-02", day)
+
+		bestConflict, avgConflict, perfectCount, _ := optimizer.GetDaySummaryStats(daySlots)
+
+		dayName := dayTime.Format("Mon, Jan 2")
+		fmt.Fprintf(w, "📆 %s\n", dayName)
+		fmt.Fprintf(w, "   Total slots: %d | Perfect slots: %d | Best conflict: %.0f%% | Avg: %.0f%%\n",
+			len(daySlots), perfectCount, bestConflict, avgConflict)
+
+		// Show time ranges for this day
+		if len(daySlots) > 0 {
+			// Find earliest and latest slots
+			earliest := daySlots[0].TimeSlot.Start
+			latest := daySlots[0].TimeSlot.End
+			for _, s := range daySlots {
+				if s.TimeSlot.Start.Before(earliest) {
+					earliest = s.TimeSlot.Start
+				}
+				if s.TimeSlot.End.After(latest) {
+					latest = s.TimeSlot.End
+				}
+			}
+			fmt.Fprintf(w, "   Time range: %s - %s\n",
+				earliest.Format("15:04"),
+				latest.Format("15:04"))
+		}
+		fmt.Fprintln(w)
+	}
+
+	// === DETAILED TIME SLOTS ===
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+	fmt.Fprintf(w, "\n📋 DETAILED TIME SLOTS (Top %d):\n", len(slots))
+	fmt.Fprintln(w, strings.Repeat("-", 80))
+
+	for i, slot := range slots {
+		fmt.Fprintf(w, "\n%d. %s - %s",
+			i+1,
+			slot.TimeSlot.Start.Format("Mon, Jan 2, 2006 at 15:04"),
+			slot.TimeSlot.End.Format("15:04"),
+		)
+
+		if slot.UnavailableCount == 0 {
+			fmt.Fprintf(w, " ✅ Perfect - All attendees available!\n")
+		} else {
+			conflictIcon := "⚠️"
+			if slot.ConflictPercentage > 50 {
+				conflictIcon = "❌"
+			} else if slot.ConflictPercentage <= 25 {
+				conflictIcon = "🟡"
+			}
+
+			fmt.Fprintf(w, " %s %.0f%% conflict\n",
+				conflictIcon,
+				slot.ConflictPercentage,
+			)
+
+			// Show conflicts by type
+			if len(slot.ConflictsByType["calendar"]) > 0 {
+				var calendarDetails []string
+				for _, email := range slot.ConflictsByType["calendar"] {
+					calendarDetails = append(calendarDetails, describeCalendarConflict(email, slot.ConflictCalendars[email]))
+				}
+				fmt.Fprintf(w, "   📅 Calendar conflicts (%d): %s\n",
+					len(slot.ConflictsByType["calendar"]),
+					strings.Join(calendarDetails, ", "))
+			}
+			if len(slot.ConflictsByType["working_hours"]) > 0 {
+				fmt.Fprintf(w, "   ⏰ Outside working hours (%d): %s\n",
+					len(slot.ConflictsByType["working_hours"]),
+					strings.Join(slot.ConflictsByType["working_hours"], ", "))
+			}
+			if len(slot.ConflictsByType["holiday"]) > 0 {
+				var holidayDetails []string
+				for _, email := range slot.ConflictsByType["holiday"] {
+					if name, ok := slot.HolidayConflicts[email]; ok && name != "" {
+						holidayDetails = append(holidayDetails, fmt.Sprintf("%s (%s)", email, name))
+					} else {
+						holidayDetails = append(holidayDetails, email)
+					}
+				}
+				fmt.Fprintf(w, "   🎉 Bank holidays (%d): %s\n",
+					len(slot.ConflictsByType["holiday"]),
+					strings.Join(holidayDetails, ", "))
+			}
+		}
+	}
+
+	// === QUICK RECOMMENDATION ===
+	fmt.Fprintln(w, "\n"+strings.Repeat("=", 80))
+	fmt.Fprintln(w, "💡 RECOMMENDATION:")
+
+	if len(slots) > 0 {
+		bestSlot := RecommendedSlot(slots)
+
+		fmt.Fprintf(w, "   Book: %s - %s\n",
+			bestSlot.TimeSlot.Start.Format("Monday, January 2 at 15:04"),
+			bestSlot.TimeSlot.End.Format("15:04"),
+		)
+
+		if len(bestSlot.UnknownEmails) > 0 {
+			fmt.Fprintf(w, "   Note: %d attendee(s) with unknown availability are not counted\n", len(bestSlot.UnknownEmails))
+		}
+
+		if bestSlot.UnavailableCount == 0 {
+			fmt.Fprintln(w, "   This slot has perfect attendance with all attendees available!")
+		} else {
+			fmt.Fprintf(w, "   Only %.0f%% conflict rate (%d/%d unavailable)\n",
+				bestSlot.ConflictPercentage,
+				bestSlot.UnavailableCount,
+				result.KnownCalendars(),
+			)
+
+			// Show breakdown of conflicts
+			if len(bestSlot.ConflictsByType["calendar"]) > 0 {
+				fmt.Fprintf(w, "   - Calendar conflicts: %d attendee(s)\n", len(bestSlot.ConflictsByType["calendar"]))
+			}
+			if len(bestSlot.ConflictsByType["working_hours"]) > 0 {
+				fmt.Fprintf(w, "   - Outside working hours: %d attendee(s)\n", len(bestSlot.ConflictsByType["working_hours"]))
+			}
+			if len(bestSlot.ConflictsByType["holiday"]) > 0 {
+				fmt.Fprintf(w, "   - Bank holidays: %d attendee(s)\n", len(bestSlot.ConflictsByType["holiday"]))
+			}
+
+			// If this matches what we showed in the GOOD OPTIONS section, mention it
+			if len(conflictGroups["low-conflicts"]) > 0 {
+				bestLowConflict := conflictGroups["low-conflicts"][0]
+				for _, slot := range conflictGroups["low-conflicts"] {
+					if slot.ConflictPercentage < bestLowConflict.ConflictPercentage {
+						bestLowConflict = slot
+					}
+				}
+				if bestSlot.TimeSlot.Start.Equal(bestLowConflict.TimeSlot.Start) &&
+					bestSlot.ConflictPercentage == bestLowConflict.ConflictPercentage {
+					fmt.Fprintln(w, "   (This matches the best option shown above)")
+				}
+			}
+		}
+	}
+	fmt.Fprintln(w, strings.Repeat("=", 80))
+	return nil
+}
+
+// RecommendedSlot picks the best slot: fewest conflicts, then fewest working hours
+// violations, then the earliest start. slots must not be empty.
+func RecommendedSlot(slots []MeetingSlot) MeetingSlot {
+	bestSlot := slots[0]
+	for _, slot := range slots {
+		// Since working hours violations are counted as conflicts,
+		// we can simply use conflict percentage as the primary criterion
+		if slot.ConflictPercentage < bestSlot.ConflictPercentage {
+			bestSlot = slot
+		} else if slot.ConflictPercentage == bestSlot.ConflictPercentage {
+			// If conflicts are equal, prefer fewer working hours violations
+			currentWorkingHoursConflicts := len(slot.ConflictsByType["working_hours"])
+			bestWorkingHoursConflicts := len(bestSlot.ConflictsByType["working_hours"])
+
+			if currentWorkingHoursConflicts < bestWorkingHoursConflicts {
+				bestSlot = slot
+			} else if currentWorkingHoursConflicts == bestWorkingHoursConflicts {
+				// If still equal, prefer earlier time
+				if slot.TimeSlot.Start.Before(bestSlot.TimeSlot.Start) {
+					bestSlot = slot
+				}
+			}
+		}
+	}
+	return bestSlot
+}
+
+// describeCalendarConflict names an attendee with busy time, noting any additional
+// calendar (other than their own) that caused the conflict
+func describeCalendarConflict(email string, calendars []string) string {
+	var others []string
+	for _, id := range calendars {
+		if !strings.EqualFold(id, email) {
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		return email
+	}
+	return fmt.Sprintf("%s (via %s)", email, strings.Join(others, ", "))
+}
@@ -0,0 +1,632 @@
+// Package scheduler finds the best meeting times for a set of attendees.
+//
+// A Scheduler combines injected providers (group resolution, calendar availability,
+// bank holidays) with the slot optimizer. Renderers turn the Result into text or JSON.
+// The best-time-to-meet CLI is a thin caller of this package.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/optimizer"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/progress"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/retry"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/snapshot"
+	"github.com/rs/zerolog/log"
+)
+
+// Aliases for the engine's data types, so importers can name them
+type (
+	Availability      = calendar.UserAvailability
+	TimeSlot          = calendar.TimeSlot
+	Holiday           = calendar.Holiday
+	FetchReport       = calendar.FetchReport
+	FetchOptions      = calendar.FetchOptions
+	MeetingSlot       = optimizer.MeetingSlot
+	WorkingHours      = optimizer.WorkingHoursConfig
+	ResolutionSummary = directory.ResolutionSummary
+	ResolveOptions    = directory.ResolveOptions
+	MemberFilter      = directory.MemberFilter
+	Snapshot          = snapshot.Snapshot
+	Retrier           = retry.Retrier
+	RetryStats        = retry.Stats
+	OperationStats    = retry.OperationStats
+	ProgressReporter  = progress.Reporter
+	ProgressEvent     = progress.Event
+	ProgressFunc      = progress.Func
+)
+
+// Defaults applied to zero Request fields
+const (
+	DefaultDuration = time.Hour
+	DefaultMaxSlots = 10
+)
+
+// NewRetrier creates a retrier with the default policy. Share one across providers
+// and pass its stats to the Scheduler so Result.APIRetries covers every call.
+func NewRetrier(stats *RetryStats) *Retrier {
+	return retry.New(retry.DefaultPolicy(), stats)
+}
+
+// NewRetryStats creates an empty retry statistics collector
+func NewRetryStats() *RetryStats {
+	return retry.NewStats()
+}
+
+// GroupResolver expands mailing lists into member email addresses
+type GroupResolver interface {
+	ResolveGroups(ctx context.Context, groups []string) ([]string, *ResolutionSummary, error)
+}
+
+// IdentityResolver maps addresses to the primary address of their account, so that
+// aliases of the same person can be merged. Keys of the returned map are lowercase.
+type IdentityResolver interface {
+	PrimaryEmails(ctx context.Context, emails []string) (map[string]string, error)
+}
+
+// AvailabilityProvider fetches busy times for attendees between start (inclusive) and end (exclusive)
+type AvailabilityProvider interface {
+	Availability(ctx context.Context, attendees []string, start, end time.Time) ([]Availability, *FetchReport, error)
+}
+
+// HolidayProvider adds bank holidays to attendee availability in place
+type HolidayProvider interface {
+	Augment(ctx context.Context, availabilities []Availability, start, end time.Time) error
+}
+
+// Request describes a meeting search
+type Request struct {
+	Emails       []string       // Individual attendees
+	Groups       []string       // Mailing lists expanded through the GroupResolver
+	Exclude      []string       // People and mailing lists removed from the attendees; lists are expanded too
+	Start        time.Time      // First day of the search
+	End          time.Time      // Last day of the search (inclusive)
+	Location     *time.Location // Timezone used for dates and output (default: time.Local)
+	Duration     time.Duration  // Meeting length (default: DefaultDuration)
+	WorkingHours WorkingHours   // Working and lunch hours, applied in each attendee's timezone
+	MaxSlots     int            // Number of slots to return (default: DefaultMaxSlots)
+	MaxConflicts float64        // Highest conflict percentage to return (0-100)
+	Strict       bool           // Fail with KindPartialData when any attendee's availability is missing
+}
+
+// Result is the outcome of a meeting search
+type Result struct {
+	Request        Request             // The request with defaults applied
+	Attendees      []string            // De-duplicated attendees after group expansion
+	Resolution     *ResolutionSummary  // Group expansion details, nil when no groups were resolved
+	Exclusions     []Exclusion         // What each Request.Exclude entry removed, in request order
+	Aliases        map[string][]string // Attendee -> other addresses it was listed under, when aliases were merged
+	Availabilities []Availability
+	FetchReport    *FetchReport
+	Candidates     []MeetingSlot             // Best slots before the conflict threshold was applied
+	Slots          []MeetingSlot             // Final slots in chronological order
+	APIRetries     map[string]OperationStats // Per-operation retry statistics
+}
+
+// Exclusion is one Request.Exclude entry and the attendees it removed
+type Exclusion struct {
+	Entry   string   // Address as requested
+	IsGroup bool     // True when the entry was expanded as a mailing list
+	Removed []string // Attendees removed because of this entry
+}
+
+// ExcludedAttendees returns the number of distinct attendees removed by Request.Exclude
+func (r *Result) ExcludedAttendees() int {
+	removed := make(map[string]bool)
+	for _, exclusion := range r.Exclusions {
+		for _, email := range exclusion.Removed {
+			removed[strings.ToLower(email)] = true
+		}
+	}
+	return len(removed)
+}
+
+// Unknown returns the attendees whose calendars reported errors
+func (r *Result) Unknown() []Availability {
+	return calendar.GetUnknownAvailabilities(r.Availabilities)
+}
+
+// KnownCalendars returns the number of attendees with usable busy data
+func (r *Result) KnownCalendars() int {
+	return len(r.Availabilities) - len(r.Unknown())
+}
+
+// Missing returns the attendees for whom no calendar data was returned
+func (r *Result) Missing() []string {
+	return calendar.GetMissingCalendars(r.Attendees, r.Availabilities)
+}
+
+// TotalRetries returns the number of retried API calls across all operations
+func (r *Result) TotalRetries() int {
+	total := 0
+	for _, stats := range r.APIRetries {
+		total += stats.Retries
+	}
+	return total
+}
+
+// Scheduler runs meeting searches with injected providers
+type Scheduler struct {
+	Groups       GroupResolver        // Optional; without it groups are treated as individual emails
+	Availability AvailabilityProvider // Required
+	Holidays     HolidayProvider      // Optional; without it bank holidays are not considered
+	Identities   IdentityResolver     // Optional; without it attendees are de-duplicated by address only
+	RetryStats   *RetryStats          // Optional; reported in Result.APIRetries
+}
+
+// Find resolves attendees, fetches their availability and returns the best meeting slots.
+// Errors are *Error values; the Result is filled in as far as the search got, so callers
+// can still render it for KindNoSlots and inspect it for KindNoCalendars or KindPartialData.
+func (s *Scheduler) Find(ctx context.Context, req Request) (result Result, err error) {
+	req = req.withDefaults()
+	result = Result{Request: req}
+	defer func() {
+		if s.RetryStats != nil {
+			result.APIRetries = s.RetryStats.Snapshot()
+		}
+	}()
+
+	if err := req.validate(); err != nil {
+		return result, err
+	}
+	if s.Availability == nil {
+		return result, NewError(KindFailure, nil, "no availability provider configured")
+	}
+
+	attendees, resolution, err := s.resolveAttendees(ctx, req)
+	result.Attendees, result.Resolution = attendees, resolution
+	if err != nil {
+		return result, err
+	}
+
+	attendees, result.Aliases = s.mergeAliases(ctx, attendees)
+	result.Attendees = attendees
+	if interrupted := InterruptionError(ctx, "alias resolution"); interrupted != nil {
+		return result, interrupted
+	}
+
+	attendees, result.Exclusions, err = s.applyExclusions(ctx, attendees, req.Exclude)
+	result.Attendees = attendees
+	if err != nil {
+		return result, err
+	}
+
+	log.Info().Msg("Searching for optimal meeting times...")
+	log.Info().
+		Strs("attendees", attendees).
+		Str("start_date", req.Start.Format("2006-01-02")).
+		Str("end_date", req.End.Format("2006-01-02")).
+		Int("duration_minutes", int(req.Duration.Minutes())).
+		Int("start_hour", req.WorkingHours.StartHour).
+		Int("end_hour", req.WorkingHours.EndHour).
+		Int("lunch_start_hour", req.WorkingHours.LunchStartHour).
+		Int("lunch_end_hour", req.WorkingHours.LunchEndHour).
+		Str("timezone", req.Location.String()).
+		Bool("exclude_weekends", req.WorkingHours.ExcludeWeekends).
+		Msg("Search parameters")
+
+	availabilities, report, err := s.Availability.Availability(ctx, attendees, req.Start, req.End.Add(24*time.Hour))
+	result.Availabilities, result.FetchReport = availabilities, report
+	if err != nil {
+		if interrupted := InterruptionError(ctx, "busy time fetch"); interrupted != nil {
+			return result, interrupted
+		}
+		var schedErr *Error
+		switch {
+		case errors.As(err, &schedErr):
+			return result, schedErr
+		case IsAuthError(err):
+			return result, NewError(KindAuthFailure, err, "Google rejected the calendar request")
+		default:
+			return result, NewError(KindNoCalendars, err, "failed to get busy times")
+		}
+	}
+	if report == nil {
+		report = &FetchReport{Requested: len(attendees), Retrieved: len(availabilities)}
+		result.FetchReport = report
+	}
+
+	if req.Strict && !report.Complete() {
+		for _, emailErr := range report.EmailErrors {
+			log.Error().
+				Str("email", emailErr.Email).
+				Str("category", emailErr.Category).
+				Str("detail", emailErr.Detail).
+				Msg("Missing availability")
+		}
+		return result, NewError(KindPartialData, nil, "strict mode: availability is missing for some attendees").
+			WithDetail("missing_attendees", report.MissingEmails())
+	}
+
+	log.Debug().
+		Int("requested_attendees", len(attendees)).
+		Int("available_calendars", len(availabilities)).
+		Msg("Calendar access summary")
+
+	for _, avail := range availabilities {
+		log.Debug().Str("email", avail.Email).Str("status", string(avail.Status)).Msg("Got calendar data")
+	}
+
+	// Calendars that returned FreeBusy errors are present but must not be treated as free
+	unknown := result.Unknown()
+	known := len(availabilities) - len(unknown)
+	if known < len(attendees) {
+		missing := result.Missing()
+		log.Warn().
+			Int("accessible_calendars", known).
+			Int("requested_attendees", len(attendees)).
+			Int("missing_calendars", len(missing)).
+			Int("unknown_calendars", len(unknown)).
+			Msg("Could not access all requested calendars")
+
+		if known == 0 {
+			return result, NewError(KindNoCalendars, nil, "no calendar data available to process").
+				WithDetail("missing_attendees", missing)
+		}
+	}
+
+	// Enrich attendee availability with public holidays
+	if s.Holidays != nil {
+		if err := s.Holidays.Augment(ctx, availabilities, req.Start, req.End); err != nil {
+			log.Warn().Err(err).Msg("Some bank holiday lookups failed")
+		}
+		if err := InterruptionError(ctx, "bank holiday lookup"); err != nil {
+			return result, err
+		}
+	}
+
+	// Get potential meeting slots (working hours)
+	potentialSlots := calendar.GetWorkingHours(
+		req.Start,
+		req.End,
+		req.WorkingHours.StartHour,
+		req.WorkingHours.EndHour,
+		req.WorkingHours.LunchStartHour,
+		req.WorkingHours.LunchEndHour,
+		req.WorkingHours.ExcludeWeekends,
+	)
+
+	// Find optimal meeting times
+	candidates, err := optimizer.FindOptimalMeetingSlots(
+		ctx,
+		availabilities,
+		potentialSlots,
+		req.Duration,
+		req.MaxSlots*3, // Get more slots initially for filtering
+		req.WorkingHours,
+	)
+	if err != nil {
+		if interrupted := InterruptionError(ctx, "slot search"); interrupted != nil {
+			return result, interrupted
+		}
+		return result, NewError(KindFailure, err, "failed to find meeting slots")
+	}
+	result.Candidates = candidates
+
+	log.Debug().
+		Int("total_slots", len(candidates)).
+		Msg("Found optimal slots")
+
+	if len(candidates) > 0 {
+		log.Debug().
+			Float64("first_slot_conflict_pct", candidates[0].ConflictPercentage).
+			Float64("last_slot_conflict_pct", candidates[len(candidates)-1].ConflictPercentage).
+			Msg("Conflict percentage range")
+	}
+
+	// Filter by conflict threshold
+	slots := optimizer.FilterSlotsByThreshold(candidates, req.MaxConflicts)
+
+	log.Debug().
+		Float64("max_conflicts_threshold", req.MaxConflicts).
+		Int("filtered_slots", len(slots)).
+		Msg("Filtered by conflict threshold")
+
+	// Limit to requested number of slots
+	if len(slots) > req.MaxSlots {
+		slots = slots[:req.MaxSlots]
+	}
+
+	// Sort the final results chronologically for calendar-style display
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].TimeSlot.Start.Before(slots[j].TimeSlot.Start)
+	})
+	result.Slots = slots
+
+	if len(slots) == 0 {
+		return result, NewError(KindNoSlots, nil, "no suitable meeting times found within the specified constraints").
+			WithDetail("candidate_slots", len(candidates))
+	}
+	return result, nil
+}
+
+// withDefaults fills in zero values with the package defaults
+func (r Request) withDefaults() Request {
+	if r.Location == nil {
+		r.Location = time.Local
+	}
+	if r.Duration <= 0 {
+		r.Duration = DefaultDuration
+	}
+	if r.MaxSlots <= 0 {
+		r.MaxSlots = DefaultMaxSlots
+	}
+	return r
+}
+
+// validate checks the request for values the search cannot work with
+func (r Request) validate() error {
+	switch {
+	case len(r.Emails) == 0 && len(r.Groups) == 0:
+		return NewError(KindInvalidInput, nil, "at least one attendee email or mailing list must be provided")
+	case r.Start.IsZero() || r.End.IsZero():
+		return NewError(KindInvalidInput, nil, "a start and end date are required")
+	case r.End.Before(r.Start):
+		return NewError(KindInvalidInput, nil, "end date %s is before start date %s",
+			r.End.Format("2006-01-02"), r.Start.Format("2006-01-02"))
+	case r.MaxConflicts < 0 || r.MaxConflicts > 100:
+		return NewError(KindInvalidInput, nil, "max conflicts must be between 0 and 100, got %g", r.MaxConflicts)
+	}
+	return nil
+}
+
+// resolveAttendees expands mailing lists and returns the de-duplicated attendee list
+func (s *Scheduler) resolveAttendees(ctx context.Context, req Request) ([]string, *ResolutionSummary, error) {
+	allEmails := cleanAddresses(req.Emails)
+	groups := cleanAddresses(req.Groups)
+
+	var resolution *ResolutionSummary
+	if len(groups) > 0 {
+		if s.Groups == nil {
+			log.Warn().Msg("Treating mailing lists as individual emails")
+			for _, group := range groups {
+				// Org selectors name no one without the Directory API
+				if _, ok := directory.ParseSelector(group); ok {
+					log.Warn().Str("selector", group).Msg("Skipping org selector that needs the Directory API")
+					continue
+				}
+				allEmails = append(allEmails, group)
+			}
+		} else {
+			members, summary, err := s.Groups.ResolveGroups(ctx, groups)
+			if interrupted := InterruptionError(ctx, "attendee resolution"); interrupted != nil {
+				return nil, summary, interrupted
+			}
+			if err != nil {
+				return nil, summary, NewError(KindFailure, err, "failed to resolve mailing lists")
+			}
+			resolution = summary
+			allEmails = append(allEmails, members...)
+		}
+	}
+
+	// Remove duplicates
+	seen := make(map[string]bool)
+	var attendees []string
+	for _, email := range allEmails {
+		if !seen[email] {
+			seen[email] = true
+			attendees = append(attendees, email)
+		}
+	}
+
+	if len(attendees) == 0 {
+		return nil, resolution, NewError(KindInvalidInput, nil, "no valid email addresses found")
+	}
+	return attendees, resolution, nil
+}
+
+// mergeAliases replaces each attendee with their primary address and drops the duplicates
+// this reveals. It returns the other addresses each merged attendee was listed under.
+func (s *Scheduler) mergeAliases(ctx context.Context, attendees []string) ([]string, map[string][]string) {
+	primaries := s.primaryEmails(ctx, attendees)
+	if primaries == nil {
+		return attendees, nil
+	}
+
+	var merged []string
+	seen := make(map[string]bool)
+	addresses := make(map[string]map[string]string) // primary -> lowercase address -> original
+	for _, email := range attendees {
+		primary := primaryOf(primaries, email)
+		key := strings.ToLower(primary)
+		if !seen[key] {
+			seen[key] = true
+			merged = append(merged, primary)
+			addresses[key] = make(map[string]string)
+		}
+		if !strings.EqualFold(email, primary) {
+			addresses[key][strings.ToLower(email)] = email
+		}
+	}
+
+	var aliases map[string][]string
+	for _, primary := range merged {
+		others := addresses[strings.ToLower(primary)]
+		if len(others) == 0 {
+			continue
+		}
+		if aliases == nil {
+			aliases = make(map[string][]string)
+		}
+		for _, email := range others {
+			aliases[primary] = append(aliases[primary], email)
+		}
+		sort.Strings(aliases[primary])
+	}
+	if removed := len(attendees) - len(merged); removed > 0 {
+		log.Info().Int("duplicates", removed).Int("attendees", len(merged)).Msg("Merged attendees listed under several addresses")
+	}
+	return merged, aliases
+}
+
+// primaryEmails looks up the primary address of each email, or returns nil when
+// aliases are not resolved
+func (s *Scheduler) primaryEmails(ctx context.Context, emails []string) map[string]string {
+	if s.Identities == nil || len(emails) == 0 {
+		return nil
+	}
+	primaries, err := s.Identities.PrimaryEmails(ctx, emails)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not resolve email aliases; attendees are de-duplicated by address only")
+		return nil
+	}
+	return primaries
+}
+
+// primaryOf returns the primary address of email, or email itself when it is unknown
+func primaryOf(primaries map[string]string, email string) string {
+	if primary, ok := primaries[strings.ToLower(strings.TrimSpace(email))]; ok && primary != "" {
+		return primary
+	}
+	return email
+}
+
+// ByPrimaryAddress re-keys settings given per attendee address by primary address, so settings
+// written for an alias still apply once attendees are merged under their primary address.
+// Keys are lowercase addresses. Settings given for the primary address itself win; merge
+// combines the others into them. Settings are returned as given when lookups fail.
+func ByPrimaryAddress[V any](ctx context.Context, identities IdentityResolver, settings map[string]V, merge func(existing, value V) V) map[string]V {
+	if identities == nil || len(settings) == 0 {
+		return settings
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	primaries, err := identities.PrimaryEmails(ctx, keys)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not resolve aliases in attendee settings; using them as given")
+		return settings
+	}
+	primary := func(key string) string {
+		return strings.ToLower(primaryOf(primaries, key))
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i] == primary(keys[i]) && keys[j] != primary(keys[j])
+	})
+
+	rekeyed := make(map[string]V, len(settings))
+	for _, key := range keys {
+		target := primary(key)
+		if existing, ok := rekeyed[target]; ok {
+			rekeyed[target] = merge(existing, settings[key])
+			continue
+		}
+		rekeyed[target] = settings[key]
+		if target != key {
+			log.Debug().Str("address", key).Str("primary", target).Msg("Applying attendee settings given for an alias to the primary address")
+		}
+	}
+	return rekeyed
+}
+
+// applyExclusions removes excluded people, and the members of excluded mailing lists, from attendees
+func (s *Scheduler) applyExclusions(ctx context.Context, attendees, exclude []string) ([]string, []Exclusion, error) {
+	entries := cleanAddresses(exclude)
+	if len(entries) == 0 {
+		return attendees, nil, nil
+	}
+
+	isAttendee := make(map[string]bool, len(attendees))
+	for _, email := range attendees {
+		isAttendee[strings.ToLower(email)] = true
+	}
+
+	// Each entry excludes itself, plus its members when it turns out to be a group.
+	// Entries that are attendees themselves are people, so only the others are expanded.
+	exclusions := make([]Exclusion, len(entries))
+	members := make([][]string, len(entries))
+	var groups []string
+	for i, entry := range entries {
+		exclusions[i] = Exclusion{Entry: entry}
+		members[i] = []string{entry}
+		if !isAttendee[strings.ToLower(entry)] {
+			groups = append(groups, entry)
+		}
+	}
+	if s.Groups != nil && len(groups) > 0 {
+		log.Info().Int("entries", len(groups)).Msg("Resolving excluded mailing lists...")
+		_, summary, err := s.Groups.ResolveGroups(ctx, groups)
+		if interrupted := InterruptionError(ctx, "exclusion resolution"); interrupted != nil {
+			return attendees, nil, interrupted
+		}
+		if err != nil {
+			return attendees, nil, NewError(KindFailure, err, "failed to resolve excluded mailing lists")
+		}
+		for _, res := range summary.Results {
+			if !res.IsGroup {
+				continue
+			}
+			for i, entry := range entries {
+				if strings.EqualFold(entry, res.OriginalEmail) {
+					exclusions[i].IsGroup = true
+					members[i] = append(members[i], res.ResolvedTo...)
+				}
+			}
+		}
+	}
+
+	// Aliases of an attendee exclude them too
+	var all []string
+	for _, emails := range members {
+		all = append(all, emails...)
+	}
+	primaries := s.primaryEmails(ctx, all)
+
+	excludedBy := make(map[string][]int) // lowercase email -> indexes of the entries excluding it
+	for i, emails := range members {
+		for _, email := range emails {
+			key := strings.ToLower(primaryOf(primaries, email))
+			if indexes := excludedBy[key]; len(indexes) == 0 || indexes[len(indexes)-1] != i {
+				excludedBy[key] = append(indexes, i)
+			}
+		}
+	}
+
+	var kept []string
+	for _, email := range attendees {
+		indexes, excluded := excludedBy[strings.ToLower(email)]
+		if !excluded {
+			kept = append(kept, email)
+			continue
+		}
+		for _, i := range indexes {
+			exclusions[i].Removed = append(exclusions[i].Removed, email)
+		}
+	}
+
+	for _, exclusion := range exclusions {
+		if len(exclusion.Removed) == 0 {
+			log.Warn().Str("entry", exclusion.Entry).Msg("Excluded address matched no attendee")
+		}
+	}
+	log.Info().
+		Int("entries", len(entries)).
+		Int("removed", len(attendees)-len(kept)).
+		Int("remaining", len(kept)).
+		Msg("Applied attendee exclusions")
+	if len(kept) == 0 {
+		return nil, exclusions, NewError(KindInvalidInput, nil, "all %d attendees were excluded", len(attendees))
+	}
+	return kept, exclusions, nil
+}
+
+// cleanAddresses trims addresses and drops empty ones
+func cleanAddresses(addresses []string) []string {
+	var cleaned []string
+	for _, address := range addresses {
+		if address = strings.TrimSpace(address); address != "" {
+			cleaned = append(cleaned, address)
+		}
+	}
+	return cleaned
+}
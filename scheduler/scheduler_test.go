@@ -0,0 +1,409 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/calendar"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/directory"
+	"github.com/LorisFriedel/find-best-meeting-time-google/internal/snapshot"
+	"google.golang.org/api/googleapi"
+)
+
+type fakeAvailability struct {
+	busy      map[string][]TimeSlot
+	missing   map[string]bool
+	attendees []string
+}
+
+func (f *fakeAvailability) Availability(ctx context.Context, attendees []string, start, end time.Time) ([]Availability, *FetchReport, error) {
+	f.attendees = attendees
+	report := &FetchReport{Requested: len(attendees)}
+	var availabilities []Availability
+	for _, email := range attendees {
+		if f.missing[email] {
+			report.EmailErrors = append(report.EmailErrors, calendar.EmailFetchError{Email: email, Category: calendar.FetchErrorCalendarError, Detail: "notFound"})
+			continue
+		}
+		availabilities = append(availabilities, Availability{
+			Email:     email,
+			Status:    calendar.AvailabilityKnown,
+			TimeZone:  time.UTC,
+			BusySlots: f.busy[email],
+		})
+		report.Retrieved++
+	}
+	return availabilities, report, nil
+}
+
+type fakeGroups map[string][]string
+
+func (f fakeGroups) ResolveGroups(ctx context.Context, groups []string) ([]string, *ResolutionSummary, error) {
+	var members []string
+	summary := &ResolutionSummary{ResolvedGroups: len(groups)}
+	for _, group := range groups {
+		members = append(members, f[group]...)
+		_, isGroup := f[group]
+		summary.Results = append(summary.Results, directory.ResolutionResult{OriginalEmail: group, ResolvedTo: f[group], IsGroup: isGroup})
+	}
+	return members, summary, nil
+}
+
+type fakeIdentities map[string]string
+
+func (f fakeIdentities) PrimaryEmails(ctx context.Context, emails []string) (map[string]string, error) {
+	primaries := make(map[string]string)
+	for _, email := range emails {
+		key := strings.ToLower(email)
+		if primary, ok := f[key]; ok {
+			primaries[key] = primary
+		} else {
+			primaries[key] = email
+		}
+	}
+	return primaries, nil
+}
+
+func testRequest() Request {
+	// Monday 2024-01-15, a single working day
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	return Request{
+		Emails:       []string{"alice@example.com", "bob@example.com"},
+		Start:        day,
+		End:          day,
+		Location:     time.UTC,
+		Duration:     time.Hour,
+		MaxSlots:     3,
+		MaxConflicts: 100,
+		WorkingHours: WorkingHours{StartHour: 9, EndHour: 17, LunchStartHour: 12, LunchEndHour: 13},
+	}
+}
+
+func TestFindReturnsConflictFreeSlots(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	provider := &fakeAvailability{busy: map[string][]TimeSlot{
+		"alice@example.com": {{Start: day.Add(9 * time.Hour), End: day.Add(10 * time.Hour)}},
+	}}
+
+	result, err := (&Scheduler{Availability: provider}).Find(context.Background(), testRequest())
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(result.Slots) == 0 {
+		t.Fatalf("expected slots")
+	}
+	for i, slot := range result.Slots {
+		if i > 0 && slot.TimeSlot.Start.Before(result.Slots[i-1].TimeSlot.Start) {
+			t.Fatalf("slots are not chronological: %v", result.Slots)
+		}
+	}
+	if best := RecommendedSlot(result.Slots); best.ConflictPercentage != 0 || best.TimeSlot.Start.Hour() == 9 {
+		t.Fatalf("expected a conflict-free recommendation, got %+v", best)
+	}
+}
+
+func TestFindReturnsNoSlotsWithResult(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	allDay := []TimeSlot{{Start: day.Add(9 * time.Hour), End: day.Add(17 * time.Hour)}}
+	provider := &fakeAvailability{busy: map[string][]TimeSlot{
+		"alice@example.com": allDay,
+		"bob@example.com":   allDay,
+	}}
+	req := testRequest()
+	req.MaxConflicts = 0
+
+	result, err := (&Scheduler{Availability: provider}).Find(context.Background(), req)
+	if !IsKind(err, KindNoSlots) || ExitCode(err) != ExitNoSlots {
+		t.Fatalf("expected no_slots error, got %v", err)
+	}
+	if len(result.Candidates) == 0 || len(result.Attendees) != 2 {
+		t.Fatalf("expected the result to be filled in, got %+v", result)
+	}
+
+	var buf bytes.Buffer
+	written, renderErr := JSONRenderer{}.RenderError(&buf, &result, err)
+	if renderErr != nil || !written {
+		t.Fatalf("render error: written=%v err=%v", written, renderErr)
+	}
+	var output JSONOutput
+	if err := json.Unmarshal(buf.Bytes(), &output); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if output.Error == nil || output.Error.Code != KindNoSlots || output.Error.ExitCode != ExitNoSlots {
+		t.Fatalf("unexpected error output: %+v", output.Error)
+	}
+}
+
+func TestFindExpandsGroupsAndDeduplicates(t *testing.T) {
+	provider := &fakeAvailability{}
+	req := testRequest()
+	req.Groups = []string{" team@example.com ", ""}
+	sched := &Scheduler{
+		Groups:       fakeGroups{"team@example.com": {"bob@example.com", "carol@example.com"}},
+		Availability: provider,
+	}
+
+	result, err := sched.Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	want := "alice@example.com,bob@example.com,carol@example.com"
+	if got := strings.Join(provider.attendees, ","); got != want {
+		t.Fatalf("attendees = %s, want %s", got, want)
+	}
+	if result.Resolution == nil || result.Resolution.ResolvedGroups != 1 {
+		t.Fatalf("expected resolution summary, got %+v", result.Resolution)
+	}
+}
+
+func TestFindAppliesExclusions(t *testing.T) {
+	provider := &fakeAvailability{}
+	req := testRequest()
+	req.Emails = append(req.Emails, "dave@example.com")
+	req.Groups = []string{"eng@example.com"}
+	req.Exclude = []string{"oncall@example.com", "Alice@example.com", "nobody@example.com"}
+	sched := &Scheduler{
+		Groups: fakeGroups{
+			"eng@example.com":    {"bob@example.com", "carol@example.com", "erin@example.com"},
+			"oncall@example.com": {"carol@example.com", "bob@example.com"},
+		},
+		Availability: provider,
+	}
+
+	result, err := sched.Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	want := "dave@example.com,erin@example.com"
+	if got := strings.Join(provider.attendees, ","); got != want {
+		t.Fatalf("attendees = %s, want %s", got, want)
+	}
+	if result.ExcludedAttendees() != 3 || len(result.Exclusions) != 3 {
+		t.Fatalf("unexpected exclusions %+v", result.Exclusions)
+	}
+	if oncall := result.Exclusions[0]; !oncall.IsGroup || strings.Join(oncall.Removed, ",") != "bob@example.com,carol@example.com" {
+		t.Fatalf("unexpected group exclusion %+v", oncall)
+	}
+	if alice := result.Exclusions[1]; alice.IsGroup || strings.Join(alice.Removed, ",") != "alice@example.com" {
+		t.Fatalf("unexpected individual exclusion %+v", alice)
+	}
+	if nobody := result.Exclusions[2]; len(nobody.Removed) != 0 {
+		t.Fatalf("expected no attendee removed by %+v", nobody)
+	}
+
+	output := NewJSONOutput(&result)
+	if output.Metadata.ExcludedAttendees != 3 || len(output.Metadata.Exclusions) != 3 || output.Metadata.Exclusions[2].Removed == nil {
+		t.Fatalf("unexpected JSON metadata %+v", output.Metadata)
+	}
+
+	req.Exclude = []string{"eng@example.com", "alice@example.com", "bob@example.com", "dave@example.com"}
+	if _, err := sched.Find(context.Background(), req); !IsKind(err, KindInvalidInput) {
+		t.Fatalf("expected excluding everyone to be invalid input, got %v", err)
+	}
+}
+
+func TestFindReplaysSnapshotWithExclusions(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	attendees := []string{"alice@example.com", "Bob@example.com", "carol@example.com"}
+	snap := snapshot.New(attendees, snapshot.Parameters{}, []calendar.UserAvailability{
+		{Email: "alice@example.com", Status: calendar.AvailabilityKnown, TimeZone: time.UTC},
+		{Email: "Bob@example.com", Status: calendar.AvailabilityKnown, TimeZone: time.UTC,
+			BusySlots: []TimeSlot{{Start: day.Add(9 * time.Hour), End: day.Add(17 * time.Hour)}}},
+		{Email: "carol@example.com", Status: calendar.AvailabilityUnknown},
+	}, &calendar.FetchReport{
+		Requested:   3,
+		Retrieved:   2,
+		EmailErrors: []calendar.EmailFetchError{{Email: "carol@example.com", Category: calendar.FetchErrorCalendarError}},
+	})
+
+	req := testRequest()
+	req.Emails = attendees
+	req.Exclude = []string{"bob@example.com"}
+	result, err := (&Scheduler{Availability: &SnapshotProvider{Snapshot: snap}}).Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+
+	var emails []string
+	for _, avail := range result.Availabilities {
+		emails = append(emails, avail.Email)
+	}
+	if strings.Join(emails, ",") != "alice@example.com,carol@example.com" {
+		t.Fatalf("excluded attendees should not be replayed, got %v", emails)
+	}
+	if report := result.FetchReport; report.Requested != 2 || report.Retrieved != 1 || len(report.EmailErrors) != 1 {
+		t.Fatalf("unexpected fetch report %+v", report)
+	}
+	if best := RecommendedSlot(result.Slots); best.ConflictPercentage != 0 || best.UnavailableCount != 0 {
+		t.Fatalf("the excluded attendee's busy time should not count, got %+v", best)
+	}
+}
+
+func TestFindMergesAliases(t *testing.T) {
+	provider := &fakeAvailability{}
+	req := testRequest()
+	req.Emails = []string{"bob@example.com", "alice@example.com"}
+	req.Groups = []string{"team@example.com"}
+	sched := &Scheduler{
+		Groups:       fakeGroups{"team@example.com": {"Robert.Smith@example.com", "carol@example.com", "al@example.com"}},
+		Identities:   fakeIdentities{"bob@example.com": "robert.smith@example.com", "robert.smith@example.com": "robert.smith@example.com", "al@example.com": "alice@example.com"},
+		Availability: provider,
+	}
+
+	result, err := sched.Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	want := "robert.smith@example.com,alice@example.com,carol@example.com"
+	if got := strings.Join(provider.attendees, ","); got != want {
+		t.Fatalf("attendees = %s, want %s", got, want)
+	}
+	wantAliases := map[string][]string{
+		"robert.smith@example.com": {"bob@example.com"},
+		"alice@example.com":        {"al@example.com"},
+	}
+	if !reflect.DeepEqual(result.Aliases, wantAliases) {
+		t.Fatalf("unexpected aliases %v", result.Aliases)
+	}
+
+	// Excluding someone by an alias removes them
+	req.Exclude = []string{"bob@example.com"}
+	result, err = sched.Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if got := strings.Join(result.Attendees, ","); got != "alice@example.com,carol@example.com" {
+		t.Fatalf("attendees after exclusion = %s", got)
+	}
+}
+
+func TestFindWithoutResolverTreatsGroupsAsEmails(t *testing.T) {
+	provider := &fakeAvailability{}
+	req := testRequest()
+	req.Emails = nil
+	req.Groups = []string{"team@example.com"}
+
+	result, err := (&Scheduler{Availability: provider}).Find(context.Background(), req)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(result.Attendees) != 1 || result.Attendees[0] != "team@example.com" || result.Resolution != nil {
+		t.Fatalf("unexpected attendees %v / resolution %+v", result.Attendees, result.Resolution)
+	}
+}
+
+func TestFindStrictFailsOnMissingAvailability(t *testing.T) {
+	provider := &fakeAvailability{missing: map[string]bool{"bob@example.com": true}}
+	req := testRequest()
+	req.Strict = true
+
+	_, err := (&Scheduler{Availability: provider}).Find(context.Background(), req)
+	if !IsKind(err, KindPartialData) {
+		t.Fatalf("expected partial_data error, got %v", err)
+	}
+	missing, _ := AsError(err).Details["missing_attendees"].([]string)
+	if len(missing) != 1 || missing[0] != "bob@example.com" {
+		t.Fatalf("unexpected missing attendees: %v", AsError(err).Details)
+	}
+
+	// Without strict mode the search continues with the calendars it has
+	req.Strict = false
+	if _, err := (&Scheduler{Availability: provider}).Find(context.Background(), req); err != nil {
+		t.Fatalf("non-strict find: %v", err)
+	}
+}
+
+func TestFindNoCalendars(t *testing.T) {
+	provider := &fakeAvailability{missing: map[string]bool{"alice@example.com": true, "bob@example.com": true}}
+
+	_, err := (&Scheduler{Availability: provider}).Find(context.Background(), testRequest())
+	if ExitCode(err) != ExitNoCalendars {
+		t.Fatalf("expected no_calendars error, got %v", err)
+	}
+}
+
+func TestFindValidatesRequest(t *testing.T) {
+	req := testRequest()
+	req.End = req.Start.AddDate(0, 0, -1)
+
+	_, err := (&Scheduler{Availability: &fakeAvailability{}}).Find(context.Background(), req)
+	if !IsKind(err, KindInvalidInput) {
+		t.Fatalf("expected invalid_input error, got %v", err)
+	}
+}
+
+func TestFindHonorsCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := testRequest()
+	req.Groups = []string{"team@example.com"}
+	sched := &Scheduler{Groups: fakeGroups{}, Availability: &fakeAvailability{}}
+
+	_, err := sched.Find(ctx, req)
+	if ExitCode(err) != ExitInterrupted {
+		t.Fatalf("expected interrupted error, got %v", err)
+	}
+}
+
+func TestIsAuthErrorIgnoresQuotaErrors(t *testing.T) {
+	apiError := func(code int, reason string) error {
+		return fmt.Errorf("unable to retrieve freebusy: %w", &googleapi.Error{Code: code, Errors: []googleapi.ErrorItem{{Reason: reason}}})
+	}
+	tests := []struct {
+		err  error
+		auth bool
+	}{
+		{apiError(http.StatusUnauthorized, "authError"), true},
+		{apiError(http.StatusForbidden, "forbidden"), true},
+		{apiError(http.StatusForbidden, "insufficientPermissions"), true},
+		{apiError(http.StatusForbidden, "rateLimitExceeded"), false},
+		{apiError(http.StatusForbidden, "userRateLimitExceeded"), false},
+		{apiError(http.StatusForbidden, "quotaExceeded"), false},
+		{apiError(http.StatusTooManyRequests, "rateLimitExceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := IsAuthError(tt.err); got != tt.auth {
+			t.Errorf("IsAuthError(%v) = %v, want %v", tt.err, got, tt.auth)
+		}
+	}
+}
+
+func TestByPrimaryAddressRekeysAliasSettings(t *testing.T) {
+	identities := fakeIdentities{
+		"bob@example.com":          "Robert.Smith@example.com",
+		"robert.smith@example.com": "Robert.Smith@example.com",
+		"al@example.com":           "alice@example.com",
+	}
+
+	calendars := ByPrimaryAddress(context.Background(), identities, map[string][]string{
+		"bob@example.com":          {"bob-oncall"},
+		"robert.smith@example.com": {"robert-personal"},
+		"al@example.com":           {"al-personal"},
+		"partner@other.com":        {"partner-team"},
+	}, func(existing, ids []string) []string { return append(existing, ids...) })
+	wantCalendars := map[string][]string{
+		"robert.smith@example.com": {"robert-personal", "bob-oncall"},
+		"alice@example.com":        {"al-personal"},
+		"partner@other.com":        {"partner-team"},
+	}
+	if !reflect.DeepEqual(calendars, wantCalendars) {
+		t.Fatalf("unexpected calendars %v", calendars)
+	}
+
+	// The setting given for the primary address wins over the alias
+	regions := ByPrimaryAddress(context.Background(), identities, map[string]string{
+		"bob@example.com":          "GB",
+		"robert.smith@example.com": "FR",
+		"al@example.com":           "DE",
+	}, func(existing, _ string) string { return existing })
+	if want := map[string]string{"robert.smith@example.com": "FR", "alice@example.com": "DE"}; !reflect.DeepEqual(regions, want) {
+		t.Fatalf("unexpected regions %v", regions)
+	}
+}